@@ -1,58 +1,270 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"log"
-	"os"
-
-	"github.com/joho/godotenv"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+// Config is the full application configuration. Every setting can come from
+// the defaults, a YAML or TOML file, the environment (env tag) or a command
+// line flag (flag tag), later sources overriding earlier ones; see Load.
 type Config struct {
-	Port       string
-	Mongo_URI  string
-	JWT_SECRET string
-	JWT_EXPIRE string
-	DB_NAME    string
+	// Env selects the profile, e.g. config.production.yaml next to the base file
+	Env string `yaml:"env" toml:"env" env:"APP_ENV" flag:"env"`
+	// Storage is "mongo" or "memory"; memory keeps everything in process and
+	// is lost on restart, for QA and demos only
+	Storage string       `yaml:"storage" toml:"storage" env:"STORAGE" flag:"storage"`
+	Server  ServerConfig `yaml:"server" toml:"server"`
+	Mongo   MongoConfig  `yaml:"mongo" toml:"mongo"`
+	Auth    AuthConfig   `yaml:"auth" toml:"auth"`
+	Mail    MailConfig   `yaml:"mail" toml:"mail"`
+	Log     LogConfig    `yaml:"log" toml:"log"`
+}
+
+type ServerConfig struct {
+	Port   string `yaml:"port" toml:"port" env:"PORT" flag:"port"`
+	AppURL string `yaml:"appUrl" toml:"appUrl" env:"APP_URL" flag:"app-url"`
+	// serves /metrics on its own listener; keep it off the public network
+	AdminPort string `yaml:"adminPort" toml:"adminPort" env:"ADMIN_PORT" flag:"admin-port"`
+	// comma separated CIDRs or IPs of the load balancers in front of the
+	// server, whose X-Forwarded-For gives the client address; empty trusts none
+	TrustedProxies string `yaml:"trustedProxies" toml:"trustedProxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies"`
+	// http server timeouts and how long in-flight requests get to finish on shutdown
+	ReadTimeout     time.Duration `yaml:"readTimeout" toml:"readTimeout" env:"READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"writeTimeout" toml:"writeTimeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idleTimeout" toml:"idleTimeout" env:"IDLE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+type MongoConfig struct {
+	URI                    string        `yaml:"uri" toml:"uri" env:"MONGO_URI" flag:"mongo-uri"`
+	Database               string        `yaml:"database" toml:"database" env:"DB_NAME" flag:"db-name"`
+	ConnectTimeout         time.Duration `yaml:"connectTimeout" toml:"connectTimeout" env:"MONGO_CONNECT_TIMEOUT"`
+	ServerSelectionTimeout time.Duration `yaml:"serverSelectionTimeout" toml:"serverSelectionTimeout" env:"MONGO_SERVER_SELECTION_TIMEOUT"`
+	MaxPoolSize            uint64        `yaml:"maxPoolSize" toml:"maxPoolSize" env:"MONGO_MAX_POOL_SIZE"`
+	// off when migrations run as a separate deploy step (`migrate up`)
+	MigrateOnStart   bool          `yaml:"migrateOnStart" toml:"migrateOnStart" env:"MONGO_MIGRATE_ON_START"`
+	MigrationTimeout time.Duration `yaml:"migrationTimeout" toml:"migrationTimeout" env:"MONGO_MIGRATION_TIMEOUT"`
+}
+
+type AuthConfig struct {
+	JWTSecret string `yaml:"jwtSecret" toml:"jwtSecret" env:"JWT_SECRET"`
+	// JWT_EXPIRE is the access token lifetime, e.g. 1h
+	AccessTokenTTL       time.Duration `yaml:"accessTokenTtl" toml:"accessTokenTtl" env:"JWT_EXPIRE"`
+	RefreshTokenTTL      time.Duration `yaml:"refreshTokenTtl" toml:"refreshTokenTtl" env:"REFRESH_TOKEN_TTL"`
+	MFAChallengeTTL      time.Duration `yaml:"mfaChallengeTtl" toml:"mfaChallengeTtl" env:"MFA_CHALLENGE_TTL"`
+	InviteTokenTTL       time.Duration `yaml:"inviteTokenTtl" toml:"inviteTokenTtl" env:"INVITE_TOKEN_TTL"`
+	PasswordResetTTL     time.Duration `yaml:"passwordResetTtl" toml:"passwordResetTtl" env:"PASSWORD_RESET_TTL"`
+	EmailVerificationTTL time.Duration `yaml:"emailVerificationTtl" toml:"emailVerificationTtl" env:"EMAIL_VERIFICATION_TTL"`
+	// how long a revocation lookup is cached before asking the database again
+	RevocationCacheTTL time.Duration `yaml:"revocationCacheTtl" toml:"revocationCacheTtl" env:"REVOCATION_CACHE_TTL"`
 }
 
-var AppConfig *Config
+type MailConfig struct {
+	// "smtp" delivers through SMTP and is required in production; "log"
+	// (bodies go to the log) and "file" (writes .eml files into Dir) deliver
+	// nothing and are for development and QA only
+	Driver string `yaml:"driver" toml:"driver" env:"MAIL_DRIVER" flag:"mail-driver"`
+	Dir    string `yaml:"dir" toml:"dir" env:"MAIL_DIR"`
+	// sender address of every email
+	From string     `yaml:"from" toml:"from" env:"MAIL_FROM"`
+	SMTP SMTPConfig `yaml:"smtp" toml:"smtp"`
+}
 
-// getting the env key
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+type SMTPConfig struct {
+	Host string `yaml:"host" toml:"host" env:"SMTP_HOST"`
+	Port string `yaml:"port" toml:"port" env:"SMTP_PORT"`
+	// leave both empty for a relay that does not authenticate
+	Username string        `yaml:"username" toml:"username" env:"SMTP_USERNAME"`
+	Password string        `yaml:"password" toml:"password" env:"SMTP_PASSWORD"`
+	Timeout  time.Duration `yaml:"timeout" toml:"timeout" env:"SMTP_TIMEOUT"`
+}
+
+type LogConfig struct {
+	// "json" or "text"
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" flag:"log-format"`
+	// debug, info, warn or error
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level"`
+}
+
+const (
+	Development = "development"
+	Test        = "test"
+	Production  = "production"
+)
+
+const (
+	StorageMongo  = "mongo"
+	StorageMemory = "memory"
+)
+
+// Default is the configuration before any file, env var or flag is applied
+func Default() *Config {
+	return &Config{
+		Env:     Development,
+		Storage: StorageMongo,
+		Server: ServerConfig{
+			Port:            "8080",
+			AdminPort:       "9090",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Mongo: MongoConfig{
+			ConnectTimeout:         10 * time.Second,
+			ServerSelectionTimeout: 15 * time.Second,
+			MigrateOnStart:         true,
+			MigrationTimeout:       5 * time.Minute,
+			MaxPoolSize:            100,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:       time.Hour,
+			RefreshTokenTTL:      7 * 24 * time.Hour,
+			MFAChallengeTTL:      5 * time.Minute,
+			InviteTokenTTL:       72 * time.Hour,
+			PasswordResetTTL:     time.Hour,
+			EmailVerificationTTL: 48 * time.Hour,
+			RevocationCacheTTL:   30 * time.Second,
+		},
+		Mail: MailConfig{
+			Driver: "log",
+			Dir:    "mail",
+			SMTP: SMTPConfig{
+				Port:    "587",
+				Timeout: 30 * time.Second,
+			},
+		},
+		Log: LogConfig{
+			Format: "json",
+			Level:  "info",
+		},
 	}
-	return fallback
 }
 
-func init() {
-	//load env file
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch c.Env {
+	case Development, Test, Production:
+	default:
+		fail("env must be one of %s, %s or %s, got %q", Development, Test, Production, c.Env)
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		fail("server.port must be a port number, got %q", c.Server.Port)
+	}
+	if port, err := strconv.Atoi(c.Server.AdminPort); err != nil || port < 1 || port > 65535 {
+		fail("server.adminPort must be a port number, got %q", c.Server.AdminPort)
+	} else if c.Server.AdminPort == c.Server.Port {
+		fail("server.adminPort must differ from server.port, metrics are not public")
+	}
+	if _, err := utils.ParseTrustedProxies(c.Server.TrustedProxies); err != nil {
+		fail("server.trustedProxies: %v", err)
+	}
+	if c.Server.AppURL != "" {
+		if u, err := url.Parse(c.Server.AppURL); err != nil || u.Scheme == "" || u.Host == "" {
+			fail("server.appUrl must be an absolute URL, got %q", c.Server.AppURL)
+		}
+	}
 
-	fmt.Println("Loading .env file...")
-	if err := godotenv.Load(".env"); err != nil {
-		log.Fatal("Error loading .env file")
+	switch c.Storage {
+	case StorageMongo:
+		if c.Mongo.URI == "" {
+			fail("mongo.uri (MONGO_URI) is required")
+		}
+		if c.Mongo.Database == "" {
+			fail("mongo.database (DB_NAME) is required")
+		}
+	case StorageMemory:
+		if c.Env == Production {
+			fail("storage must be %s in production", StorageMongo)
+		}
+	default:
+		fail("storage must be %s or %s, got %q", StorageMongo, StorageMemory, c.Storage)
+	}
+	if c.Mongo.MaxPoolSize == 0 {
+		fail("mongo.maxPoolSize must be at least 1")
 	}
 
-	AppConfig = &Config{
-		Port:       getEnv("PORT", "8080"),
-		Mongo_URI:  getEnv("MONGO_URI", ""),
-		JWT_SECRET: getEnv("JWT_SECRET", ""),
-		JWT_EXPIRE: getEnv("JWT_EXPIRE", ""),
-		DB_NAME:    getEnv("DB_NAME", ""),
+	switch {
+	case c.Auth.JWTSecret == "":
+		fail("auth.jwtSecret (JWT_SECRET) is required")
+	case c.Env == Production && len(c.Auth.JWTSecret) < 32:
+		fail("auth.jwtSecret must be at least 32 bytes in production")
 	}
 
-	if AppConfig.Mongo_URI == "" {
-		log.Fatal("MONGO_URI is required but not set")
+	durations := map[string]time.Duration{
+		"server.readTimeout":           c.Server.ReadTimeout,
+		"server.writeTimeout":          c.Server.WriteTimeout,
+		"server.idleTimeout":           c.Server.IdleTimeout,
+		"server.shutdownTimeout":       c.Server.ShutdownTimeout,
+		"mongo.connectTimeout":         c.Mongo.ConnectTimeout,
+		"mongo.serverSelectionTimeout": c.Mongo.ServerSelectionTimeout,
+		"mongo.migrationTimeout":       c.Mongo.MigrationTimeout,
+		"auth.accessTokenTtl":          c.Auth.AccessTokenTTL,
+		"auth.refreshTokenTtl":         c.Auth.RefreshTokenTTL,
+		"auth.mfaChallengeTtl":         c.Auth.MFAChallengeTTL,
+		"auth.inviteTokenTtl":          c.Auth.InviteTokenTTL,
+		"auth.passwordResetTtl":        c.Auth.PasswordResetTTL,
+		"auth.emailVerificationTtl":    c.Auth.EmailVerificationTTL,
+		"auth.revocationCacheTtl":      c.Auth.RevocationCacheTTL,
+	}
+	for _, name := range sortedKeys(durations) {
+		if durations[name] <= 0 {
+			fail("%s must be a positive duration", name)
+		}
 	}
-	if AppConfig.JWT_SECRET == "" {
-		log.Fatal("JWT_SECRET is required but not set")
+	if c.Auth.RefreshTokenTTL > 0 && c.Auth.RefreshTokenTTL < c.Auth.AccessTokenTTL {
+		fail("auth.refreshTokenTtl must not be shorter than auth.accessTokenTtl")
 	}
-	if AppConfig.JWT_EXPIRE == "" {
-		log.Fatal("JWT_EXPIRE is required but not set")
+
+	switch c.Mail.Driver {
+	case "smtp":
+		if c.Mail.SMTP.Host == "" {
+			fail("mail.smtp.host (SMTP_HOST) is required for the smtp driver")
+		}
+		if port, err := strconv.Atoi(c.Mail.SMTP.Port); err != nil || port < 1 || port > 65535 {
+			fail("mail.smtp.port must be a port number, got %q", c.Mail.SMTP.Port)
+		}
+		if (c.Mail.SMTP.Username == "") != (c.Mail.SMTP.Password == "") {
+			fail("mail.smtp.username and mail.smtp.password must be set together")
+		}
+		if c.Mail.SMTP.Timeout <= 0 {
+			fail("mail.smtp.timeout must be a positive duration")
+		}
+		if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+			fail("mail.from (MAIL_FROM) must be an email address, got %q", c.Mail.From)
+		}
+	case "log", "file":
+		// neither delivers anything, so users could never reset a password,
+		// verify their email or answer an invite
+		if c.Env == Production {
+			fail("mail.driver must be smtp in production, %s delivers no email", c.Mail.Driver)
+		}
+	default:
+		fail("mail.driver must be smtp, log or file, got %q", c.Mail.Driver)
+	}
+
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		fail("log.format must be json or text, got %q", c.Log.Format)
 	}
-	if AppConfig.DB_NAME == "" {
-		log.Fatal("DB_NAME is required but not set")
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		fail("log.level must be debug, info, warn or error, got %q", c.Log.Level)
 	}
 
+	return errors.Join(errs...)
 }
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// files looked for in the working directory when no --config is given
+var defaultFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
+// Load builds the configuration from, in increasing priority: the defaults,
+// the config file (--config or CONFIG_FILE, optional), the profile file for
+// the environment (e.g. config.production.yaml, optional), environment
+// variables and command line flags in args. A .env file, if present, only
+// fills in variables the environment does not already set.
+func Load(args []string) (*Config, error) {
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read .env: %w", err)
+	}
+
+	cfg := Default()
+
+	fs := flag.NewFlagSet("medic-server", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	flags := bindFlags(fs, reflect.ValueOf(cfg).Elem())
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	// a mistyped command, e.g. "migrat up", must not start the server
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	// the profile decides which file to read, so an override from the
+	// environment or flags is resolved before any file is loaded
+	profile, _ := os.LookupEnv("APP_ENV")
+	if value, ok := flags["env"]; ok && value.set {
+		profile = value.value
+	}
+
+	path := *configFile
+	if path == "" {
+		path = findDefaultFile()
+	}
+	if path != "" {
+		if err := loadFile(path, cfg, true); err != nil {
+			return nil, err
+		}
+		if profile == "" {
+			profile = cfg.Env
+		}
+		if err := loadFile(profilePath(path, profile), cfg, false); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	errs = append(errs, applyEnv(reflect.ValueOf(cfg).Elem())...)
+	errs = append(errs, applyFlags(reflect.ValueOf(cfg).Elem(), flags)...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if cfg.Server.AppURL == "" {
+		cfg.Server.AppURL = "http://localhost:" + cfg.Server.Port
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+func findDefaultFile() string {
+	for _, name := range defaultFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// profilePath turns config.yaml into config.<env>.yaml
+func profilePath(path string, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// loadFile decodes a YAML or TOML file over cfg, chosen by extension
+func loadFile(path string, cfg *Config, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("could not parse %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("could not parse %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("could not parse %s: unknown keys %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// applyEnv sets every field with an env tag whose variable is set
+func applyEnv(v reflect.Value) []error {
+	var errs []error
+	walkFields(v, func(field reflect.Value, sf reflect.StructField) {
+		name := sf.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			if err := setField(field, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	})
+	return errs
+}
+
+type flagValue struct {
+	value string
+	set   bool
+}
+
+func (f *flagValue) String() string { return f.value }
+
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	f.set = true
+	return nil
+}
+
+// bindFlags registers a flag for every field with a flag tag; values are
+// parsed after the files and environment have been applied
+func bindFlags(fs *flag.FlagSet, v reflect.Value) map[string]*flagValue {
+	flags := make(map[string]*flagValue)
+	walkFields(v, func(field reflect.Value, sf reflect.StructField) {
+		name := sf.Tag.Get("flag")
+		if name == "" {
+			return
+		}
+		value := &flagValue{}
+		flags[name] = value
+		usage := "overrides " + sf.Name
+		if env := sf.Tag.Get("env"); env != "" {
+			usage += " (env " + env + ")"
+		}
+		fs.Var(value, name, usage)
+	})
+	return flags
+}
+
+func applyFlags(v reflect.Value, flags map[string]*flagValue) []error {
+	var errs []error
+	walkFields(v, func(field reflect.Value, sf reflect.StructField) {
+		name := sf.Tag.Get("flag")
+		if value, ok := flags[name]; ok && value.set {
+			if err := setField(field, value.value); err != nil {
+				errs = append(errs, fmt.Errorf("--%s: %w", name, err))
+			}
+		}
+	})
+	return errs
+}
+
+// walkFields calls fn for every leaf field, descending into nested structs
+func walkFields(v reflect.Value, fn func(field reflect.Value, sf reflect.StructField)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkFields(field, fn)
+			continue
+		}
+		fn(field, t.Field(i))
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration like 15s, got %q", value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be a positive number, got %q", value)
+		}
+		field.SetUint(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]time.Duration) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/config"
+	"github/Chidi-creator/go-medic-server/internal/handlers"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
+	"github/Chidi-creator/go-medic-server/internal/middleware"
+	"github/Chidi-creator/go-medic-server/internal/routes"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/usecases"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Dependencies are the parts of the application that live outside the
+// process. Repositories is required; the rest fall back to what the
+// configuration asks for when nil.
+type Dependencies struct {
+	Repositories Repositories
+	Mailer       services.Mailer
+	RateLimits   services.RateLimitStore
+	// checked by /readyz
+	HealthChecks []services.DependencyCheck
+}
+
+// App is the fully wired server
+type App struct {
+	Config      *config.Config
+	Tokens      *services.TokenService
+	Revocations *services.RevocationChecker
+	Router      *routes.Router
+	// checks every request body against its DTO's validate tags
+	Validator *utils.Validator
+	// internal endpoints served on cfg.Server.AdminPort, never publicly
+	Admin *http.ServeMux
+
+	// background loops started by Run
+	workers []func(ctx context.Context)
+}
+
+// New wires the usecases, handlers and routes on top of deps
+func New(cfg *config.Config, deps Dependencies) (*App, error) {
+	repos := deps.Repositories
+
+	a := &App{Config: cfg}
+
+	//token revocation list consulted on every authenticated request
+	a.Revocations = services.NewRevocationChecker(repos.Revocations, cfg.Auth.RevocationCacheTTL, cfg.Auth.AccessTokenTTL)
+	a.workers = append(a.workers, func(ctx context.Context) {
+		a.Revocations.Run(ctx, time.Minute)
+	})
+
+	a.Tokens = services.NewTokenService(services.TokenConfig{
+		Secret:             []byte(cfg.Auth.JWTSecret),
+		AccessTokenExpiry:  cfg.Auth.AccessTokenTTL,
+		RefreshTokenExpiry: cfg.Auth.RefreshTokenTTL,
+		MFAChallengeExpiry: cfg.Auth.MFAChallengeTTL,
+		InviteTokenExpiry:  cfg.Auth.InviteTokenTTL,
+	}, a.Revocations)
+
+	limiter := deps.RateLimits
+	if limiter == nil {
+		//per instance token buckets for the rate limiting middleware
+		memory := services.NewMemoryRateLimitStore()
+		a.workers = append(a.workers, func(ctx context.Context) {
+			memory.Run(ctx, time.Minute)
+		})
+		limiter = memory
+	}
+
+	mailer := deps.Mailer
+	if mailer == nil {
+		var err error
+		mailer, err = services.NewMailer(cfg.Mail.Driver, cfg.Mail.Dir, services.SMTPConfig{
+			Host:     cfg.Mail.SMTP.Host,
+			Port:     cfg.Mail.SMTP.Port,
+			Username: cfg.Mail.SMTP.Username,
+			Password: cfg.Mail.SMTP.Password,
+			From:     cfg.Mail.From,
+			Timeout:  cfg.Mail.SMTP.Timeout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not set up mailer: %w", err)
+		}
+	}
+
+	//initialising usecases
+	accountUsecase := usecases.NewAccountUsecase(repos.Users, repos.UserTokens, repos.Sessions, a.Revocations, mailer, usecases.AccountConfig{
+		AppURL:                       cfg.Server.AppURL,
+		PasswordResetTokenExpiry:     cfg.Auth.PasswordResetTTL,
+		EmailVerificationTokenExpiry: cfg.Auth.EmailVerificationTTL,
+	})
+	userUsecase := usecases.NewUserUsecase(repos.Users, accountUsecase)
+	doctorUsecase := usecases.NewDoctorUseCase(repos.Doctors, repos.Availability, repos.Appointments)
+	hospitalUsecase := usecases.NewHospitalUseCase(repos.Hospitals)
+	appointmentUsecase := usecases.NewAppointmentUsecase(repos.Appointments, repos.Doctors, repos.Hospitals, repos.Users)
+	inviteUsecase := usecases.NewDoctorInviteUsecase(repos.Invites, repos.Doctors, repos.Hospitals, repos.Users, a.Tokens, mailer, cfg.Server.AppURL)
+	mfaUsecase := usecases.NewMFAUsecase(repos.Users, repos.Sessions, a.Revocations)
+	authUsecase := usecases.NewAuthUsecase(repos.Users, repos.Sessions, repos.LoginAttempts, mfaUsecase, a.Revocations, a.Tokens)
+
+	//initializing handlers
+	a.Validator = utils.NewValidator()
+	// list cursors are signed with a key derived from the JWT secret
+	cursors := utils.NewCursors([]byte(cfg.Auth.JWTSecret))
+	userHandler := handlers.NewUserHandler(userUsecase, a.Validator)
+	doctorHandler := handlers.NewDoctorHandler(doctorUsecase, hospitalUsecase, a.Validator, cursors)
+	hospitalHandler := handlers.NewHospitalHandler(hospitalUsecase, userUsecase, a.Validator, cursors)
+	appointmentHandler := handlers.NewAppointmentHandler(appointmentUsecase, a.Validator, cursors)
+	authHandler := handlers.NewAuthHandler(authUsecase, accountUsecase, mfaUsecase, a.Validator)
+	inviteHandler := handlers.NewDoctorInviteHandler(inviteUsecase, a.Validator)
+	healthHandler := handlers.NewHealthHandler(services.NewHealthChecker(2*time.Second, deps.HealthChecks...))
+
+	authorizer := middleware.NewAuthorizer(userUsecase, hospitalUsecase, doctorUsecase, appointmentUsecase)
+
+	proxies, err := utils.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	a.Router = routes.NewRouter(userHandler, doctorHandler, hospitalHandler, appointmentHandler, authHandler, inviteHandler, healthHandler, authorizer, limiter, a.Tokens, proxies)
+	a.Router.SetUpRoutes()
+
+	a.Admin = http.NewServeMux()
+	a.Admin.Handle("GET /metrics", metrics.Handler())
+
+	return a, nil
+}
+
+// Handler is the root http handler, e.g. for httptest.NewServer
+func (a *App) Handler() http.Handler {
+	return a.Router.R
+}
+
+// AdminHandler serves the internal endpoints, such as /metrics
+func (a *App) AdminHandler() http.Handler {
+	return a.Admin
+}
+
+// StartWorkers runs the background loops until ctx is cancelled; the returned
+// function blocks until they have all returned
+func (a *App) StartWorkers(ctx context.Context) (wait func()) {
+	var wg sync.WaitGroup
+	for _, worker := range a.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker(ctx)
+		}()
+	}
+	return wg.Wait
+}
+
+// Run serves http, the admin listener and the background workers until ctx is
+// cancelled or a listener fails, then drains in-flight requests and stops the
+// workers within cfg.Server.ShutdownTimeout
+func (a *App) Run(ctx context.Context) error {
+	cfg := a.Config
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           a.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	adminSrv := &http.Server{
+		Addr:              ":" + cfg.Server.AdminPort,
+		Handler:           a.AdminHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	//background workers run until shutdown cancels workerCtx
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	waitWorkers := a.StartWorkers(workerCtx)
+
+	serverErr := make(chan error, 2)
+	go func() {
+		slog.Info("Server started", "port", cfg.Server.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+	go func() {
+		slog.Info("Admin server started", "port", cfg.Server.AdminPort)
+		if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("admin server: %w", err)
+		}
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutdown signal received, draining requests...")
+	case runErr = <-serverErr:
+		slog.Error("Server failed", "error", runErr)
+	}
+
+	//one deadline covers the whole shutdown so a stuck step cannot hang the deploy
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	//stop accepting connections and let in-flight requests finish first, they
+	//may still need the workers and the database
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Could not drain all requests", "error", err)
+	}
+	if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Could not stop the admin server", "error", err)
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		waitWorkers()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		slog.Warn("Background workers did not stop before the deadline")
+	}
+
+	return runErr
+}
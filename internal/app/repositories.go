@@ -0,0 +1,73 @@
+package app
+
+import (
+	"fmt"
+	schema "github/Chidi-creator/go-medic-server/internal/mongo"
+	"github/Chidi-creator/go-medic-server/internal/repositories"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// collection names in the Mongo database
+const (
+	userCollection         = "users"
+	hospitalCollection     = "hospitals"
+	doctorCollection       = "doctors"
+	appointmentCollection  = "appointments"
+	availabilityCollection = "doctor_availability"
+	inviteCollection       = "doctor_invites"
+	sessionCollection      = "refresh_sessions"
+	revocationCollection   = "revoked_tokens"
+	userTokenCollection    = "user_tokens"
+	loginAttemptCollection = "login_attempts"
+)
+
+// Repositories is every store the application reads and writes
+type Repositories struct {
+	Users         repositories.UserRepository
+	Doctors       repositories.DoctorRepository
+	Hospitals     repositories.HospitalRepository
+	Appointments  repositories.AppointmentRepository
+	Availability  repositories.AvailabilityRepository
+	Invites       repositories.InviteRepository
+	Sessions      repositories.SessionRepository
+	Revocations   repositories.RevocationRepository
+	UserTokens    repositories.UserTokenRepository
+	LoginAttempts repositories.LoginAttemptRepository
+}
+
+// NewMongoRepositories builds every repository on the given database
+func NewMongoRepositories(client *mongo.Client, dbName string) Repositories {
+	return newRepositories(repositories.NewMongoDatabase(client, dbName))
+}
+
+// NewMemoryRepositories builds the same repositories on an in-memory database
+// that starts empty and is lost when the process exits. It gets the indexes
+// the migrations would create, so unique and TTL indexes behave as in Mongo.
+func NewMemoryRepositories() Repositories {
+	db := repositories.NewMemoryDatabase()
+	for _, migration := range schema.Migrations {
+		for collection, indexes := range migration.Indexes {
+			if err := db.CreateIndexes(collection, indexes); err != nil {
+				// the migrations are fixed at build time, so this is a bug
+				panic(fmt.Sprintf("migration %d: %v", migration.Version, err))
+			}
+		}
+	}
+	return newRepositories(db)
+}
+
+func newRepositories(db repositories.Database) Repositories {
+	return Repositories{
+		Users:         repositories.NewUserRepository(db, userCollection),
+		Doctors:       repositories.NewDoctorRepository(db, doctorCollection),
+		Hospitals:     repositories.NewHospitalRepository(db, hospitalCollection),
+		Appointments:  repositories.NewAppointmentRepository(db, appointmentCollection),
+		Availability:  repositories.NewAvailabilityRepository(db, availabilityCollection),
+		Invites:       repositories.NewInviteRepository(db, inviteCollection),
+		Sessions:      repositories.NewSessionRepository(db, sessionCollection),
+		Revocations:   repositories.NewRevocationRepository(db, revocationCollection),
+		UserTokens:    repositories.NewUserTokenRepository(db, userTokenCollection),
+		LoginAttempts: repositories.NewLoginAttemptRepository(db, loginAttemptCollection),
+	}
+}
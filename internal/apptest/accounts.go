@@ -0,0 +1,192 @@
+package apptest
+
+import (
+	"context"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/usecases"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password is the password of every account the harness creates
+const Password = "apptest-password"
+
+// subjects of the emails tests read tokens from
+const (
+	PasswordResetSubject     = "Reset your Medic password"
+	EmailVerificationSubject = "Verify your Medic email address"
+	DoctorInviteSubject      = "You have been invited to join a hospital on Medic"
+)
+
+var accountSeq atomic.Int64
+
+// Email returns an address no other account in the test binary uses
+func Email(prefix string) string {
+	return fmt.Sprintf("%s%d@example.com", prefix, accountSeq.Add(1))
+}
+
+// NextSecond waits for the wall clock to reach the next whole second. Token
+// issue times have second precision and revoking all of a user's sessions
+// only covers earlier seconds, so tests revoking tokens they just issued wait
+// first.
+func NextSecond() {
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+}
+
+// Account is a user with a client logged in as them
+type Account struct {
+	*Client
+	ID           string
+	Email        string
+	Password     string
+	RefreshToken string
+
+	// set once MFA is enabled; each TOTP step can only be used once, so codes
+	// come from the next unused step and then from the recovery codes
+	MFASecret     string
+	RecoveryCodes []string
+	lastStep      int64
+}
+
+// Register signs a customer up through POST /users and logs them in
+func (s *Server) Register(t testing.TB) *Account {
+	t.Helper()
+
+	email := Email("customer")
+	var user models.User
+	s.Client(t).Post("/users", map[string]interface{}{
+		"firstname": "Ada",
+		"lastname":  "Lovelace",
+		"email":     email,
+		"password":  Password,
+	}).Expect(t, http.StatusCreated).Data(t, &user)
+
+	a := &Account{Client: s.Client(t), ID: user.ID.Hex(), Email: email, Password: Password}
+	a.Login(t)
+	return a
+}
+
+// VerifyEmail follows the verification link the account was sent at sign up
+func (s *Server) VerifyEmail(t testing.TB, a *Account) {
+	t.Helper()
+	token := s.Mail.Token(t, a.Email, EmailVerificationSubject)
+	s.Client(t).Post("/auth/verify-email", map[string]string{"token": token}).Expect(t, http.StatusOK)
+}
+
+// Seed inserts a verified user with the given roles straight into the user
+// repository and logs them in, enabling MFA first when a role requires it.
+// Staff accounts are seeded rather than registered because in production
+// they never sign themselves up.
+func (s *Server) Seed(t testing.TB, roles ...utils.Roles) *Account {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("could not hash password: %v", err)
+	}
+
+	email := Email(string(roles[0]))
+	now := time.Now()
+	user, err := s.Repos.Users.RegisterUser(context.Background(), &models.User{
+		Firstname:       "Grace",
+		LastName:        "Hopper",
+		Email:           email,
+		Password:        string(hash),
+		Roles:           roles,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	})
+	if err != nil {
+		t.Fatalf("could not seed user: %v", err)
+	}
+
+	a := &Account{Client: s.Client(t), ID: user.ID.Hex(), Email: email, Password: Password}
+	a.Login(t)
+	if utils.IsRoleValid(utils.MFARequiredRoles, roles) {
+		a.EnableMFA(t)
+	}
+	return a
+}
+
+// Login logs in with the account's password, answering the MFA challenge
+// when there is one, and keeps the new tokens
+func (a *Account) Login(t testing.TB) {
+	t.Helper()
+
+	var result usecases.LoginResult
+	a.Client.Post("/auth/login", map[string]string{
+		"email":    a.Email,
+		"password": a.Password,
+	}).Expect(t, http.StatusOK).Data(t, &result)
+
+	if result.MFARequired {
+		challenge := result.MFAToken
+		result = usecases.LoginResult{}
+		a.Client.Post("/auth/mfa/verify", map[string]string{
+			"mfaToken": challenge,
+			"code":     a.MFACode(t),
+		}).Expect(t, http.StatusOK).Data(t, &result)
+	}
+	a.useTokens(t, &result)
+}
+
+func (a *Account) useTokens(t testing.TB, result *usecases.LoginResult) {
+	t.Helper()
+	if result.AuthTokens == nil || result.AccessToken == "" {
+		t.Fatalf("login for %s returned no tokens", a.Email)
+	}
+	a.Token = result.AccessToken
+	a.RefreshToken = result.RefreshToken
+}
+
+// EnableMFA enrols and confirms TOTP through the API and logs in again, so
+// the account's tokens carry the MFA claim staff routes need
+func (a *Account) EnableMFA(t testing.TB) {
+	t.Helper()
+
+	var enrollment usecases.MFAEnrollment
+	a.Post("/auth/mfa/enroll", nil).Expect(t, http.StatusOK).Data(t, &enrollment)
+	a.MFASecret = enrollment.Secret
+
+	var codes usecases.MFARecoveryCodes
+	a.Post("/auth/mfa/confirm", map[string]string{"code": a.MFACode(t)}).Expect(t, http.StatusOK).Data(t, &codes)
+	a.RecoveryCodes = codes.RecoveryCodes
+
+	a.Login(t)
+}
+
+// MFACode is a code the server will accept next: a TOTP code from a step not
+// used yet, or a recovery code once the steps within the allowed clock skew
+// have run out
+func (a *Account) MFACode(t testing.TB) string {
+	t.Helper()
+	if a.MFASecret == "" {
+		t.Fatalf("%s has no MFA secret", a.Email)
+	}
+
+	now := time.Now()
+	current := services.TOTPStep(now)
+	step := max(current, a.lastStep+1)
+	if step <= current+1 {
+		code, err := services.TOTPCode(a.MFASecret, now.Add(time.Duration(step-current)*services.TOTPPeriod))
+		if err != nil {
+			t.Fatalf("could not generate TOTP code: %v", err)
+		}
+		a.lastStep = step
+		return code
+	}
+
+	if len(a.RecoveryCodes) == 0 {
+		t.Fatalf("%s has used every TOTP step and recovery code", a.Email)
+	}
+	code := a.RecoveryCodes[0]
+	a.RecoveryCodes = a.RecoveryCodes[1:]
+	return code
+}
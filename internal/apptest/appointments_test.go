@@ -0,0 +1,257 @@
+package apptest_test
+
+import (
+	"context"
+	"github/Chidi-creator/go-medic-server/internal/apptest"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// clinic is a hospital with one doctor who has claimed their profile
+type clinic struct {
+	owner    *apptest.Account
+	doctor   *apptest.Account
+	hospital models.Hospital
+	profile  models.Doctor
+}
+
+func newClinic(t *testing.T, srv *apptest.Server) clinic {
+	t.Helper()
+	owner, hospital := newHospitalOwner(t, srv)
+	profile := createDoctor(t, owner, hospital.ID.Hex())
+	return clinic{
+		owner:    owner,
+		doctor:   newDoctorUser(t, srv, owner, profile.ID.Hex()),
+		hospital: hospital,
+		profile:  profile,
+	}
+}
+
+func (c clinic) book(t *testing.T, patient *apptest.Account, start time.Time) models.Appointment {
+	t.Helper()
+	var appointment models.Appointment
+	patient.Post("/appointments", c.booking(start)).Expect(t, http.StatusCreated).Data(t, &appointment)
+	return appointment
+}
+
+func (c clinic) booking(start time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"doctorId":   c.profile.ID.Hex(),
+		"hospitalId": c.hospital.ID.Hex(),
+		"reason":     "Annual check-up and cleaning",
+		"startTime":  start,
+		"endTime":    start.Add(30 * time.Minute),
+	}
+}
+
+func testAppointments(t *testing.T, s *suite) {
+	srv := s.server(t)
+
+	t.Run("book", func(t *testing.T) {
+		c := newClinic(t, srv)
+		patient := srv.Register(t)
+
+		appointment := c.book(t, patient, tomorrow(10))
+		if appointment.Status != utils.BOOKED || appointment.UserID.Hex() != patient.ID {
+			t.Fatalf("unexpected appointment %+v", appointment)
+		}
+
+		// the doctor is busy for any overlapping window
+		srv.Register(t).Post("/appointments", c.booking(tomorrow(10).Add(15*time.Minute))).
+			ExpectProblem(t, http.StatusConflict, "appointment_conflict")
+		patient.Post("/appointments", c.booking(time.Now().Add(-time.Hour))).
+			ExpectProblem(t, http.StatusBadRequest, "invalid_appointment_window")
+		patient.Post("/appointments", map[string]string{"reason": "x"}).
+			ExpectProblem(t, http.StatusBadRequest, "validation_failed")
+		srv.Client(t).Post("/appointments", c.booking(tomorrow(12))).ExpectProblem(t, http.StatusUnauthorized, "")
+	})
+
+	t.Run("book checks the doctor and hospital", func(t *testing.T) {
+		c := newClinic(t, srv)
+		patient := srv.Register(t)
+
+		phantom := c.booking(tomorrow(12))
+		phantom["doctorId"] = primitive.NewObjectID().Hex()
+		patient.Post("/appointments", phantom).ExpectProblem(t, http.StatusNotFound, "doctor_not_found")
+
+		_, elsewhere := newHospitalOwner(t, srv)
+		misfiled := c.booking(tomorrow(12))
+		misfiled["hospitalId"] = elsewhere.ID.Hex()
+		patient.Post("/appointments", misfiled).ExpectProblem(t, http.StatusBadRequest, "doctor_hospital_mismatch")
+
+		// the hospital can be left out and comes from the doctor
+		implied := c.booking(tomorrow(12))
+		delete(implied, "hospitalId")
+		var appointment models.Appointment
+		patient.Post("/appointments", implied).Expect(t, http.StatusCreated).Data(t, &appointment)
+		if appointment.HospitalID != c.hospital.ID {
+			t.Errorf("expected the doctor's hospital, got %s", appointment.HospitalID.Hex())
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		c := newClinic(t, srv)
+		patient := srv.Register(t)
+		appointment := c.book(t, patient, tomorrow(11))
+		path := "/appointments/" + appointment.ID.Hex()
+
+		for _, participant := range []*apptest.Account{patient, c.doctor, c.owner, srv.Seed(t, utils.ADMIN)} {
+			var got models.Appointment
+			participant.Get(path).Expect(t, http.StatusOK).Data(t, &got)
+			if got.ID != appointment.ID {
+				t.Errorf("expected %s, got %s", appointment.ID.Hex(), got.ID.Hex())
+			}
+		}
+		srv.Register(t).Get(path).ExpectProblem(t, http.StatusForbidden, "")
+		patient.Get("/appointments/000000000000000000000000").ExpectProblem(t, http.StatusNotFound, "")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		c := newClinic(t, srv)
+		patient := srv.Register(t)
+		c.book(t, patient, tomorrow(9))
+		c.book(t, patient, tomorrow(13))
+
+		var mine []models.Appointment
+		resp := patient.Get("/appointments/user/"+patient.ID+"?limit=1&sort=startTime").Expect(t, http.StatusOK)
+		resp.Data(t, &mine)
+		if len(mine) != 1 || !mine[0].StartTime.Equal(tomorrow(9)) || !resp.Page(t).HasMore {
+			t.Fatalf("expected the earliest appointment first, got %+v", mine)
+		}
+		srv.Register(t).Get("/appointments/user/"+patient.ID).ExpectProblem(t, http.StatusForbidden, "")
+
+		var doctors []models.Appointment
+		c.doctor.Get("/appointments/doctor/"+c.profile.ID.Hex()+"?status=booked").Expect(t, http.StatusOK).Data(t, &doctors)
+		if len(doctors) != 2 {
+			t.Errorf("expected both bookings for the doctor, got %d", len(doctors))
+		}
+		patient.Get("/appointments/doctor/"+c.profile.ID.Hex()).ExpectProblem(t, http.StatusForbidden, "")
+
+		// every appointment is for admins only
+		patient.Get("/appointments").ExpectProblem(t, http.StatusForbidden, "")
+		var all []models.Appointment
+		srv.Seed(t, utils.ADMIN).Get("/appointments?hospitalId="+c.hospital.ID.Hex()).Expect(t, http.StatusOK).Data(t, &all)
+		if len(all) != 2 {
+			t.Errorf("expected 2 appointments at the hospital, got %d", len(all))
+		}
+		patient.Get("/appointments/user/"+patient.ID+"?status=nonsense&cursor=bogus").ExpectProblem(t, http.StatusBadRequest, "")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		c := newClinic(t, srv)
+		patient := srv.Register(t)
+		appointment := c.book(t, patient, tomorrow(14))
+		path := "/appointments/" + appointment.ID.Hex()
+
+		var updated models.Appointment
+		patient.Patch(path, map[string]string{"reason": "Follow-up on the filling"}).Expect(t, http.StatusOK).Data(t, &updated)
+		if updated.Reason != "Follow-up on the filling" {
+			t.Errorf("expected the new reason, got %q", updated.Reason)
+		}
+
+		// the schedule and status have their own flows
+		patient.Patch(path, map[string]interface{}{"status": utils.COMPLETED}).ExpectProblem(t, http.StatusBadRequest, "")
+		srv.Register(t).Patch(path, map[string]string{"reason": "Not my appointment"}).ExpectProblem(t, http.StatusForbidden, "")
+	})
+
+	t.Run("lifecycle", func(t *testing.T) {
+		c := newClinic(t, srv)
+		patient := srv.Register(t)
+		appointment := c.book(t, patient, tomorrow(15))
+		path := "/appointments/" + appointment.ID.Hex()
+
+		// patients cannot move their own appointment along
+		patient.Post(path+"/check-in", nil).ExpectProblem(t, http.StatusForbidden, "status_transition_forbidden")
+		patient.Post(path+"/start", nil).ExpectProblem(t, http.StatusForbidden, "status_transition_forbidden")
+
+		c.owner.Post(path+"/check-in", nil).Expect(t, http.StatusOK)
+		c.owner.Post(path+"/start", nil).ExpectProblem(t, http.StatusForbidden, "status_transition_forbidden")
+		c.doctor.Post(path+"/start", nil).Expect(t, http.StatusOK)
+		c.doctor.Post(path+"/check-in", nil).ExpectProblem(t, http.StatusConflict, "invalid_status_transition")
+
+		var done models.Appointment
+		c.doctor.Post(path+"/complete", map[string]string{"reason": "Filling replaced"}).Expect(t, http.StatusOK).Data(t, &done)
+		if done.Status != utils.COMPLETED {
+			t.Fatalf("expected %s, got %s", utils.COMPLETED, done.Status)
+		}
+		var trail []utils.Status
+		for _, change := range done.History {
+			trail = append(trail, change.To)
+		}
+		want := []utils.Status{utils.BOOKED, utils.CHECKED_IN, utils.IN_PROGRESS, utils.COMPLETED}
+		if len(trail) != len(want) {
+			t.Fatalf("expected history %v, got %v", want, trail)
+		}
+		for i := range want {
+			if trail[i] != want[i] {
+				t.Fatalf("expected history %v, got %v", want, trail)
+			}
+		}
+
+		patient.Post(path+"/cancel", nil).ExpectProblem(t, http.StatusConflict, "invalid_status_transition")
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		c := newClinic(t, srv)
+		patient := srv.Register(t)
+		appointment := c.book(t, patient, tomorrow(16))
+		path := "/appointments/" + appointment.ID.Hex()
+
+		patient.Post(path+"/cancel", map[string]string{"reason": "Feeling better"}).Expect(t, http.StatusOK)
+		patient.Post(path+"/cancel", nil).ExpectProblem(t, http.StatusConflict, "invalid_status_transition")
+
+		// the slot is free again
+		c.book(t, srv.Register(t), tomorrow(16))
+	})
+
+	t.Run("no-show", func(t *testing.T) {
+		c := newClinic(t, srv)
+		patient := srv.Register(t)
+
+		future := c.book(t, patient, tomorrow(8))
+		c.owner.Post("/appointments/"+future.ID.Hex()+"/no-show", nil).
+			ExpectProblem(t, http.StatusConflict, "invalid_status_transition")
+
+		// bookings in the past cannot be made over HTTP, so seed one
+		start := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Minute)
+		patientId, _ := primitive.ObjectIDFromHex(patient.ID)
+		past, err := srv.Repos.Appointments.CreateAppointment(context.Background(), &models.Appointment{
+			HospitalID: c.hospital.ID,
+			UserID:     patientId,
+			DoctorID:   c.profile.ID,
+			Status:     utils.BOOKED,
+			Reason:     "Missed appointment",
+			StartTime:  start,
+			EndTime:    start.Add(30 * time.Minute),
+			History:    []models.StatusChange{{To: utils.BOOKED, ActorID: patientId, At: start}},
+		})
+		if err != nil {
+			t.Fatalf("could not seed appointment: %v", err)
+		}
+
+		path := "/appointments/" + past.ID.Hex() + "/no-show"
+		patient.Post(path, nil).ExpectProblem(t, http.StatusForbidden, "status_transition_forbidden")
+		c.doctor.Post(path, nil).Expect(t, http.StatusOK)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		c := newClinic(t, srv)
+		patient := srv.Register(t)
+		appointment := c.book(t, patient, tomorrow(17))
+		path := "/appointments/" + appointment.ID.Hex()
+
+		// participants cancel, which keeps the history; only admins delete
+		for _, participant := range []*apptest.Account{srv.Register(t), patient, c.doctor, c.owner} {
+			participant.Delete(path).ExpectProblem(t, http.StatusForbidden, "forbidden_role")
+		}
+		admin := srv.Seed(t, utils.ADMIN)
+		admin.Delete(path).Expect(t, http.StatusOK)
+		patient.Get(path).ExpectProblem(t, http.StatusNotFound, "appointment_not_found")
+		admin.Delete(path).ExpectProblem(t, http.StatusNotFound, "appointment_not_found")
+	})
+}
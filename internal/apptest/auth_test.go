@@ -0,0 +1,278 @@
+package apptest_test
+
+import (
+	"github/Chidi-creator/go-medic-server/internal/apptest"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/usecases"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+	"testing"
+)
+
+func testAuth(t *testing.T, s *suite) {
+	srv := s.server(t)
+
+	t.Run("login", func(t *testing.T) {
+		user := srv.Register(t)
+
+		var result usecases.LoginResult
+		srv.Client(t).Post("/auth/login", map[string]string{"email": user.Email, "password": user.Password}).
+			Expect(t, http.StatusOK).Data(t, &result)
+		if result.AuthTokens == nil || result.AccessToken == "" || result.RefreshToken == "" || result.TokenType != "Bearer" {
+			t.Fatalf("expected a token pair, got %+v", result)
+		}
+		if result.User == nil || result.User.Password != "" {
+			t.Errorf("login must return the user without the password hash")
+		}
+
+		srv.Client(t).Post("/auth/login", map[string]string{"email": user.Email, "password": "wrong-password"}).
+			ExpectProblem(t, http.StatusUnauthorized, "invalid_credentials")
+		srv.Client(t).Post("/auth/login", map[string]string{"email": apptest.Email("nobody"), "password": "wrong-password"}).
+			ExpectProblem(t, http.StatusUnauthorized, "invalid_credentials")
+	})
+
+	t.Run("protected routes need a valid token", func(t *testing.T) {
+		user := srv.Register(t)
+		client := srv.Client(t)
+
+		client.Get("/users/"+user.ID).ExpectProblem(t, http.StatusUnauthorized, "")
+		client.Token = "not-a-token"
+		client.Get("/users/"+user.ID).ExpectProblem(t, http.StatusUnauthorized, "invalid_access_token")
+		// a refresh token is not an access token
+		client.Token = user.RefreshToken
+		client.Get("/users/"+user.ID).ExpectProblem(t, http.StatusUnauthorized, "invalid_access_token")
+	})
+
+	t.Run("refresh rotates and detects reuse", func(t *testing.T) {
+		user := srv.Register(t)
+		first := user.RefreshToken
+
+		var tokens usecases.AuthTokens
+		srv.Client(t).Post("/auth/refresh", map[string]string{"refreshToken": first}).
+			Expect(t, http.StatusOK).Data(t, &tokens)
+		if tokens.RefreshToken == "" || tokens.RefreshToken == first {
+			t.Fatalf("expected a new refresh token")
+		}
+
+		// replaying the rotated token revokes the whole family
+		srv.Client(t).Post("/auth/refresh", map[string]string{"refreshToken": first}).
+			ExpectProblem(t, http.StatusUnauthorized, "refresh_token_reused")
+		srv.Client(t).Post("/auth/refresh", map[string]string{"refreshToken": tokens.RefreshToken}).
+			ExpectProblem(t, http.StatusUnauthorized, "")
+
+		srv.Client(t).Post("/auth/refresh", map[string]string{}).ExpectProblem(t, http.StatusBadRequest, "validation_failed")
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		user := srv.Register(t)
+
+		user.Post("/auth/logout", map[string]string{"refreshToken": user.RefreshToken}).Expect(t, http.StatusOK)
+		user.Get("/users/"+user.ID).ExpectProblem(t, http.StatusUnauthorized, "token_revoked")
+		srv.Client(t).Post("/auth/refresh", map[string]string{"refreshToken": user.RefreshToken}).
+			ExpectProblem(t, http.StatusUnauthorized, "")
+	})
+
+	t.Run("forgot and reset password", func(t *testing.T) {
+		user := srv.Register(t)
+
+		srv.Client(t).Post("/auth/forgot-password", map[string]string{"email": user.Email}).Expect(t, http.StatusAccepted)
+		// unknown addresses get the same answer so accounts cannot be enumerated
+		srv.Client(t).Post("/auth/forgot-password", map[string]string{"email": apptest.Email("nobody")}).Expect(t, http.StatusAccepted)
+
+		token := srv.Mail.Token(t, user.Email, apptest.PasswordResetSubject)
+		apptest.NextSecond()
+		srv.Client(t).Post("/auth/reset-password", map[string]string{"token": token, "password": "a-new-password"}).
+			Expect(t, http.StatusOK)
+		srv.Client(t).Post("/auth/reset-password", map[string]string{"token": token, "password": "another-password"}).
+			ExpectProblem(t, http.StatusBadRequest, "invalid_token")
+
+		// the old password and the old sessions are gone
+		user.Get("/users/"+user.ID).ExpectProblem(t, http.StatusUnauthorized, "")
+		srv.Client(t).Post("/auth/login", map[string]string{"email": user.Email, "password": apptest.Password}).
+			ExpectProblem(t, http.StatusUnauthorized, "invalid_credentials")
+		user.Password = "a-new-password"
+		user.Login(t)
+		user.Get("/users/"+user.ID).Expect(t, http.StatusOK)
+	})
+
+	t.Run("verify email", func(t *testing.T) {
+		user := srv.Register(t)
+
+		user.Post("/auth/verify-email/resend", nil).Expect(t, http.StatusAccepted)
+		if n := len(srv.Mail.Messages(user.Email)); n != 2 {
+			t.Fatalf("expected the sign up and the resent verification email, got %d", n)
+		}
+
+		token := srv.Mail.Token(t, user.Email, apptest.EmailVerificationSubject)
+		srv.Client(t).Post("/auth/verify-email", map[string]string{"token": token}).Expect(t, http.StatusOK)
+		srv.Client(t).Post("/auth/verify-email", map[string]string{"token": token}).
+			ExpectProblem(t, http.StatusBadRequest, "invalid_token")
+
+		var got models.User
+		user.Get("/users/"+user.ID).Expect(t, http.StatusOK).Data(t, &got)
+		if !got.EmailVerified {
+			t.Errorf("expected the email to be verified")
+		}
+	})
+
+	t.Run("admin revokes sessions", func(t *testing.T) {
+		user := srv.Register(t)
+		admin := srv.Seed(t, utils.ADMIN)
+
+		user.Post("/auth/users/"+user.ID+"/revoke-sessions", nil).ExpectProblem(t, http.StatusForbidden, "")
+		apptest.NextSecond()
+		admin.Post("/auth/users/"+user.ID+"/revoke-sessions", nil).Expect(t, http.StatusOK)
+		admin.Post("/auth/users/not-an-id/revoke-sessions", nil).ExpectProblem(t, http.StatusNotFound, "user_not_found")
+		admin.Post("/auth/users/000000000000000000000000/revoke-sessions", nil).ExpectProblem(t, http.StatusNotFound, "user_not_found")
+
+		user.Get("/users/"+user.ID).ExpectProblem(t, http.StatusUnauthorized, "token_revoked")
+		srv.Client(t).Post("/auth/refresh", map[string]string{"refreshToken": user.RefreshToken}).
+			ExpectProblem(t, http.StatusUnauthorized, "")
+
+		// a session started in the same second as the revocation is a new one
+		user.Login(t)
+		user.Get("/users/"+user.ID).Expect(t, http.StatusOK)
+	})
+
+	t.Run("lockout behind a proxy is per client", func(t *testing.T) {
+		cfg := apptest.Config()
+		cfg.Server.TrustedProxies = "127.0.0.1, ::1"
+		proxied := apptest.New(t, apptest.Options{Repositories: s.backend.Open(t), Config: cfg, Coverage: s.coverage})
+		user := proxied.Register(t)
+
+		attacker := proxied.Client(t)
+		attacker.Header = http.Header{"X-Forwarded-For": {"203.0.113.7"}}
+		// a spoofed hop left of the proxy's own entry changes nothing
+		spoofed := proxied.Client(t)
+		spoofed.Header = http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7"}}
+
+		for i := 0; i < 21; i++ {
+			wrong := map[string]string{"email": apptest.Email("nobody"), "password": "wrong-password"}
+			attacker.Post("/auth/login", wrong).ExpectProblem(t, http.StatusUnauthorized, "invalid_credentials")
+		}
+		login := map[string]string{"email": user.Email, "password": user.Password}
+		attacker.Post("/auth/login", login).ExpectProblem(t, http.StatusTooManyRequests, "too_many_login_attempts")
+		spoofed.Post("/auth/login", login).ExpectProblem(t, http.StatusTooManyRequests, "too_many_login_attempts")
+
+		// everyone else behind the same proxy is unaffected
+		neighbour := proxied.Client(t)
+		neighbour.Header = http.Header{"X-Forwarded-For": {"203.0.113.8"}}
+		neighbour.Post("/auth/login", login).Expect(t, http.StatusOK)
+	})
+
+	t.Run("rate limits behind a proxy are per client", func(t *testing.T) {
+		cfg := apptest.Config()
+		cfg.Server.TrustedProxies = "127.0.0.1, ::1"
+		proxied := apptest.New(t, apptest.Options{
+			Repositories: s.backend.Open(t),
+			Config:       cfg,
+			Coverage:     s.coverage,
+			RateLimits:   services.NewMemoryRateLimitStore(),
+		})
+
+		first := proxied.Client(t)
+		first.Header = http.Header{"X-Forwarded-For": {"203.0.113.7"}}
+		// a new address each time so the account lockout stays out of the way
+		wrong := func() map[string]string {
+			return map[string]string{"email": apptest.Email("nobody"), "password": "wrong-password"}
+		}
+		for i := 0; i < 10; i++ {
+			first.Post("/auth/login", wrong()).ExpectProblem(t, http.StatusUnauthorized, "invalid_credentials")
+		}
+		// password hashing is slow under -race, so the bucket may have
+		// refilled a token or two by now
+		res := first.Post("/auth/login", wrong())
+		for i := 0; i < 3 && res.StatusCode == http.StatusUnauthorized; i++ {
+			res = first.Post("/auth/login", wrong())
+		}
+		res.ExpectProblem(t, http.StatusTooManyRequests, "rate_limited")
+
+		second := proxied.Client(t)
+		second.Header = http.Header{"X-Forwarded-For": {"203.0.113.8"}}
+		second.Post("/auth/login", wrong()).ExpectProblem(t, http.StatusUnauthorized, "invalid_credentials")
+	})
+
+	t.Run("lockout and admin unlock", func(t *testing.T) {
+		user := srv.Register(t)
+		admin := srv.Seed(t, utils.ADMIN)
+
+		// five free failures, then the sixth locks the account
+		wrong := map[string]string{"email": user.Email, "password": "wrong-password"}
+		for i := 0; i < 6; i++ {
+			srv.Client(t).Post("/auth/login", wrong).ExpectProblem(t, http.StatusUnauthorized, "invalid_credentials")
+		}
+		srv.Client(t).Post("/auth/login", map[string]string{"email": user.Email, "password": user.Password}).
+			ExpectProblem(t, http.StatusTooManyRequests, "too_many_login_attempts")
+
+		user.Post("/auth/users/"+user.ID+"/unlock", nil).ExpectProblem(t, http.StatusForbidden, "")
+		admin.Post("/auth/users/"+user.ID+"/unlock", nil).Expect(t, http.StatusOK)
+		user.Login(t)
+	})
+}
+
+func testMFA(t *testing.T, s *suite) {
+	srv := s.server(t)
+
+	t.Run("enrol, confirm and log in", func(t *testing.T) {
+		user := srv.Register(t)
+
+		user.Post("/auth/mfa/confirm", map[string]string{"code": "123456"}).ExpectProblem(t, http.StatusConflict, "mfa_not_enrolled")
+		user.EnableMFA(t)
+		if len(user.RecoveryCodes) == 0 {
+			t.Fatalf("confirming MFA must hand out recovery codes")
+		}
+		user.Post("/auth/mfa/enroll", nil).ExpectProblem(t, http.StatusConflict, "mfa_already_enabled")
+
+		var challenge usecases.LoginResult
+		srv.Client(t).Post("/auth/login", map[string]string{"email": user.Email, "password": user.Password}).
+			Expect(t, http.StatusOK).Data(t, &challenge)
+		if !challenge.MFARequired || challenge.MFAToken == "" || challenge.AuthTokens != nil {
+			t.Fatalf("expected an MFA challenge instead of tokens, got %+v", challenge)
+		}
+
+		srv.Client(t).Post("/auth/mfa/verify", map[string]string{"mfaToken": challenge.MFAToken, "code": "000000"}).
+			ExpectProblem(t, http.StatusUnauthorized, "invalid_mfa_code")
+		srv.Client(t).Post("/auth/mfa/verify", map[string]string{"mfaToken": "not-a-token", "code": user.MFACode(t)}).
+			ExpectProblem(t, http.StatusUnauthorized, "invalid_mfa_token")
+
+		// recovery codes work once each
+		code := user.RecoveryCodes[0]
+		user.RecoveryCodes = user.RecoveryCodes[1:]
+		srv.Client(t).Post("/auth/mfa/verify", map[string]string{"mfaToken": challenge.MFAToken, "code": code}).
+			Expect(t, http.StatusOK)
+		srv.Client(t).Post("/auth/mfa/verify", map[string]string{"mfaToken": challenge.MFAToken, "code": code}).
+			ExpectProblem(t, http.StatusUnauthorized, "invalid_mfa_code")
+	})
+
+	t.Run("staff need MFA", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+
+		owner.Patch("/hospitals/"+hospital.ID.Hex(), map[string]string{"name": "Renamed"}).Expect(t, http.StatusOK)
+
+		// disabling MFA ends every session, since their tokens still claim it
+		apptest.NextSecond()
+		owner.Post("/auth/mfa/disable", map[string]string{"code": owner.MFACode(t)}).Expect(t, http.StatusOK)
+		owner.Get("/hospitals/"+hospital.ID.Hex()).ExpectProblem(t, http.StatusUnauthorized, "token_revoked")
+		srv.Client(t).Post("/auth/refresh", map[string]string{"refreshToken": owner.RefreshToken}).
+			ExpectProblem(t, http.StatusUnauthorized, "")
+
+		// without a second factor the same owner is turned away
+		owner.Login(t)
+		owner.Patch("/hospitals/"+hospital.ID.Hex(), map[string]string{"name": "Renamed again"}).
+			ExpectProblem(t, http.StatusForbidden, "mfa_required")
+		// routes that only need a login are covered too
+		owner.Get("/hospitals/"+hospital.ID.Hex()).ExpectProblem(t, http.StatusForbidden, "mfa_required")
+		owner.Post("/appointments", map[string]string{}).ExpectProblem(t, http.StatusForbidden, "mfa_required")
+		owner.Post("/auth/mfa/disable", map[string]string{"code": "123456"}).ExpectProblem(t, http.StatusForbidden, "mfa_required")
+
+		// enrolling and logging out stay open
+		owner.Post("/auth/mfa/enroll", nil).Expect(t, http.StatusOK)
+		owner.Post("/auth/logout", map[string]string{"refreshToken": owner.RefreshToken}).Expect(t, http.StatusOK)
+	})
+
+	t.Run("disable needs MFA enabled", func(t *testing.T) {
+		user := srv.Register(t)
+		user.Post("/auth/mfa/disable", map[string]string{"code": "123456"}).ExpectProblem(t, http.StatusConflict, "mfa_not_enabled")
+	})
+}
@@ -0,0 +1,82 @@
+package apptest
+
+import (
+	"context"
+	"github/Chidi-creator/go-medic-server/config"
+	"github/Chidi-creator/go-medic-server/internal/app"
+	"github/Chidi-creator/go-medic-server/internal/mongo"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MongoURIEnv names the variable pointing the Mongo backend at a server.
+// Bookings use transactions, so it must be a replica set; a single node will
+// do, e.g. after `mongod --replSet rs0` and `mongosh --eval 'rs.initiate()'`:
+// MONGO_TEST_URI=mongodb://localhost:27017/?replicaSet=rs0
+const MongoURIEnv = "MONGO_TEST_URI"
+
+// Backend builds a fresh, empty set of repositories for each test
+type Backend struct {
+	Name string
+	Open func(t testing.TB) app.Repositories
+	// Skip is why the backend cannot run here, empty when it can
+	Skip string
+}
+
+// Backends is every storage backend the application supports. Mongo is
+// skipped unless MONGO_TEST_URI is set.
+func Backends() []Backend {
+	backends := []Backend{{
+		Name: config.StorageMemory,
+		Open: func(t testing.TB) app.Repositories {
+			return app.NewMemoryRepositories()
+		},
+	}}
+
+	mongoBackend := Backend{Name: config.StorageMongo, Open: openMongo}
+	if os.Getenv(MongoURIEnv) == "" {
+		mongoBackend.Skip = MongoURIEnv + " is not set"
+	}
+	return append(backends, mongoBackend)
+}
+
+// openMongo connects to a database of its own, dropped when the test ends
+func openMongo(t testing.TB) app.Repositories {
+	t.Helper()
+
+	cfg := config.Default().Mongo
+	cfg.URI = os.Getenv(MongoURIEnv)
+	cfg.ConnectTimeout = 5 * time.Second
+	cfg.ServerSelectionTimeout = 5 * time.Second
+
+	client, err := mongo.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to %s: %v", MongoURIEnv, err)
+	}
+
+	dbName := "medic_test_" + primitive.NewObjectID().Hex()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := client.Client.Database(dbName).Drop(ctx); err != nil {
+			t.Errorf("could not drop %s: %v", dbName, err)
+		}
+		if err := client.Disconnect(ctx); err != nil {
+			t.Errorf("could not disconnect: %v", err)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := client.CheckTransactions(ctx); err != nil {
+		t.Fatalf("%s: %v", MongoURIEnv, err)
+	}
+	if _, err := client.Migrate(ctx, dbName); err != nil {
+		t.Fatalf("could not migrate %s: %v", dbName, err)
+	}
+
+	return app.NewMongoRepositories(client.Client, dbName)
+}
@@ -0,0 +1,167 @@
+package apptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"github/Chidi-creator/go-medic-server/internal/managers"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// Client sends requests to a test server, authenticated once Token is set
+type Client struct {
+	t       testing.TB
+	baseURL string
+	http    *http.Client
+
+	// bearer access token sent with every request, when set
+	Token string
+	// extra headers sent with every request, e.g. X-Forwarded-For
+	Header http.Header
+}
+
+// Response is a fully read response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// envelope is utils.ApiResponse with the data left undecoded
+type envelope struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Page    *utils.PageInfo `json:"page"`
+}
+
+// Do sends a request; body is sent as is when it is a string and as JSON
+// otherwise, and no body is sent when it is nil
+func (c *Client) Do(method string, path string, body interface{}) *Response {
+	c.t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			c.t.Fatalf("could not encode %s %s body: %v", method, path, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		c.t.Fatalf("could not build %s %s: %v", method, path, err)
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("could not read %s %s response: %v", method, path, err)
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: data}
+}
+
+func (c *Client) Get(path string) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodGet, path, nil)
+}
+
+func (c *Client) Post(path string, body interface{}) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodPost, path, body)
+}
+
+func (c *Client) Put(path string, body interface{}) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodPut, path, body)
+}
+
+func (c *Client) Patch(path string, body interface{}) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodPatch, path, body)
+}
+
+func (c *Client) Delete(path string) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodDelete, path, nil)
+}
+
+// Expect fails the test unless the response has the given status
+func (r *Response) Expect(t testing.TB, status int) *Response {
+	t.Helper()
+	if r.StatusCode != status {
+		t.Fatalf("expected status %d, got %d: %s", status, r.StatusCode, r.Body)
+	}
+	return r
+}
+
+// ExpectProblem fails the test unless the response is a problem document
+// with the given status and, when code is not empty, the given code
+func (r *Response) ExpectProblem(t testing.TB, status int, code string) managers.Problem {
+	t.Helper()
+	r.Expect(t, status)
+
+	var problem managers.Problem
+	if err := json.Unmarshal(r.Body, &problem); err != nil {
+		t.Fatalf("response is not a problem document: %v: %s", err, r.Body)
+	}
+	if code != "" && problem.Code != code {
+		t.Fatalf("expected problem code %q, got %q: %s", code, problem.Code, r.Body)
+	}
+	return problem
+}
+
+// Data decodes the data of a successful response into v
+func (r *Response) Data(t testing.TB, v interface{}) {
+	t.Helper()
+	env := r.envelope(t)
+	if len(env.Data) == 0 {
+		t.Fatalf("response has no data: %s", r.Body)
+	}
+	if err := json.Unmarshal(env.Data, v); err != nil {
+		t.Fatalf("could not decode response data: %v: %s", err, env.Data)
+	}
+}
+
+// Page is the paging info of a list response
+func (r *Response) Page(t testing.TB) *utils.PageInfo {
+	t.Helper()
+	env := r.envelope(t)
+	if env.Page == nil {
+		t.Fatalf("response has no page info: %s", r.Body)
+	}
+	return env.Page
+}
+
+func (r *Response) envelope(t testing.TB) envelope {
+	t.Helper()
+	var env envelope
+	if err := json.Unmarshal(r.Body, &env); err != nil {
+		t.Fatalf("could not decode response: %v: %s", err, r.Body)
+	}
+	if !env.Success {
+		t.Fatalf("response is not successful: %s", r.Body)
+	}
+	return env
+}
@@ -0,0 +1,188 @@
+package apptest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"github/Chidi-creator/go-medic-server/internal/apptest"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	// request logs drown out test failures; -v shows them again
+	if !testing.Verbose() {
+		slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+	os.Exit(m.Run())
+}
+
+// suite is one backend's run of the conformance tests
+type suite struct {
+	backend  apptest.Backend
+	coverage *apptest.Coverage
+}
+
+// server starts an application on empty repositories
+func (s *suite) server(t *testing.T) *apptest.Server {
+	t.Helper()
+	return apptest.New(t, apptest.Options{
+		Repositories: s.backend.Open(t),
+		Coverage:     s.coverage,
+	})
+}
+
+// every route group in routes.SetUpRoutes has a suite here
+var conformance = []struct {
+	name string
+	run  func(t *testing.T, s *suite)
+}{
+	{"probes", testProbes},
+	{"users", testUsers},
+	{"auth", testAuth},
+	{"mfa", testMFA},
+	{"hospitals", testHospitals},
+	{"doctors", testDoctors},
+	{"invites", testInvites},
+	{"appointments", testAppointments},
+}
+
+// TestConformance runs the HTTP API suite against every storage backend, so
+// the emulated database cannot drift from Mongo. Set MONGO_TEST_URI to include
+// Mongo, e.g. against a throwaway single-node replica set; see MongoURIEnv.
+func TestConformance(t *testing.T) {
+	for _, backend := range apptest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			if backend.Skip != "" {
+				t.Skip(backend.Skip)
+			}
+
+			s := &suite{backend: backend, coverage: apptest.NewCoverage()}
+			for _, c := range conformance {
+				t.Run(c.name, func(t *testing.T) {
+					c.run(t, s)
+				})
+			}
+
+			// a filtered run leaves routes out on purpose
+			if t.Failed() || flag.Lookup("test.run").Value.String() != "" {
+				return
+			}
+			if missing := s.coverage.Missing(s.server(t).Router()); len(missing) > 0 {
+				t.Errorf("routes without conformance tests:\n  %s", strings.Join(missing, "\n  "))
+			}
+		})
+	}
+}
+
+func testProbes(t *testing.T, s *suite) {
+	srv := s.server(t)
+	anon := srv.Client(t)
+
+	for _, path := range []string{"/livez", "/readyz", "/healthcheck"} {
+		anon.Get(path).Expect(t, http.StatusOK)
+	}
+
+	// a failing dependency is reported as down without saying why
+	failing := apptest.New(t, apptest.Options{
+		Repositories: s.backend.Open(t),
+		Coverage:     s.coverage,
+		HealthChecks: []services.DependencyCheck{{
+			Name:  "mongo",
+			Check: func(ctx context.Context) error { return errors.New("dial tcp 10.0.0.5:27017: connection refused") },
+		}},
+	})
+	ready := failing.Client(t).Get("/readyz").Expect(t, http.StatusServiceUnavailable)
+	var report services.HealthReport
+	if err := json.Unmarshal(ready.Body, &report); err != nil {
+		t.Fatalf("could not decode readiness report: %v", err)
+	}
+	if report.Dependencies["mongo"].Status != services.StatusDown {
+		t.Errorf("expected mongo to be down, got %s", ready.Body)
+	}
+	if strings.Contains(string(ready.Body), "10.0.0.5") {
+		t.Errorf("readiness must not expose the failure: %s", ready.Body)
+	}
+
+	// metrics are only on the admin listener
+	anon.Get("/metrics").Expect(t, http.StatusNotFound)
+	metrics := srv.AdminClient(t).Get("/metrics").Expect(t, http.StatusOK)
+	if !strings.Contains(string(metrics.Body), "http_requests_total") {
+		t.Errorf("metrics do not include request counts")
+	}
+}
+
+// fixtures shared by the suites
+
+func hospitalBody() map[string]interface{} {
+	return map[string]interface{}{
+		"name": "St. Example",
+		"location": map[string]interface{}{
+			"address": "1 Marina Road, Lagos",
+			"point": map[string]interface{}{
+				"type":        "Point",
+				"coordinates": []float64{3.3792, 6.5244},
+			},
+		},
+		"specialties": []utils.Specialty{utils.DENTIST, utils.GENERAL_PRACTITIONER},
+		"open":        true,
+		"phone":       "+2348012345678",
+		"email":       apptest.Email("hospital"),
+	}
+}
+
+// newHospitalOwner registers a customer who creates a hospital, which makes
+// them its owner, and enables MFA as the owner role requires
+func newHospitalOwner(t *testing.T, srv *apptest.Server) (*apptest.Account, models.Hospital) {
+	t.Helper()
+
+	owner := srv.Register(t)
+	var hospital models.Hospital
+	owner.Post("/hospitals", hospitalBody()).Expect(t, http.StatusCreated).Data(t, &hospital)
+	owner.EnableMFA(t)
+	return owner, hospital
+}
+
+func createDoctor(t *testing.T, owner *apptest.Account, hospitalId string) models.Doctor {
+	t.Helper()
+
+	var doctor models.Doctor
+	owner.Post("/doctors", map[string]interface{}{
+		"firstname":   "Ngozi",
+		"lastname":    "Okafor",
+		"specialties": []utils.Specialty{utils.DENTIST},
+		"hospitalId":  hospitalId,
+	}).Expect(t, http.StatusOK).Data(t, &doctor)
+	return doctor
+}
+
+// newDoctorUser invites a freshly registered, verified user to the doctor
+// profile, accepts with the emailed token and enables MFA for the doctor role
+// it grants
+func newDoctorUser(t *testing.T, srv *apptest.Server, owner *apptest.Account, doctorId string) *apptest.Account {
+	t.Helper()
+
+	user := srv.Register(t)
+	srv.VerifyEmail(t, user)
+	owner.Post("/doctors/"+doctorId+"/invites", map[string]string{"email": user.Email}).Expect(t, http.StatusCreated)
+	token := srv.Mail.Token(t, user.Email, apptest.DoctorInviteSubject)
+	user.Post("/doctors/invites/"+token+"/accept", nil).Expect(t, http.StatusOK)
+	user.EnableMFA(t)
+	return user
+}
+
+// tomorrow is a time on the next day, well clear of the current slot
+func tomorrow(hour int) time.Time {
+	day := time.Now().UTC().AddDate(0, 0, 1)
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.UTC)
+}
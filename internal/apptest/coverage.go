@@ -0,0 +1,62 @@
+package apptest
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// Coverage records which routes a suite exercised, so a route added to
+// SetUpRoutes without a test shows up as missing
+type Coverage struct {
+	mu  sync.Mutex
+	hit map[string]bool
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{hit: map[string]bool{}}
+}
+
+// record wraps handler, noting the route each request matched on router
+func (c *Coverage) record(router *mux.Router, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if tmpl, err := match.Route.GetPathTemplate(); err == nil {
+				c.mu.Lock()
+				c.hit[r.Method+" "+tmpl] = true
+				c.mu.Unlock()
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Missing lists the routes on router no request has matched, as "METHOD /path"
+func (c *Coverage) Missing(router *mux.Router) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var missing []string
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// subrouter prefixes carry no methods of their own
+			return nil
+		}
+		for _, method := range methods {
+			if !c.hit[method+" "+tmpl] {
+				missing = append(missing, method+" "+tmpl)
+			}
+		}
+		return nil
+	})
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,271 @@
+package apptest_test
+
+import (
+	"github/Chidi-creator/go-medic-server/internal/apptest"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// open every day from 09:00 to 17:00 UTC in 30 minute slots
+func availabilityBody() map[string]interface{} {
+	weekly := make([]map[string]interface{}, 7)
+	for day := range weekly {
+		weekly[day] = map[string]interface{}{
+			"weekday": day,
+			"hours":   []map[string]string{{"start": "09:00", "end": "17:00"}},
+		}
+	}
+	return map[string]interface{}{
+		"timezone":    "UTC",
+		"slotMinutes": 30,
+		"weekly":      weekly,
+	}
+}
+
+func testDoctors(t *testing.T, s *suite) {
+	srv := s.server(t)
+
+	t.Run("create", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+
+		doctor := createDoctor(t, owner, hospital.ID.Hex())
+		if doctor.ID.IsZero() || doctor.HospitalID != hospital.ID {
+			t.Fatalf("unexpected doctor %+v", doctor)
+		}
+
+		// only hospital staff, and only at their own hospital
+		body := map[string]interface{}{
+			"firstname":   "Ngozi",
+			"lastname":    "Okafor",
+			"specialties": []utils.Specialty{utils.DENTIST},
+			"hospitalId":  hospital.ID.Hex(),
+		}
+		srv.Register(t).Post("/doctors", body).ExpectProblem(t, http.StatusForbidden, "forbidden_role")
+		other, _ := newHospitalOwner(t, srv)
+		other.Post("/doctors", body).ExpectProblem(t, http.StatusForbidden, "not_hospital_owner")
+		srv.Seed(t, utils.ADMIN).Post("/doctors", body).Expect(t, http.StatusOK)
+		body["hospitalId"] = primitive.NewObjectID().Hex()
+		other.Post("/doctors", body).ExpectProblem(t, http.StatusNotFound, "hospital_not_found")
+	})
+
+	t.Run("get and list by hospital", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		doctor := createDoctor(t, owner, hospital.ID.Hex())
+		createDoctor(t, owner, hospital.ID.Hex())
+		anon := srv.Client(t)
+
+		var got models.Doctor
+		anon.Get("/doctors/"+doctor.ID.Hex()).Expect(t, http.StatusOK).Data(t, &got)
+		if got.ID != doctor.ID {
+			t.Errorf("expected %s, got %s", doctor.ID.Hex(), got.ID.Hex())
+		}
+		anon.Get("/doctors/000000000000000000000000").ExpectProblem(t, http.StatusNotFound, "doctor_not_found")
+
+		var doctors []models.Doctor
+		resp := anon.Get("/doctors/hospital/"+hospital.ID.Hex()+"?limit=1").Expect(t, http.StatusOK)
+		resp.Data(t, &doctors)
+		if len(doctors) != 1 || !resp.Page(t).HasMore {
+			t.Fatalf("expected the first of two pages, got %d doctors", len(doctors))
+		}
+		anon.Get("/doctors/hospital/"+hospital.ID.Hex()+"?limit=1&cursor="+resp.Page(t).NextCursor).
+			Expect(t, http.StatusOK).Data(t, &doctors)
+		if len(doctors) != 1 {
+			t.Fatalf("expected the second doctor, got %d", len(doctors))
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		doctor := createDoctor(t, owner, hospital.ID.Hex())
+		path := "/doctors/" + doctor.ID.Hex()
+
+		owner.Patch(path, map[string]string{"lastname": "Adeyemi"}).Expect(t, http.StatusOK)
+		var got models.Doctor
+		owner.Get(path).Expect(t, http.StatusOK).Data(t, &got)
+		if got.LastName != "Adeyemi" {
+			t.Errorf("expected the new lastname, got %q", got.LastName)
+		}
+
+		owner.Patch(path, map[string]string{"hospitalId": hospital.ID.Hex()}).ExpectProblem(t, http.StatusBadRequest, "")
+		srv.Register(t).Patch(path, map[string]string{"lastname": "Hijacked"}).ExpectProblem(t, http.StatusForbidden, "")
+
+		// a doctor who claimed the profile manages it too
+		doctorUser := newDoctorUser(t, srv, owner, doctor.ID.Hex())
+		doctorUser.Patch(path, map[string]string{"firstname": "Amaka"}).Expect(t, http.StatusOK)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		doctor := createDoctor(t, owner, hospital.ID.Hex())
+		path := "/doctors/" + doctor.ID.Hex()
+
+		// the doctor themselves cannot remove the profile, only the hospital
+		doctorUser := newDoctorUser(t, srv, owner, doctor.ID.Hex())
+		doctorUser.Delete(path).ExpectProblem(t, http.StatusForbidden, "")
+
+		owner.Delete(path).Expect(t, http.StatusOK)
+		srv.Client(t).Get(path).ExpectProblem(t, http.StatusNotFound, "doctor_not_found")
+	})
+
+	t.Run("availability and slots", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		doctor := createDoctor(t, owner, hospital.ID.Hex())
+		path := "/doctors/" + doctor.ID.Hex()
+
+		srv.Register(t).Put(path+"/availability", availabilityBody()).ExpectProblem(t, http.StatusForbidden, "")
+		var saved models.DoctorAvailability
+		owner.Put(path+"/availability", availabilityBody()).Expect(t, http.StatusOK).Data(t, &saved)
+		if saved.HospitalID != hospital.ID {
+			t.Errorf("availability must default to the doctor's hospital")
+		}
+
+		invalid := availabilityBody()
+		invalid["timezone"] = "Mars/Olympus"
+		owner.Put(path+"/availability", invalid).ExpectProblem(t, http.StatusBadRequest, "validation_failed")
+		_, elsewhere := newHospitalOwner(t, srv)
+		foreign := availabilityBody()
+		foreign["hospitalId"] = elsewhere.ID.Hex()
+		owner.Put(path+"/availability", foreign).ExpectProblem(t, http.StatusBadRequest, "invalid_availability")
+
+		anon := srv.Client(t)
+		var schedules []models.DoctorAvailability
+		anon.Get(path+"/availability").Expect(t, http.StatusOK).Data(t, &schedules)
+		if len(schedules) != 1 {
+			t.Fatalf("expected one schedule, got %d", len(schedules))
+		}
+
+		day := tomorrow(0).Format("2006-01-02")
+		next := tomorrow(0).AddDate(0, 0, 1).Format("2006-01-02")
+		var slots []models.Slot
+		anon.Get(path+"/slots?from="+day+"&to="+next).Expect(t, http.StatusOK).Data(t, &slots)
+		// 09:00 to 17:00 in 30 minute slots
+		if len(slots) != 16 {
+			t.Fatalf("expected 16 slots, got %d", len(slots))
+		}
+
+		// a booking takes its slot
+		patient := srv.Register(t)
+		patient.Post("/appointments", map[string]interface{}{
+			"doctorId":   doctor.ID.Hex(),
+			"hospitalId": hospital.ID.Hex(),
+			"reason":     "Toothache on the left side",
+			"startTime":  slots[0].StartTime,
+			"endTime":    slots[0].EndTime,
+		}).Expect(t, http.StatusCreated)
+		anon.Get(path+"/slots?from="+day+"&to="+next).Expect(t, http.StatusOK).Data(t, &slots)
+		if len(slots) != 15 {
+			t.Errorf("expected the booked slot to be gone, got %d slots", len(slots))
+		}
+
+		anon.Get(path+"/slots?from="+next+"&to="+day).ExpectProblem(t, http.StatusBadRequest, "invalid_availability")
+		anon.Get(path+"/slots?from=yesterday&to="+day).ExpectProblem(t, http.StatusBadRequest, "invalid_availability")
+		anon.Get(path+"/slots?from="+day).ExpectProblem(t, http.StatusBadRequest, "invalid_availability")
+	})
+}
+
+func testInvites(t *testing.T, s *suite) {
+	srv := s.server(t)
+
+	// invite returns the token emailed to the invitee; the inviter never sees it
+	invite := func(t *testing.T, owner *apptest.Account, doctorId string, email string) string {
+		t.Helper()
+		resp := owner.Post("/doctors/"+doctorId+"/invites", map[string]string{"email": email}).Expect(t, http.StatusCreated)
+		if strings.Contains(string(resp.Body), "token") {
+			t.Errorf("the invite token must only be sent by email, got %s", resp.Body)
+		}
+		var created models.DoctorInvite
+		resp.Data(t, &created)
+		if created.Email != email || created.Status != utils.PENDING {
+			t.Errorf("unexpected invite %+v", created)
+		}
+		return srv.Mail.Token(t, email, apptest.DoctorInviteSubject)
+	}
+
+	t.Run("view and accept", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		doctor := createDoctor(t, owner, hospital.ID.Hex())
+		user := srv.Register(t)
+
+		token := invite(t, owner, doctor.ID.Hex(), user.Email)
+
+		// the address must be proven before it can claim a doctor profile
+		user.Post("/doctors/invites/"+token+"/accept", nil).ExpectProblem(t, http.StatusForbidden, "email_not_verified")
+		srv.VerifyEmail(t, user)
+
+		var got models.DoctorInvite
+		srv.Client(t).Get("/doctors/invites/"+token).Expect(t, http.StatusOK).Data(t, &got)
+		if got.Status != utils.PENDING || got.DoctorID != doctor.ID {
+			t.Fatalf("unexpected invite %+v", got)
+		}
+
+		// only the invited address can answer
+		srv.Register(t).Post("/doctors/invites/"+token+"/accept", nil).ExpectProblem(t, http.StatusForbidden, "invite_email_mismatch")
+
+		user.Post("/doctors/invites/"+token+"/accept", nil).Expect(t, http.StatusOK)
+		// now a doctor, the user must enrol in MFA before anything else
+		user.Post("/doctors/invites/"+token+"/accept", nil).ExpectProblem(t, http.StatusForbidden, "mfa_required")
+		user.EnableMFA(t)
+		user.Post("/doctors/invites/"+token+"/accept", nil).ExpectProblem(t, http.StatusGone, "invite_invalid")
+
+		var linked models.Doctor
+		srv.Client(t).Get("/doctors/"+doctor.ID.Hex()).Expect(t, http.StatusOK).Data(t, &linked)
+		if linked.UserID == nil || linked.UserID.Hex() != user.ID || linked.InviteStatus != utils.ACCEPTED {
+			t.Errorf("doctor profile must be linked to the user, got %+v", linked)
+		}
+
+		owner.Post("/doctors/"+doctor.ID.Hex()+"/invites", map[string]string{"email": apptest.Email("late")}).
+			ExpectProblem(t, http.StatusConflict, "invite_conflict")
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		doctor := createDoctor(t, owner, hospital.ID.Hex())
+		user := srv.Register(t)
+		srv.VerifyEmail(t, user)
+
+		token := invite(t, owner, doctor.ID.Hex(), user.Email)
+		user.Post("/doctors/invites/"+token+"/reject", nil).Expect(t, http.StatusOK)
+
+		var got models.Doctor
+		srv.Client(t).Get("/doctors/"+doctor.ID.Hex()).Expect(t, http.StatusOK).Data(t, &got)
+		if got.UserID != nil || got.InviteStatus != utils.REJECTED {
+			t.Errorf("rejected invite must leave the profile unclaimed, got %+v", got)
+		}
+	})
+
+	t.Run("resend replaces the token", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		doctor := createDoctor(t, owner, hospital.ID.Hex())
+		user := srv.Register(t)
+		srv.VerifyEmail(t, user)
+
+		first := invite(t, owner, doctor.ID.Hex(), user.Email)
+		var pending models.DoctorInvite
+		srv.Client(t).Get("/doctors/invites/"+first).Expect(t, http.StatusOK).Data(t, &pending)
+
+		srv.Register(t).Post("/doctors/invites/"+pending.ID.Hex()+"/resend", nil).ExpectProblem(t, http.StatusForbidden, "")
+		owner.Post("/doctors/invites/"+pending.ID.Hex()+"/resend", nil).Expect(t, http.StatusOK)
+		resent := srv.Mail.Token(t, user.Email, apptest.DoctorInviteSubject)
+		if resent == first {
+			t.Fatalf("resending must issue a new token")
+		}
+
+		srv.Client(t).Get("/doctors/invites/"+first).ExpectProblem(t, http.StatusGone, "invite_invalid")
+		user.Post("/doctors/invites/"+resent+"/accept", nil).Expect(t, http.StatusOK)
+	})
+
+	t.Run("only the doctor's hospital can invite", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		doctor := createDoctor(t, owner, hospital.ID.Hex())
+		other, _ := newHospitalOwner(t, srv)
+
+		other.Post("/doctors/"+doctor.ID.Hex()+"/invites", map[string]string{"email": apptest.Email("doctor")}).
+			ExpectProblem(t, http.StatusForbidden, "")
+		srv.Client(t).Get("/doctors/invites/not-a-token").ExpectProblem(t, http.StatusGone, "invite_invalid")
+	})
+}
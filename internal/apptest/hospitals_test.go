@@ -0,0 +1,178 @@
+package apptest_test
+
+import (
+	"encoding/base64"
+	"github/Chidi-creator/go-medic-server/internal/apptest"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testHospitals(t *testing.T, s *suite) {
+	srv := s.server(t)
+
+	t.Run("create", func(t *testing.T) {
+		owner := srv.Register(t)
+
+		var hospital models.Hospital
+		owner.Post("/hospitals", hospitalBody()).Expect(t, http.StatusCreated).Data(t, &hospital)
+		if hospital.ID.IsZero() || hospital.UserID.Hex() != owner.ID {
+			t.Fatalf("hospital must belong to its creator, got %+v", hospital)
+		}
+
+		// creating a hospital makes the user its owner, a staff role
+		owner.Get("/users/"+owner.ID).ExpectProblem(t, http.StatusForbidden, "mfa_required")
+		owner.EnableMFA(t)
+		var user models.User
+		owner.Get("/users/"+owner.ID).Expect(t, http.StatusOK).Data(t, &user)
+		if !utils.IsRoleValid([]utils.Roles{utils.HOSPITAL}, user.Roles) {
+			t.Errorf("expected the %s role, got %v", utils.HOSPITAL, user.Roles)
+		}
+
+		body := hospitalBody()
+		body["phone"] = "not-a-phone"
+		srv.Register(t).Post("/hospitals", body).ExpectProblem(t, http.StatusBadRequest, "validation_failed")
+		srv.Client(t).Post("/hospitals", hospitalBody()).ExpectProblem(t, http.StatusUnauthorized, "")
+	})
+
+	t.Run("get and list", func(t *testing.T) {
+		_, hospital := newHospitalOwner(t, srv)
+		_, other := newHospitalOwner(t, srv)
+		reader := srv.Register(t)
+
+		var got models.Hospital
+		reader.Get("/hospitals/"+hospital.ID.Hex()).Expect(t, http.StatusOK).Data(t, &got)
+		if got.Name != hospital.Name {
+			t.Errorf("expected %q, got %q", hospital.Name, got.Name)
+		}
+		reader.Get("/hospitals/000000000000000000000000").ExpectProblem(t, http.StatusNotFound, "")
+		reader.Get("/hospitals/not-an-id").ExpectProblem(t, http.StatusBadRequest, "")
+
+		// one per page, following the cursor to the end
+		seen := map[string]bool{}
+		path := "/hospitals?limit=1"
+		for page := 0; ; page++ {
+			if page > 10 {
+				t.Fatalf("pagination does not end")
+			}
+			var hospitals []models.Hospital
+			resp := reader.Get(path).Expect(t, http.StatusOK)
+			resp.Data(t, &hospitals)
+			for _, h := range hospitals {
+				seen[h.ID.Hex()] = true
+			}
+			info := resp.Page(t)
+			if !info.HasMore {
+				break
+			}
+			path = "/hospitals?limit=1&cursor=" + info.NextCursor
+		}
+		if !seen[hospital.ID.Hex()] || !seen[other.ID.Hex()] {
+			t.Errorf("paging through every hospital missed some: %v", seen)
+		}
+
+		reader.Get("/hospitals?sort=phone").ExpectProblem(t, http.StatusBadRequest, "")
+	})
+
+	t.Run("cursors are signed and bound to their query", func(t *testing.T) {
+		newHospitalOwner(t, srv)
+		newHospitalOwner(t, srv)
+		reader := srv.Register(t)
+
+		cursor := reader.Get("/hospitals?limit=1").Expect(t, http.StatusOK).Page(t).NextCursor
+		if cursor == "" {
+			t.Fatalf("expected a next cursor")
+		}
+		reader.Get("/hospitals?limit=1&cursor="+cursor).Expect(t, http.StatusOK)
+
+		// the same cursor on another sort or filter
+		reader.Get("/hospitals?limit=1&sort=-name&cursor="+cursor).ExpectProblem(t, http.StatusBadRequest, "invalid_cursor")
+		reader.Get("/hospitals?limit=1&open=true&cursor="+cursor).ExpectProblem(t, http.StatusBadRequest, "invalid_cursor")
+
+		// a hand made position, e.g. one smuggling an operator into the filter
+		forged, err := bson.Marshal(bson.M{"s": "name", "d": false, "v": bson.M{"$ne": nil}, "id": primitive.NewObjectID()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload := base64.RawURLEncoding.EncodeToString(forged)
+		_, signature, _ := strings.Cut(cursor, ".")
+		reader.Get("/hospitals?limit=1&cursor="+payload).ExpectProblem(t, http.StatusBadRequest, "invalid_cursor")
+		reader.Get("/hospitals?limit=1&cursor="+payload+"."+signature).ExpectProblem(t, http.StatusBadRequest, "invalid_cursor")
+	})
+
+	t.Run("nearby", func(t *testing.T) {
+		_, hospital := newHospitalOwner(t, srv)
+		reader := srv.Register(t)
+
+		var near []models.NearbyHospital
+		reader.Get("/hospitals/nearby?lng=3.38&lat=6.52&radiusKm=5&specialty=dentist").
+			Expect(t, http.StatusOK).Data(t, &near)
+		found := false
+		for _, h := range near {
+			found = found || h.ID == hospital.ID
+		}
+		if !found {
+			t.Errorf("expected %s within 5km, got %+v", hospital.ID.Hex(), near)
+		}
+
+		// Abuja is several hundred km away
+		var far []models.NearbyHospital
+		reader.Get("/hospitals/nearby?lng=7.49&lat=9.07&radiusKm=5").Expect(t, http.StatusOK).Data(t, &far)
+		for _, h := range far {
+			if h.ID == hospital.ID {
+				t.Errorf("hospital %s should be outside the radius", hospital.ID.Hex())
+			}
+		}
+
+		reader.Get("/hospitals/nearby?lat=6.52").ExpectProblem(t, http.StatusBadRequest, "invalid_query")
+		reader.Get("/hospitals/nearby?lng=3.38&lat=6.52&radiusKm=500").ExpectProblem(t, http.StatusBadRequest, "validation_failed")
+	})
+
+	t.Run("nearby is rate limited per user", func(t *testing.T) {
+		limited := apptest.New(t, apptest.Options{
+			Repositories: s.backend.Open(t),
+			Coverage:     s.coverage,
+			RateLimits:   services.NewMemoryRateLimitStore(),
+		})
+		busy, quiet := limited.Register(t), limited.Register(t)
+
+		const path = "/hospitals/nearby?lng=3.38&lat=6.52"
+		for i := 0; i < 30; i++ {
+			busy.Get(path).Expect(t, http.StatusOK)
+		}
+		busy.Get(path).ExpectProblem(t, http.StatusTooManyRequests, "rate_limited")
+		quiet.Get(path).Expect(t, http.StatusOK)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		path := "/hospitals/" + hospital.ID.Hex()
+
+		var updated models.Hospital
+		owner.Patch(path, map[string]interface{}{"name": "St. Renamed", "description": nil}).
+			Expect(t, http.StatusOK).Data(t, &updated)
+		if updated.Name != "St. Renamed" {
+			t.Errorf("expected the new name, got %q", updated.Name)
+		}
+
+		owner.Patch(path, map[string]interface{}{"userId": owner.ID}).ExpectProblem(t, http.StatusBadRequest, "")
+		srv.Register(t).Patch(path, map[string]string{"name": "Hijacked"}).ExpectProblem(t, http.StatusForbidden, "")
+		srv.Seed(t, utils.ADMIN).Patch(path, map[string]string{"name": "By Admin"}).Expect(t, http.StatusOK)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		owner, hospital := newHospitalOwner(t, srv)
+		path := "/hospitals/" + hospital.ID.Hex()
+
+		srv.Register(t).Delete(path).ExpectProblem(t, http.StatusForbidden, "not_owner")
+		owner.Delete(path).Expect(t, http.StatusOK)
+		owner.Get(path).ExpectProblem(t, http.StatusNotFound, "hospital_not_found")
+		srv.Seed(t, utils.ADMIN).Delete(path).ExpectProblem(t, http.StatusNotFound, "hospital_not_found")
+	})
+}
@@ -0,0 +1,64 @@
+package apptest
+
+import (
+	"context"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// Mailbox is a mailer that keeps every message instead of sending it
+type Mailbox struct {
+	mu       sync.Mutex
+	messages []services.Message
+}
+
+func (m *Mailbox) Send(ctx context.Context, msg services.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages is every message sent to the address, oldest first
+func (m *Mailbox) Messages(to string) []services.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found []services.Message
+	for _, msg := range m.messages {
+		if msg.To == to {
+			found = append(found, msg)
+		}
+	}
+	return found
+}
+
+// links in our emails carry their token as ?token=
+var tokenLink = regexp.MustCompile(`[?&]token=([^\s&]+)`)
+
+// Token is the token in the newest message to the address whose subject is
+// subject, failing the test when there is none
+func (m *Mailbox) Token(t testing.TB, to string, subject string) string {
+	t.Helper()
+
+	messages := m.Messages(to)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Subject != subject {
+			continue
+		}
+		match := tokenLink.FindStringSubmatch(messages[i].Body)
+		if match == nil {
+			t.Fatalf("message %q to %s has no token link", subject, to)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatalf("message %q to %s has a malformed token: %v", subject, to, err)
+		}
+		return token
+	}
+	t.Fatalf("no message %q was sent to %s", subject, to)
+	return ""
+}
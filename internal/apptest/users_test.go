@@ -0,0 +1,142 @@
+package apptest_test
+
+import (
+	"github/Chidi-creator/go-medic-server/internal/apptest"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+	"testing"
+)
+
+func testUsers(t *testing.T, s *suite) {
+	srv := s.server(t)
+
+	t.Run("register", func(t *testing.T) {
+		email := apptest.Email("register")
+		var user models.User
+		srv.Client(t).Post("/users", map[string]interface{}{
+			"firstname": "Chinua",
+			"lastname":  "Achebe",
+			"email":     email,
+			"password":  apptest.Password,
+		}).Expect(t, http.StatusCreated).Data(t, &user)
+
+		if user.ID.IsZero() || user.Email != email {
+			t.Fatalf("unexpected user %+v", user)
+		}
+		if user.EmailVerified {
+			t.Errorf("new users must not start verified")
+		}
+		if len(srv.Mail.Messages(email)) != 1 {
+			t.Errorf("expected one verification email")
+		}
+	})
+
+	t.Run("register never grants staff roles", func(t *testing.T) {
+		for _, role := range []utils.Roles{utils.ADMIN, utils.HOSPITAL} {
+			email := apptest.Email("climber")
+			var user models.User
+			srv.Client(t).Post("/users", map[string]interface{}{
+				"firstname": "Chinua",
+				"lastname":  "Achebe",
+				"email":     email,
+				"password":  apptest.Password,
+				"roles":     []utils.Roles{role},
+			}).Expect(t, http.StatusCreated).Data(t, &user)
+			if len(user.Roles) != 1 || user.Roles[0] != utils.CUSTOMER {
+				t.Fatalf("asking for %s must still make a customer, got %v", role, user.Roles)
+			}
+
+			climber := &apptest.Account{Client: srv.Client(t), ID: user.ID.Hex(), Email: email, Password: apptest.Password}
+			climber.Login(t)
+			climber.Get("/appointments").ExpectProblem(t, http.StatusForbidden, "")
+		}
+	})
+
+	t.Run("the password hash is never returned", func(t *testing.T) {
+		email := apptest.Email("register")
+		var created map[string]interface{}
+		srv.Client(t).Post("/users", map[string]interface{}{
+			"firstname": "Chinua",
+			"lastname":  "Achebe",
+			"email":     email,
+			"password":  apptest.Password,
+		}).Expect(t, http.StatusCreated).Data(t, &created)
+		if _, ok := created["password"]; ok {
+			t.Errorf("register must not return the password: %v", created)
+		}
+
+		user := srv.Register(t)
+		var got map[string]interface{}
+		user.Get("/users/"+user.ID).Expect(t, http.StatusOK).Data(t, &got)
+		if _, ok := got["password"]; ok {
+			t.Errorf("get must not return the password: %v", got)
+		}
+	})
+
+	t.Run("register rejects a taken email", func(t *testing.T) {
+		existing := srv.Register(t)
+		srv.Client(t).Post("/users", map[string]interface{}{
+			"firstname": "Chinua",
+			"lastname":  "Achebe",
+			"email":     existing.Email,
+			"password":  apptest.Password,
+		}).ExpectProblem(t, http.StatusConflict, "email_taken")
+	})
+
+	t.Run("register validates the body", func(t *testing.T) {
+		srv.Client(t).Post("/users", map[string]string{"email": "not-an-email"}).
+			ExpectProblem(t, http.StatusBadRequest, "validation_failed")
+		srv.Client(t).Post("/users", "{").ExpectProblem(t, http.StatusBadRequest, "invalid_body")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		user := srv.Register(t)
+
+		var got models.User
+		user.Get("/users/"+user.ID).Expect(t, http.StatusOK).Data(t, &got)
+		if got.Email != user.Email {
+			t.Errorf("expected %s, got %s", user.Email, got.Email)
+		}
+
+		srv.Client(t).Get("/users/"+user.ID).ExpectProblem(t, http.StatusUnauthorized, "missing_access_token")
+		srv.Register(t).Get("/users/"+user.ID).ExpectProblem(t, http.StatusForbidden, "not_owner")
+	})
+
+	t.Run("admin can read any user", func(t *testing.T) {
+		user := srv.Register(t)
+		admin := srv.Seed(t, utils.ADMIN)
+		admin.Get("/users/"+user.ID).Expect(t, http.StatusOK)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		user := srv.Register(t)
+
+		user.Patch("/users/"+user.ID, map[string]string{"firstname": "Wole"}).Expect(t, http.StatusOK)
+		var got models.User
+		user.Get("/users/"+user.ID).Expect(t, http.StatusOK).Data(t, &got)
+		if got.Firstname != "Wole" {
+			t.Errorf("expected firstname to be updated, got %q", got.Firstname)
+		}
+
+		// roles only change through their own flows
+		user.Patch("/users/"+user.ID, map[string]interface{}{"roles": []utils.Roles{utils.ADMIN}}).
+			ExpectProblem(t, http.StatusBadRequest, "")
+		srv.Register(t).Patch("/users/"+user.ID, map[string]string{"firstname": "Wole"}).
+			ExpectProblem(t, http.StatusForbidden, "")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		user := srv.Register(t)
+		srv.Register(t).Delete("/users/"+user.ID).ExpectProblem(t, http.StatusForbidden, "not_owner")
+
+		user.Delete("/users/"+user.ID).Expect(t, http.StatusNoContent)
+
+		admin := srv.Seed(t, utils.ADMIN)
+		admin.Get("/users/"+user.ID).ExpectProblem(t, http.StatusNotFound, "user_not_found")
+		admin.Delete("/users/"+user.ID).ExpectProblem(t, http.StatusNotFound, "user_not_found")
+
+		// the deleted user's token is still signed, but names nobody
+		user.Get("/users/"+user.ID).ExpectProblem(t, http.StatusUnauthorized, "account_not_found")
+	})
+}
@@ -3,13 +3,14 @@ package handlers
 import (
 	"encoding/json"
 	"github/Chidi-creator/go-medic-server/internal/managers"
+	"github/Chidi-creator/go-medic-server/internal/middleware"
 	"github/Chidi-creator/go-medic-server/internal/models"
 	"github/Chidi-creator/go-medic-server/internal/usecases"
 	"github/Chidi-creator/go-medic-server/internal/utils"
 	"net/http"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AppointmentHandler interface {
@@ -17,43 +18,72 @@ type AppointmentHandler interface {
 	GetSingleAppointmentById(w http.ResponseWriter, r *http.Request)
 	GetAppointmentsByDoctorId(w http.ResponseWriter, r *http.Request)
 	GetAppointmentsByUserId(w http.ResponseWriter, r *http.Request)
+	GetAppointments(w http.ResponseWriter, r *http.Request)
 	UpdateAppointmentById(w http.ResponseWriter, r *http.Request)
+	CheckInAppointment(w http.ResponseWriter, r *http.Request)
+	StartAppointment(w http.ResponseWriter, r *http.Request)
+	CompleteAppointment(w http.ResponseWriter, r *http.Request)
+	CancelAppointment(w http.ResponseWriter, r *http.Request)
+	MarkAppointmentNoShow(w http.ResponseWriter, r *http.Request)
 	DeleteAppointmentById(w http.ResponseWriter, r *http.Request)
 }
 
+// TransitionRequest is the optional body of a status change endpoint
+type TransitionRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
 type appointmentHandler struct {
 	appointmentUsecase usecases.AppointmentUsecase
+	validator          *utils.Validator
+	cursors            *utils.Cursors
 }
 
-func NewAppointmentHandler(au usecases.AppointmentUsecase) AppointmentHandler {
+func NewAppointmentHandler(au usecases.AppointmentUsecase, v *utils.Validator, cursors *utils.Cursors) AppointmentHandler {
 	return &appointmentHandler{
 		appointmentUsecase: au,
+		validator:          v,
+		cursors:            cursors,
 	}
 
 }
 
 func (a *appointmentHandler) CreateAppointment(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	user := middleware.GetUserFromContext(ctx)
+
+	if user == nil {
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
+		return
+	}
 
 	var appointment models.Appointment
 
 	err := json.NewDecoder(r.Body).Decode(&appointment)
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid request body: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+		return
+	}
+
+	// appointments are always booked for the authenticated user
+	userId, err := primitive.ObjectIDFromHex(user.UserID)
+	if err != nil {
+		managers.ErrorResponse(w, r, middleware.ErrInvalidToken)
+		return
+	}
+	appointment.UserID = userId
+
+	validationErrs := a.validator.Struct(appointment)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
 		return
 	}
 
 	newAppointment, err := a.appointmentUsecase.CreateAppointment(ctx, &appointment)
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Internal Server Error: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -72,10 +102,7 @@ func (a *appointmentHandler) GetSingleAppointmentById(w http.ResponseWriter, r *
 
 	appointment, err := a.appointmentUsecase.GetSingleAppointmentById(ctx, id)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not fetch appointment: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -85,42 +112,69 @@ func (a *appointmentHandler) GetSingleAppointmentById(w http.ResponseWriter, r *
 	})
 }
 
-func (a *appointmentHandler) GetAppointmentsByDoctorId(w http.ResponseWriter, r *http.Request){
+func (a *appointmentHandler) GetAppointmentsByDoctorId(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	params := mux.Vars(r)
+
 	id := params["id"]
-	appointments, err := a.appointmentUsecase.GetAppointmentsByDoctorId(ctx, id)
+	page, ok := parsePage(w, r, appointmentListSpec, a.cursors)
+	if !ok {
+		return
+	}
+	appointments, info, err := a.appointmentUsecase.GetAppointmentsByDoctorId(ctx, id, page)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not fetch appointments: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
+	a.cursors.Seal(page, info)
 	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
 		Success: true,
 		Message: "Doctor's Appointments successfully retrieved",
 		Data:    appointments,
+		Page:    info,
 	})
 }
 
-func (a *appointmentHandler) GetAppointmentsByUserId(w http.ResponseWriter, r *http.Request){
+func (a *appointmentHandler) GetAppointmentsByUserId(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	params := mux.Vars(r)
 
 	id := params["id"]
-	appointments, err := a.appointmentUsecase.GetAppointmentsByUserId(ctx, id)
+	page, ok := parsePage(w, r, appointmentListSpec, a.cursors)
+	if !ok {
+		return
+	}
+	appointments, info, err := a.appointmentUsecase.GetAppointmentsByUserId(ctx, id, page)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not fetch appointments: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
+	a.cursors.Seal(page, info)
 	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
 		Success: true,
 		Message: "User's Appointments successfully retrieved",
 		Data:    appointments,
+		Page:    info,
+	})
+}
+
+// GET /appointments lists every appointment, filtered and paged
+func (a *appointmentHandler) GetAppointments(w http.ResponseWriter, r *http.Request) {
+	page, ok := parsePage(w, r, appointmentListSpec, a.cursors)
+	if !ok {
+		return
+	}
+	appointments, info, err := a.appointmentUsecase.GetAppointmentsByQuery(r.Context(), page)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+	a.cursors.Seal(page, info)
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Appointments successfully retrieved",
+		Data:    appointments,
+		Page:    info,
 	})
 }
 
@@ -129,47 +183,86 @@ func (a *appointmentHandler) UpdateAppointmentById(w http.ResponseWriter, r *htt
 	params := mux.Vars(r)
 	id := params["id"]
 
-	var updateData bson.M
-	err := json.NewDecoder(r.Body).Decode(&updateData)
+	var patch models.AppointmentPatch
+	update, err := a.validator.DecodeMergePatch(r.Body, &patch)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid request body: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
-	updatedAppointment, err := a.appointmentUsecase.UpdateAppointmentById(ctx, id, updateData)
+	updatedAppointment, err := a.appointmentUsecase.UpdateAppointmentById(ctx, id, update)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not update appointment: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
 		Success: true,
 		Message: "Appointment updated successfully",
-		Data:   updatedAppointment,
+		Data:    updatedAppointment,
 	})
 }
 
-func (a *appointmentHandler) DeleteAppointmentById(w http.ResponseWriter, r *http.Request) {	
+// POST /appointments/{id}/check-in
+func (a *appointmentHandler) CheckInAppointment(w http.ResponseWriter, r *http.Request) {
+	a.transition(w, r, usecases.CHECK_IN, "Patient checked in")
+}
+
+// POST /appointments/{id}/start
+func (a *appointmentHandler) StartAppointment(w http.ResponseWriter, r *http.Request) {
+	a.transition(w, r, usecases.START, "Appointment started")
+}
+
+// POST /appointments/{id}/complete
+func (a *appointmentHandler) CompleteAppointment(w http.ResponseWriter, r *http.Request) {
+	a.transition(w, r, usecases.COMPLETE, "Appointment completed")
+}
+
+// POST /appointments/{id}/cancel
+func (a *appointmentHandler) CancelAppointment(w http.ResponseWriter, r *http.Request) {
+	a.transition(w, r, usecases.CANCEL, "Appointment cancelled")
+}
+
+// POST /appointments/{id}/no-show
+func (a *appointmentHandler) MarkAppointmentNoShow(w http.ResponseWriter, r *http.Request) {
+	a.transition(w, r, usecases.NO_SHOW, "Appointment marked as no-show")
+}
+
+func (a *appointmentHandler) transition(w http.ResponseWriter, r *http.Request, action usecases.AppointmentAction, message string) {
 	ctx := r.Context()
-	params := mux.Vars(r)
-	id := params["id"]
-	deletedCount, err := a.appointmentUsecase.DeleteAppointmentById(ctx, id)
+	id := mux.Vars(r)["id"]
+	user := middleware.GetUserFromContext(ctx)
+
+	var req TransitionRequest
+	// the body is optional; an empty one just means no reason was given
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+			return
+		}
+	}
+	if validationErrs := a.validator.Struct(req); validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
+		return
+	}
+
+	appointment, err := a.appointmentUsecase.TransitionAppointment(ctx, id, action, user.UserID, req.Reason)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not delete appointment: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
-	if deletedCount == 0 {
-		managers.JSONresponse(w, http.StatusNotFound, utils.ApiResponse{
-			Success: false,
-			Error:   "Appointment not found",
-		})
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    appointment,
+	})
+}
+
+func (a *appointmentHandler) DeleteAppointmentById(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := mux.Vars(r)
+	id := params["id"]
+	if err := a.appointmentUsecase.DeleteAppointmentById(ctx, id); err != nil {
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
@@ -4,21 +4,57 @@ import (
 	"encoding/json"
 	"github/Chidi-creator/go-medic-server/internal/managers"
 	"github/Chidi-creator/go-medic-server/internal/middleware"
-	"github/Chidi-creator/go-medic-server/internal/services"
 	"github/Chidi-creator/go-medic-server/internal/usecases"
 	"github/Chidi-creator/go-medic-server/internal/utils"
 	"net/http"
 
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/gorilla/mux"
 )
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// Code is a TOTP code or, where accepted, a recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfaToken" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
 type AuthHandler struct {
-	uc usecases.UserUseCase
+	au        usecases.AuthUsecase
+	acc       usecases.AccountUsecase
+	mfa       usecases.MFAUsecase
+	validator *utils.Validator
 }
 
-func NewAuthHandler(uc usecases.UserUseCase) *AuthHandler {
+func NewAuthHandler(au usecases.AuthUsecase, acc usecases.AccountUsecase, mfa usecases.MFAUsecase, v *utils.Validator) *AuthHandler {
 	return &AuthHandler{
-		uc: uc,
+		au:        au,
+		acc:       acc,
+		mfa:       mfa,
+		validator: v,
 	}
 }
 
@@ -27,28 +63,28 @@ func (ah *AuthHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 
 	var details utils.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&details); err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "invalid request body: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
 		return
 	}
 
 	// validate request
-	validationErrs := utils.ValidateStruct(details)
-	if validationErrs != "" {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   validationErrs,
-		})
+	validationErrs := ah.validator.Struct(details)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
 		return
 	}
 	// call usecase
-	resp, err := ah.uc.LoginUser(ctx, &details)
+	resp, err := ah.au.LoginUser(ctx, &details, utils.ClientIP(r))
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "could not login user: " + err.Error(),
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	if resp.MFARequired {
+		managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+			Success: true,
+			Message: "Enter the code from your authenticator app to finish logging in",
+			Data:    resp,
 		})
 		return
 	}
@@ -60,37 +96,295 @@ func (ah *AuthHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 	})
 
 }
-func (ah *AuthHandler) GenerateRefreshToken(w http.ResponseWriter, r *http.Request) {
+
+// POST /auth/refresh exchanges a refresh token for a new access/refresh pair
+func (ah *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+		return
+	}
+
+	validationErrs := ah.validator.Struct(req)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
+		return
+	}
+
+	tokens, err := ah.au.RefreshTokens(ctx, req.RefreshToken)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Tokens refreshed successfully",
+		Data:    tokens,
+	})
+}
+
+// POST /auth/logout revokes the caller's access token and optional refresh token
+func (ah *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user := middleware.GetUserFromContext(ctx)
 	if user == nil {
-		managers.JSONresponse(w, http.StatusUnauthorized, utils.ApiResponse{
-			Success: false,
-			Error:   "User not authenticated",
-		})
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
 		return
 	}
 
-	userId, err := primitive.ObjectIDFromHex(user.UserID)
+	// the body is optional; without it only the access token is revoked
+	var req LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+			return
+		}
+	}
+
+	err := ah.au.Logout(ctx, user, req.RefreshToken)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid user ID",
-		})
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Logged out successfully",
+	})
+}
+
+// POST /auth/users/{id}/revoke-sessions (admin only)
+func (ah *AuthHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	if err := ah.au.RevokeAllSessions(ctx, id); err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "All sessions revoked for user",
+	})
+}
+
+// POST /auth/users/{id}/unlock (admin only) lifts a login lockout
+func (ah *AuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	if err := ah.au.UnlockUser(ctx, id); err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "User unlocked",
+	})
+}
+
+// POST /auth/forgot-password always answers the same way, whether or not the email is registered
+func (ah *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+		return
+	}
+
+	validationErrs := ah.validator.Struct(req)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
+		return
+	}
+
+	if err := ah.acc.RequestPasswordReset(ctx, req.Email); err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusAccepted, utils.ApiResponse{
+		Success: true,
+		Message: "If an account exists for that email, a reset link has been sent",
+	})
+}
+
+// POST /auth/reset-password
+func (ah *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+		return
+	}
+
+	validationErrs := ah.validator.Struct(req)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
 		return
 	}
 
-	token, err := services.GenerateToken(userId, "refresh")
+	err := ah.acc.ResetPassword(ctx, req.Token, req.Password)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not generate refresh token: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Password reset successfully, please log in again",
+	})
+}
+
+// POST /auth/verify-email
+func (ah *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
 		return
 	}
+
+	validationErrs := ah.validator.Struct(req)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
+		return
+	}
+
+	err := ah.acc.VerifyEmail(ctx, req.Token)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Email verified successfully",
+	})
+}
+
+// POST /auth/verify-email/resend sends a new link to the logged in user
+func (ah *AuthHandler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := middleware.GetUserFromContext(ctx)
+	if user == nil {
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
+		return
+	}
+
+	if err := ah.acc.ResendVerificationEmail(ctx, user.UserID); err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusAccepted, utils.ApiResponse{
+		Success: true,
+		Message: "Verification email sent",
+	})
+}
+
+// POST /auth/mfa/verify finishes a login for an account with MFA
+func (ah *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+		return
+	}
+
+	validationErrs := ah.validator.Struct(req)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
+		return
+	}
+
+	resp, err := ah.au.VerifyMFALogin(ctx, req.MFAToken, req.Code, utils.ClientIP(r))
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "User logged in successfully",
+		Data:    resp,
+	})
+}
+
+// POST /auth/mfa/enroll returns a new TOTP secret and its provisioning URI
+func (ah *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := middleware.GetUserFromContext(ctx)
+	if user == nil {
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
+		return
+	}
+
+	enrollment, err := ah.mfa.Enroll(ctx, user.UserID)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Scan the code with your authenticator app, then confirm with a code from it",
+		Data:    enrollment,
+	})
+}
+
+// POST /auth/mfa/confirm switches MFA on and returns the recovery codes
+func (ah *AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	ah.mfaCode(w, r, func(userId string, code string) (interface{}, error) {
+		return ah.mfa.Confirm(r.Context(), userId, code)
+	}, "MFA enabled, store the recovery codes somewhere safe and log in again")
+}
+
+// POST /auth/mfa/disable
+func (ah *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	ah.mfaCode(w, r, func(userId string, code string) (interface{}, error) {
+		return nil, ah.mfa.Disable(r.Context(), userId, code)
+	}, "MFA disabled, log in again")
+}
+
+// mfaCode runs an MFA step that takes the caller's ID and a code
+func (ah *AuthHandler) mfaCode(w http.ResponseWriter, r *http.Request, step func(userId string, code string) (interface{}, error), message string) {
+	user := middleware.GetUserFromContext(r.Context())
+	if user == nil {
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
+		return
+	}
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+		return
+	}
+
+	validationErrs := ah.validator.Struct(req)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
+		return
+	}
+
+	data, err := step(user.UserID, req.Code)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
 	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
 		Success: true,
-		Message: "Refresh token generated successfully",
-		Data:    token,
+		Message: message,
+		Data:    data,
 	})
 }
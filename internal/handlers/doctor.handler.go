@@ -2,31 +2,45 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"github/Chidi-creator/go-medic-server/internal/managers"
+	"github/Chidi-creator/go-medic-server/internal/middleware"
 	"github/Chidi-creator/go-medic-server/internal/models"
 	"github/Chidi-creator/go-medic-server/internal/usecases"
 	"github/Chidi-creator/go-medic-server/internal/utils"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
+// ErrNotHospitalOwner is returned when a hospital owner registers a doctor at someone else's hospital
+var ErrNotHospitalOwner = utils.Forbidden("not_hospital_owner", "you can only register doctors at your own hospital")
+
 type DoctorHandler interface {
 	CreateDoctor(w http.ResponseWriter, r *http.Request)
 	FindDoctorById(w http.ResponseWriter, r *http.Request)
 	GetDoctorsByHospitalId(w http.ResponseWriter, r *http.Request)
 	UpdateDoctorById(w http.ResponseWriter, r *http.Request)
 	DeleteDoctorByUserId(w http.ResponseWriter, r *http.Request)
+	SetAvailability(w http.ResponseWriter, r *http.Request)
+	GetAvailability(w http.ResponseWriter, r *http.Request)
+	GetAvailableSlots(w http.ResponseWriter, r *http.Request)
 }
 
 type doctorHandler struct {
-	doctorusecase usecases.DoctorUsecase
+	doctorusecase   usecases.DoctorUsecase
+	hospitalusecase usecases.HospitalUsecase
+	validator       *utils.Validator
+	cursors         *utils.Cursors
 }
 
-func NewDoctorHandler(du usecases.DoctorUsecase) DoctorHandler {
+func NewDoctorHandler(du usecases.DoctorUsecase, hu usecases.HospitalUsecase, v *utils.Validator, cursors *utils.Cursors) DoctorHandler {
 	return &doctorHandler{
-		doctorusecase: du,
+		doctorusecase:   du,
+		hospitalusecase: hu,
+		validator:       v,
+		cursors:         cursors,
 	}
 }
 
@@ -37,20 +51,27 @@ func (dh *doctorHandler) CreateDoctor(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&doctor)
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid request body",
-		})
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+		return
+	}
+
+	// hospital owners may only register doctors at their own hospital
+	hospital, err := dh.hospitalusecase.GetHospitalById(ctx, doctor.HospitalID.Hex())
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+	user := middleware.GetUserFromContext(ctx)
+	isAdmin := utils.IsRoleValid([]utils.Roles{utils.ADMIN}, middleware.GetRolesFromContext(ctx))
+	if user == nil || (hospital.UserID.Hex() != user.UserID && !isAdmin) {
+		managers.ErrorResponse(w, r, ErrNotHospitalOwner)
 		return
 	}
 
 	newDoctor, err := dh.doctorusecase.CreateDoctor(ctx, &doctor)
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not create doctor" + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -71,10 +92,7 @@ func (dh *doctorHandler) FindDoctorById(w http.ResponseWriter, r *http.Request)
 
 	doctor, err := dh.doctorusecase.FindDoctorById(ctx, id)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not find doctor" + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -93,19 +111,23 @@ func (dh *doctorHandler) GetDoctorsByHospitalId(w http.ResponseWriter, r *http.R
 
 	id := params["id"]
 
-	doctors, err := dh.doctorusecase.GetDoctorsByHospitalId(ctx, id)
+	page, ok := parsePage(w, r, doctorListSpec, dh.cursors)
+	if !ok {
+		return
+	}
+
+	doctors, info, err := dh.doctorusecase.GetDoctorsByHospitalId(ctx, id, page)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not fetch doctors" + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
+	dh.cursors.Seal(page, info)
 	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
 		Success: true,
-		Message: "Doctor successfully retrieved",
+		Message: "Doctors successfully retrieved",
 		Data:    doctors,
+		Page:    info,
 	})
 
 }
@@ -117,25 +139,17 @@ func (dh *doctorHandler) UpdateDoctorById(w http.ResponseWriter, r *http.Request
 
 	id := params["id"]
 
-	var update bson.M
-
-	err := json.NewDecoder(r.Body).Decode(&update)
-
+	var patch models.DoctorPatch
+	update, err := dh.validator.DecodeMergePatch(r.Body, &patch)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid request body",
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
 	err = dh.doctorusecase.UpdateDoctorById(ctx, id, update)
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Failed to update doctor: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -155,14 +169,111 @@ func (dh *doctorHandler) DeleteDoctorByUserId(w http.ResponseWriter, r *http.Req
 	err := dh.doctorusecase.DeleteDoctorByUserId(ctx, id)
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not delete user from db" + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Doctor successfully deleted",
+	})
+}
+
+func (dh *doctorHandler) SetAvailability(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	params := mux.Vars(r)
+
+	id := params["id"]
+
+	var availability models.DoctorAvailability
+	if err := json.NewDecoder(r.Body).Decode(&availability); err != nil {
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+		return
+	}
+
+	validationErrs := dh.validator.Struct(availability)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
+		return
+	}
+
+	saved, err := dh.doctorusecase.SetAvailability(ctx, id, &availability)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
 		return
 	}
-	managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-		Success: false,
-		Error:   "Doctor successfully deleted from db",
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Availability successfully saved",
+		Data:    saved,
 	})
 }
+
+func (dh *doctorHandler) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	params := mux.Vars(r)
+
+	id := params["id"]
+
+	schedules, err := dh.doctorusecase.GetAvailability(ctx, id)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Availability successfully retrieved",
+		Data:    schedules,
+	})
+}
+
+// GET /doctors/{id}/slots?from=&to=&hospitalId=
+func (dh *doctorHandler) GetAvailableSlots(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	params := mux.Vars(r)
+
+	id := params["id"]
+	query := r.URL.Query()
+
+	from, err := parseTimeParam("from", query.Get("from"))
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+	to, err := parseTimeParam("to", query.Get("to"))
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	slots, err := dh.doctorusecase.GetAvailableSlots(ctx, id, query.Get("hospitalId"), from, to)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Available slots successfully retrieved",
+		Data:    slots,
+	})
+}
+
+// accepts either a full RFC3339 timestamp or a plain date (midnight UTC)
+func parseTimeParam(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%w: %s is required", usecases.ErrInvalidAvailability, name)
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be an RFC3339 timestamp or YYYY-MM-DD date", usecases.ErrInvalidAvailability, name)
+	}
+	return t, nil
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github/Chidi-creator/go-medic-server/internal/logger"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"net/http"
+)
+
+type HealthHandler struct {
+	hc *services.HealthChecker
+}
+
+func NewHealthHandler(hc *services.HealthChecker) *HealthHandler {
+	return &HealthHandler{
+		hc: hc,
+	}
+}
+
+// GET /livez only says the process is serving; it never touches dependencies
+// so a database outage does not get healthy instances restarted
+func (hh *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, map[string]string{"status": services.StatusUp})
+}
+
+// GET /readyz answers 503 while any dependency is down so traffic is routed
+// elsewhere. Anyone can reach it, so it only says up or down; the reasons go
+// to the log.
+func (hh *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	report := hh.hc.Check(r.Context())
+	for name, dependency := range report.Dependencies {
+		if dependency.Error != "" {
+			logger.FromContext(r.Context()).Warn("Dependency check failed", "dependency", name, "error", dependency.Error)
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status != services.StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, report)
+}
+
+// probes are read by orchestrators rather than clients, so they skip the
+// ApiResponse envelope and are never cached
+func writeHealth(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -2,15 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"github/Chidi-creator/go-medic-server/internal/managers"
 	"github/Chidi-creator/go-medic-server/internal/middleware"
 	"github/Chidi-creator/go-medic-server/internal/models"
 	"github/Chidi-creator/go-medic-server/internal/usecases"
 	"github/Chidi-creator/go-medic-server/internal/utils"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -18,19 +19,24 @@ type HospitalHandler interface {
 	CreateHospital(w http.ResponseWriter, r *http.Request)
 	GetHospitalById(w http.ResponseWriter, r *http.Request)
 	GetAllHospitals(w http.ResponseWriter, r *http.Request)
+	GetNearbyHospitals(w http.ResponseWriter, r *http.Request)
 	UpdateHospitalById(w http.ResponseWriter, r *http.Request)
 	DeleteHospital(w http.ResponseWriter, r *http.Request)
 }
 
 type hospitalHandler struct {
-	hu usecases.HospitalUsecase
-	uu usecases.UserUseCase
+	hu        usecases.HospitalUsecase
+	uu        usecases.UserUseCase
+	validator *utils.Validator
+	cursors   *utils.Cursors
 }
 
-func NewHospitalHandler(hu usecases.HospitalUsecase, uu usecases.UserUseCase) HospitalHandler {
+func NewHospitalHandler(hu usecases.HospitalUsecase, uu usecases.UserUseCase, v *utils.Validator, cursors *utils.Cursors) HospitalHandler {
 	return &hospitalHandler{
-		hu: hu,
-		uu: uu,
+		hu:        hu,
+		uu:        uu,
+		validator: v,
+		cursors:   cursors,
 	}
 }
 
@@ -39,61 +45,39 @@ func (h *hospitalHandler) CreateHospital(w http.ResponseWriter, r *http.Request)
 	user := middleware.GetUserFromContext(ctx)
 
 	if user == nil {
-		managers.JSONresponse(w, http.StatusUnauthorized, utils.ApiResponse{
-			Success: false,
-			Error:   "User not authenticated",
-		})
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
 		return
 	}
 
 	var hospital models.Hospital
 	if err := json.NewDecoder(r.Body).Decode(&hospital); err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid request body: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
 		return
 	}
 
 	// Set UserID from authenticated user (this prevents clients from spoofing the UserID)
 	userId, err := primitive.ObjectIDFromHex(user.UserID)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid user ID format",
-		})
+		managers.ErrorResponse(w, r, middleware.ErrInvalidToken)
 		return
 	}
 	hospital.UserID = userId
 
 	// Validate the struct
-	validationErrs := utils.ValidateStruct(hospital)
-	if validationErrs != "" {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Validation failed: " + validationErrs,
-		})
+	validationErrs := h.validator.Struct(hospital)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
 		return
 	}
 
 	newHospital, err := h.hu.CreateHospital(ctx, &hospital)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid request: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
-	updateQuery := bson.M{
-		"$addToSet": bson.M{"roles": utils.HOSPITAL},
-	}
-
-	err = h.uu.UpdateUserById(ctx, user.UserID, updateQuery)
+	err = h.uu.AddUserRole(ctx, user.UserID, utils.HOSPITAL)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not update user roles: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -114,10 +98,7 @@ func (h *hospitalHandler) GetHospitalById(w http.ResponseWriter, r *http.Request
 
 	hospital, err := h.hu.GetHospitalById(ctx, id)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Could no " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -130,18 +111,79 @@ func (h *hospitalHandler) GetHospitalById(w http.ResponseWriter, r *http.Request
 }
 func (h *hospitalHandler) GetAllHospitals(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	hospitals, err := h.hu.GetAllHospitals(ctx)
+	page, ok := parsePage(w, r, hospitalListSpec, h.cursors)
+	if !ok {
+		return
+	}
+	hospitals, info, err := h.hu.GetAllHospitals(ctx, page)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not retrieve hospitals: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
+	h.cursors.Seal(page, info)
 	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
 		Success: true,
 		Message: "Hospitals retrieved successfully",
 		Data:    hospitals,
+		Page:    info,
+	})
+}
+
+// GET /hospitals/nearby?lng=&lat=&radiusKm=&specialty=&open=true&limit=
+func (h *hospitalHandler) GetNearbyHospitals(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := r.URL.Query()
+
+	query := models.NearbyHospitalQuery{
+		RadiusKm:  10,
+		Limit:     50,
+		Specialty: utils.Specialty(params.Get("specialty")),
+	}
+
+	var err error
+	if query.Longitude, err = strconv.ParseFloat(params.Get("lng"), 64); err != nil {
+		managers.ErrorResponse(w, r, fmt.Errorf("%w: lng is required and must be a number", utils.ErrInvalidQuery))
+		return
+	}
+	if query.Latitude, err = strconv.ParseFloat(params.Get("lat"), 64); err != nil {
+		managers.ErrorResponse(w, r, fmt.Errorf("%w: lat is required and must be a number", utils.ErrInvalidQuery))
+		return
+	}
+	if v := params.Get("radiusKm"); v != "" {
+		if query.RadiusKm, err = strconv.ParseFloat(v, 64); err != nil {
+			managers.ErrorResponse(w, r, fmt.Errorf("%w: radiusKm must be a number", utils.ErrInvalidQuery))
+			return
+		}
+	}
+	if v := params.Get("open"); v != "" {
+		if query.OpenOnly, err = strconv.ParseBool(v); err != nil {
+			managers.ErrorResponse(w, r, fmt.Errorf("%w: open must be true or false", utils.ErrInvalidQuery))
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if query.Limit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			managers.ErrorResponse(w, r, fmt.Errorf("%w: limit must be an integer", utils.ErrInvalidQuery))
+			return
+		}
+	}
+
+	validationErrs := h.validator.Struct(query)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
+		return
+	}
+
+	hospitals, err := h.hu.FindHospitalsNear(ctx, query)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Nearby hospitals retrieved successfully",
+		Data:    hospitals,
 	})
 }
 
@@ -150,23 +192,16 @@ func (h *hospitalHandler) UpdateHospitalById(w http.ResponseWriter, r *http.Requ
 	params := mux.Vars(r)
 
 	id := params["id"]
-	var update bson.M
-
-	err := json.NewDecoder(r.Body).Decode(&update)
+	var patch models.HospitalPatch
+	update, err := h.validator.DecodeMergePatch(r.Body, &patch)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid request " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
 	updatedHospital, err := h.hu.UpdateHospitalById(ctx, id, update)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not update hospital: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -181,20 +216,8 @@ func (h *hospitalHandler) DeleteHospital(w http.ResponseWriter, r *http.Request)
 	ctx := r.Context()
 	params := mux.Vars(r)
 	id := params["id"]
-	deletedCount, err := h.hu.DeleteHospital(ctx, id)
-	if err != nil {
-		managers.JSONresponse(w, http.StatusInternalServerError, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not delete hospital: " + err.Error(),
-		})
-		return
-	}
-
-	if deletedCount == 0 {
-		managers.JSONresponse(w, http.StatusNotFound, utils.ApiResponse{
-			Success: false,
-			Error:   "Hospital not found",
-		})
+	if err := h.hu.DeleteHospital(ctx, id); err != nil {
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github/Chidi-creator/go-medic-server/internal/logger"
+	"github/Chidi-creator/go-medic-server/internal/managers"
+	"github/Chidi-creator/go-medic-server/internal/middleware"
+	"github/Chidi-creator/go-medic-server/internal/usecases"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type InviteDoctorRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type DoctorInviteHandler interface {
+	InviteDoctor(w http.ResponseWriter, r *http.Request)
+	ResendInvite(w http.ResponseWriter, r *http.Request)
+	GetInvite(w http.ResponseWriter, r *http.Request)
+	AcceptInvite(w http.ResponseWriter, r *http.Request)
+	RejectInvite(w http.ResponseWriter, r *http.Request)
+}
+
+type doctorInviteHandler struct {
+	iu        usecases.DoctorInviteUsecase
+	validator *utils.Validator
+}
+
+func NewDoctorInviteHandler(iu usecases.DoctorInviteUsecase, v *utils.Validator) DoctorInviteHandler {
+	return &doctorInviteHandler{
+		iu:        iu,
+		validator: v,
+	}
+}
+
+// POST /doctors/{id}/invites
+func (ih *doctorInviteHandler) InviteDoctor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := middleware.GetUserFromContext(ctx)
+	if user == nil {
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
+		return
+	}
+
+	var req InviteDoctorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
+		return
+	}
+
+	validationErrs := ih.validator.Struct(req)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
+		return
+	}
+
+	invite, err := ih.iu.InviteDoctor(ctx, user.UserID, mux.Vars(r)["id"], req.Email)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+	logger.FromContext(ctx).Info("Doctor invite issued", "invite_id", invite.ID.Hex())
+
+	managers.JSONresponse(w, http.StatusCreated, utils.ApiResponse{
+		Success: true,
+		Message: "Doctor invited successfully",
+		Data:    invite,
+	})
+}
+
+// POST /doctors/invites/{id}/resend
+func (ih *doctorInviteHandler) ResendInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := middleware.GetUserFromContext(ctx)
+	if user == nil {
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
+		return
+	}
+
+	invite, err := ih.iu.ResendInvite(ctx, user.UserID, mux.Vars(r)["id"])
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Invite re-sent successfully",
+		Data:    invite,
+	})
+}
+
+// GET /doctors/invites/{token}
+func (ih *doctorInviteHandler) GetInvite(w http.ResponseWriter, r *http.Request) {
+	invite, err := ih.iu.GetInvite(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Invite retrieved successfully",
+		Data:    invite,
+	})
+}
+
+// POST /doctors/invites/{token}/accept
+func (ih *doctorInviteHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := middleware.GetUserFromContext(ctx)
+	if user == nil {
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
+		return
+	}
+
+	invite, err := ih.iu.AcceptInvite(ctx, mux.Vars(r)["token"], user.UserID)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Invite accepted",
+		Data:    invite,
+	})
+}
+
+// POST /doctors/invites/{token}/reject
+func (ih *doctorInviteHandler) RejectInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := middleware.GetUserFromContext(ctx)
+	if user == nil {
+		managers.ErrorResponse(w, r, middleware.ErrNotAuthenticated)
+		return
+	}
+
+	invite, err := ih.iu.RejectInvite(ctx, mux.Vars(r)["token"], user.UserID)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return
+	}
+
+	managers.JSONresponse(w, http.StatusOK, utils.ApiResponse{
+		Success: true,
+		Message: "Invite rejected",
+		Data:    invite,
+	})
+}
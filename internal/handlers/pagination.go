@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"github/Chidi-creator/go-medic-server/internal/managers"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+)
+
+// list query whitelists, one per list endpoint
+var (
+	hospitalListSpec = utils.ListSpec{
+		SortFields:  map[string]string{"name": "name", "createdAt": "createdAt"},
+		DefaultSort: "name",
+		Filters: map[string]utils.FilterSpec{
+			"specialty": {Field: "specialties", Kind: utils.FilterString},
+			"open":      {Field: "open", Kind: utils.FilterBool},
+		},
+	}
+
+	doctorListSpec = utils.ListSpec{
+		SortFields:  map[string]string{"firstname": "firstname", "lastname": "lastname", "createdAt": "createdAt"},
+		DefaultSort: "lastname",
+		Filters: map[string]utils.FilterSpec{
+			"specialty":    {Field: "specialties", Kind: utils.FilterString},
+			"inviteStatus": {Field: "inviteStatus", Kind: utils.FilterString},
+		},
+	}
+
+	appointmentListSpec = utils.ListSpec{
+		SortFields:  map[string]string{"startTime": "startTime", "createdAt": "createdAt"},
+		DefaultSort: "startTime",
+		Filters: map[string]utils.FilterSpec{
+			"status":     {Field: "status", Kind: utils.FilterString},
+			"hospitalId": {Field: "hospitalId", Kind: utils.FilterObjectID},
+			"from":       {Field: "startTime", Kind: utils.FilterTimeFrom},
+			"to":         {Field: "startTime", Kind: utils.FilterTimeTo},
+		},
+	}
+)
+
+// parsePage reads the list query for spec and opens its cursor, answering 400
+// itself when either is invalid. The next page's cursor must be sealed with
+// the same cursors before it is returned.
+func parsePage(w http.ResponseWriter, r *http.Request, spec utils.ListSpec, cursors *utils.Cursors) (*utils.PageRequest, bool) {
+	page, err := utils.ParseListParams(r.URL.Query(), spec)
+	if err != nil {
+		managers.ErrorResponse(w, r, err)
+		return nil, false
+	}
+	if err := cursors.Open(page, r.URL.Path); err != nil {
+		managers.ErrorResponse(w, r, err)
+		return nil, false
+	}
+	return page, true
+}
@@ -10,9 +10,17 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
+// RegisterUserRequest is what anyone may choose about a new account; roles
+// are not among it
+type RegisterUserRequest struct {
+	Firstname string `json:"firstname" validate:"required,min=2,max=100"`
+	LastName  string `json:"lastname" validate:"required,min=2,max=100"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required,min=6"`
+}
+
 type UserHandler interface {
 	RegisterUser(w http.ResponseWriter, r *http.Request)
 	GetUserById(w http.ResponseWriter, r *http.Request)
@@ -21,47 +29,45 @@ type UserHandler interface {
 }
 
 type userHandler struct {
-	uc usecases.UserUseCase
+	uc        usecases.UserUseCase
+	validator *utils.Validator
 }
 
-func NewUserHandler(uc usecases.UserUseCase) UserHandler {
+func NewUserHandler(uc usecases.UserUseCase, v *utils.Validator) UserHandler {
 	return &userHandler{
-		uc: uc,
+		uc:        uc,
+		validator: v,
 	}
 }
 
 func (uh *userHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	var user models.User
+	var req RegisterUserRequest
 
-	err := json.NewDecoder(r.Body).Decode(&user)
+	err := json.NewDecoder(r.Body).Decode(&req)
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid Request Body",
-		})
+		managers.ErrorResponse(w, r, utils.ErrInvalidBody)
 		return
 
 	}
 
 	// validate request
-	validationErrs := utils.ValidateStruct(user)
-	if validationErrs != "nil" {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   validationErrs,
-		})
+	validationErrs := uh.validator.Struct(req)
+	if validationErrs != nil {
+		managers.ErrorResponse(w, r, validationErrs)
 		return
 	}
 
-	registeredUser, err := uh.uc.RegisterUser(ctx, &user)
+	registeredUser, err := uh.uc.RegisterUser(ctx, &models.User{
+		Firstname: req.Firstname,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Password:  req.Password,
+	})
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not register user: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -83,10 +89,7 @@ func (uh *userHandler) GetUserById(w http.ResponseWriter, r *http.Request) {
 
 	user, err := uh.uc.GetUserById(ctx, userId)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusNotFound, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not find User: " + err.Error(),
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -106,42 +109,23 @@ func (uh *userHandler) UpdateUserById(w http.ResponseWriter, r *http.Request) {
 
 	userId := params["id"]
 
-	user, err := uh.uc.GetUserById(ctx, userId)
+	_, err := uh.uc.GetUserById(ctx, userId)
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusNotFound, utils.ApiResponse{
-			Success: false,
-			Error:   "Error finding user: " + err.Error(),
-		})
-		return
-	}
-
-	if user == nil {
-		managers.JSONresponse(w, http.StatusNotFound, utils.ApiResponse{
-			Success: false,
-			Error:   "User doesnt exist ",
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
-	var update bson.M
-
-	err = json.NewDecoder(r.Body).Decode(&update)
-
+	var patch models.UserPatch
+	update, err := uh.validator.DecodeMergePatch(r.Body, &patch)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Invalid update payload",
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
 	err = uh.uc.UpdateUserById(ctx, userId, update)
 	if err != nil {
-		managers.JSONresponse(w, http.StatusBadRequest, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not update user",
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
@@ -158,21 +142,10 @@ func (uh *userHandler) DeleteUserById(w http.ResponseWriter, r *http.Request) {
 
 	userId := params["id"]
 
-	count, err := uh.uc.DeleteUserById(ctx, userId)
+	err := uh.uc.DeleteUserById(ctx, userId)
 
 	if err != nil {
-		managers.JSONresponse(w, http.StatusNotFound, utils.ApiResponse{
-			Success: false,
-			Error:   "Could not delete user ",
-		})
-		return
-	}
-
-	if count == 0 {
-		managers.JSONresponse(w, http.StatusNotFound, utils.ApiResponse{
-			Success: false,
-			Error:   "No user got deleted",
-		})
+		managers.ErrorResponse(w, r, err)
 		return
 	}
 
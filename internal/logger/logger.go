@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// attributes that can carry patient or account details; their values never
+// reach the log output
+var redactedKeys = map[string]bool{
+	"email":        true,
+	"reason":       true,
+	"password":     true,
+	"token":        true,
+	"refreshtoken": true,
+	"phone":        true,
+	"phonenumber":  true,
+	"address":      true,
+	"firstname":    true,
+	"lastname":     true,
+}
+
+const redacted = "[REDACTED]"
+
+// New builds the application logger. format is "json" (default) or "text";
+// level is one of debug, info, warn, error.
+func New(w io.Writer, format string, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       parseLevel(level),
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler = slog.NewJSONHandler(w, opts)
+	if format == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(handler)
+}
+
+func parseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if redactedKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+type contextKey string
+
+const (
+	loggerKey  contextKey = "logger"
+	requestKey contextKey = "request"
+)
+
+// WithContext attaches l to ctx for FromContext
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the request scoped logger, or the default logger
+// outside a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// RequestInfo is shared between the logging middleware and handlers further
+// down the chain, which only see a copy of the request context
+type RequestInfo struct {
+	ID     string
+	UserID string
+}
+
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestKey, info)
+}
+
+func RequestInfoFromContext(ctx context.Context) *RequestInfo {
+	if info, ok := ctx.Value(requestKey).(*RequestInfo); ok {
+		return info
+	}
+	return nil
+}
+
+// SetUser records the authenticated user for the access log and adds their ID
+// to the request logger
+func SetUser(ctx context.Context, userId string) context.Context {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		info.UserID = userId
+	}
+	return WithContext(ctx, FromContext(ctx).With("user_id", userId))
+}
@@ -2,15 +2,77 @@ package managers
 
 import (
 	"encoding/json"
+	"github/Chidi-creator/go-medic-server/internal/logger"
 	"github/Chidi-creator/go-medic-server/internal/utils"
 	"net/http"
+	"strings"
 )
 
+// Problem is an RFC 7807 problem details document with our stable error code
+// and any field errors as extension members
+type Problem struct {
+	Type     string             `json:"type"`
+	Title    string             `json:"title"`
+	Status   int                `json:"status"`
+	Detail   string             `json:"detail,omitempty"`
+	Instance string             `json:"instance,omitempty"`
+	Code     string             `json:"code"`
+	Errors   []utils.FieldError `json:"errors,omitempty"`
+}
 
-//sending the response to the front end
+// sending the response to the front end; failures are sent as problem+json
 func JSONresponse(w http.ResponseWriter, status int, resp utils.ApiResponse) {
+	if status >= http.StatusBadRequest {
+		code := statusCode(status)
+		if len(resp.Errors) > 0 {
+			code = "validation_failed"
+		}
+		writeProblem(w, Problem{
+			Status: status,
+			Detail: resp.Error,
+			Code:   code,
+			Errors: resp.Errors,
+		})
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(resp)
 
 }
+
+// ErrorResponse reports err with the status and code of its domain error type.
+// Untyped errors are logged and answered with a generic 500 so internal
+// details never reach clients.
+func ErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	kind, code := utils.ClassifyError(err)
+
+	problem := Problem{
+		Status:   kind.Status(),
+		Detail:   err.Error(),
+		Instance: r.URL.Path,
+		Code:     code,
+		Errors:   utils.FieldErrors(err),
+	}
+	if kind == utils.KindInternal {
+		logger.FromContext(r.Context()).Error("Request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		problem.Detail = "An unexpected error occurred"
+	}
+
+	writeProblem(w, problem)
+}
+
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	problem.Type = "about:blank"
+	problem.Title = http.StatusText(problem.Status)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+// statusCode derives a stable code from a status, e.g. 404 -> not_found
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// PoolMonitor keeps the pool gauges in step with the driver's connection events
+func PoolMonitor() *event.PoolMonitor {
+	open := MongoPoolConnections.WithLabelValues("open")
+	inUse := MongoPoolConnections.WithLabelValues("in_use")
+
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				open.Inc()
+			case event.ConnectionClosed:
+				open.Dec()
+			case event.GetSucceeded:
+				inUse.Inc()
+			case event.ConnectionReturned:
+				inUse.Dec()
+			case event.GetFailed:
+				MongoPoolCheckoutFailures.Inc()
+			}
+		},
+	}
+}
@@ -2,58 +2,73 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"github/Chidi-creator/go-medic-server/internal/logger"
 	"github/Chidi-creator/go-medic-server/internal/managers"
 	"github/Chidi-creator/go-medic-server/internal/services"
 	"github/Chidi-creator/go-medic-server/internal/utils"
 	"net/http"
 	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// ErrInvalidToken is the fixed answer for any token that does not validate
+	ErrInvalidToken           = utils.Unauthorized("invalid_access_token", "invalid or expired token")
+	ErrTokenRevoked           = utils.Unauthorized("token_revoked", "token has been revoked, please log in again")
+	ErrMissingToken           = utils.Unauthorized("missing_access_token", "missing Authorization header")
+	ErrMalformedAuthorization = utils.Unauthorized("invalid_authorization_header", "Authorization header must be \"Bearer <token>\"")
+	// ErrNotAuthenticated is answered by handlers reached without verified claims
+	ErrNotAuthenticated = utils.Unauthorized("not_authenticated", "user not authenticated")
 )
 
 type contextKey string
 
 const UserContextKey contextKey = "user"
 
-// Auth middleware that validates JWT in router
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		//Extract token from Authorization Header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			managers.JSONresponse(w, http.StatusUnauthorized, utils.ApiResponse{
-				Success: false,
-				Error:   "Missing Authorisation header",
-			})
-			return
-		}
-		//splitting authorisation into two parts and checking validity of structure
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			managers.JSONresponse(w, http.StatusUnauthorized, utils.ApiResponse{
-				Success: false,
-				Error:   "Invalid Authorisation format",
-			})
-			return
-		}
+// AuthMiddleware builds the middleware that validates the bearer token with tokens
+func AuthMiddleware(tokens *services.TokenService) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			//Extract token from Authorization Header
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				managers.ErrorResponse(w, r, ErrMissingToken)
+				return
+			}
+			//splitting authorisation into two parts and checking validity of structure
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				managers.ErrorResponse(w, r, ErrMalformedAuthorization)
+				return
+			}
 
-		tokenstr := parts[1]
+			tokenstr := parts[1]
 
-		// validating token
-		claims, err := services.ValidateToken(tokenstr)
-		if err != nil {
-			managers.JSONresponse(w, http.StatusUnauthorized, utils.ApiResponse{
-				Success: false,
-				Error:   "Invalid Token: " + err.Error(),
-			})
-		}
+			// validating token
+			// only the token's own faults are 401s; a failed revocation
+			// lookup must not log the user out
+			claims, err := tokens.ValidateToken(r.Context(), tokenstr)
+			switch {
+			case errors.Is(err, services.ErrTokenRevoked):
+				managers.ErrorResponse(w, r, ErrTokenRevoked)
+				return
+			case errors.Is(err, services.ErrInvalidToken):
+				managers.ErrorResponse(w, r, ErrInvalidToken)
+				return
+			case err != nil:
+				managers.ErrorResponse(w, r, err)
+				return
+			}
 
-		
-
-		//attach claims to context
-		ctx := context.WithValue(r.Context(), UserContextKey, claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
-
-	})
+			//attach claims to context
+			ctx := context.WithValue(r.Context(), UserContextKey, claims)
+			ctx = logger.SetUser(ctx, claims.UserID)
+			next.ServeHTTP(w, r.WithContext(ctx))
 
+		})
+	}
 }
 
 // retrieving user claims from request context
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ClientIP resolves the client address once, believing X-Forwarded-For only
+// from proxies, so utils.ClientIP is right behind a load balancer. It must run
+// before anything keyed by client address.
+func ClientIP(proxies utils.TrustedProxies) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := utils.WithClientIP(r.Context(), proxies.ClientIP(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github/Chidi-creator/go-medic-server/internal/logger"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestLogger propagates the caller's X-Request-ID (or assigns one), attaches
+// a logger carrying it to the request context and writes one access log line
+// per request
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		info := &logger.RequestInfo{ID: id}
+		reqLogger := slog.Default().With("request_id", id)
+		ctx := logger.WithRequestInfo(r.Context(), info)
+		ctx = logger.WithContext(ctx, reqLogger)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []any{
+			"method", r.Method,
+			"route", routeTemplate(r),
+			"status", rec.status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if info.UserID != "" {
+			attrs = append(attrs, "user_id", info.UserID)
+		}
+		reqLogger.Log(ctx, level, "request", attrs...)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"github/Chidi-creator/go-medic-server/internal/logger"
+	"github/Chidi-creator/go-medic-server/internal/managers"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var ErrRateLimited = utils.TooManyRequests("rate_limited", "too many requests, slow down")
+
+// RateLimitKey picks the bucket a request is counted against
+type RateLimitKey func(r *http.Request) string
+
+// KeyByIP gives every client address its own bucket. Behind a proxy the
+// address comes from the ClientIP middleware, which must run first; without
+// it every request counts against the proxy's single bucket.
+func KeyByIP(r *http.Request) string {
+	return "ip:" + utils.ClientIP(r)
+}
+
+// KeyByUser gives every authenticated user their own bucket, falling back to
+// the client address; it must run after AuthMiddleware
+func KeyByUser(r *http.Request) string {
+	if user := GetUserFromContext(r.Context()); user != nil {
+		return "user:" + user.UserID
+	}
+	return KeyByIP(r)
+}
+
+// RateLimit throttles requests with a token bucket per key. Every response
+// carries RateLimit-* headers; refused requests get 429 with Retry-After.
+// name keeps buckets of different route groups apart.
+func RateLimit(store services.RateLimitStore, name string, limit services.RateLimit, key RateLimitKey) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := store.Take(r.Context(), name+":"+key(r), limit)
+			if err != nil {
+				// an unavailable store should not take the API down with it
+				logger.FromContext(r.Context()).Error("Rate limit store failed", "limit", name, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(result.Reset))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+				managers.ErrorResponse(w, r, ErrRateLimited)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
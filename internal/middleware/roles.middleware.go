@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"context"
+	"github/Chidi-creator/go-medic-server/internal/managers"
+	"github/Chidi-creator/go-medic-server/internal/usecases"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+const RolesContextKey contextKey = "roles"
+
+var (
+	ErrMFARequired   = utils.Forbidden("mfa_required", "your role requires multi-factor authentication; enrol at /auth/mfa/enroll and log in again")
+	ErrForbiddenRole = utils.Forbidden("forbidden_role", "you do not have permission to perform this action")
+	ErrNotOwner      = utils.Forbidden("not_owner", "you do not have permission to access this resource")
+	ErrAccountGone   = utils.Unauthorized("account_not_found", "user no longer exists")
+)
+
+// OwnerResolver returns the IDs of the users allowed to act on the resource
+// addressed by the request
+type OwnerResolver func(r *http.Request) ([]string, error)
+
+// Authorizer enforces role and ownership rules on routes. It must run after
+// AuthMiddleware, since it relies on the claims that middleware attaches.
+type Authorizer struct {
+	uu usecases.UserUseCase
+	hu usecases.HospitalUsecase
+	du usecases.DoctorUsecase
+	au usecases.AppointmentUsecase
+}
+
+func NewAuthorizer(uu usecases.UserUseCase, hu usecases.HospitalUsecase, du usecases.DoctorUsecase, au usecases.AppointmentUsecase) *Authorizer {
+	return &Authorizer{
+		uu: uu,
+		hu: hu,
+		du: du,
+		au: au,
+	}
+}
+
+// RequireMFA refuses callers holding a role in utils.MFARequiredRoles unless
+// their token passed MFA. It must run right after AuthMiddleware on every
+// protected route. exempt lists the routes, as "METHOD /path/template", such
+// a caller still needs, i.e. those to enrol in MFA and to log out.
+func (a *Authorizer) RequireMFA(exempt ...string) mux.MiddlewareFunc {
+	allowed := make(map[string]bool, len(exempt))
+	for _, route := range exempt {
+		allowed[route] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if allowed[r.Method+" "+routeTemplate(r)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userRoles, r, ok := a.loadRoles(w, r)
+			if !ok {
+				return
+			}
+
+			claims := GetUserFromContext(r.Context())
+			if !claims.MFA && utils.IsRoleValid(utils.MFARequiredRoles, userRoles) {
+				managers.ErrorResponse(w, r, ErrMFARequired)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles only lets through users holding at least one of the given roles
+func (a *Authorizer) RequireRoles(roles ...utils.Roles) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userRoles, r, ok := a.loadRoles(w, r)
+			if !ok {
+				return
+			}
+
+			if !utils.IsRoleValid(roles, userRoles) {
+				managers.ErrorResponse(w, r, ErrForbiddenRole)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireOwner only lets through admins and the users returned by resolve
+func (a *Authorizer) RequireOwner(resolve OwnerResolver) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userRoles, r, ok := a.loadRoles(w, r)
+			if !ok {
+				return
+			}
+
+			if utils.IsRoleValid([]utils.Roles{utils.ADMIN}, userRoles) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			owners, err := resolve(r)
+			if err != nil {
+				managers.ErrorResponse(w, r, err)
+				return
+			}
+
+			claims := GetUserFromContext(r.Context())
+			for _, owner := range owners {
+				if owner == claims.UserID {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			managers.ErrorResponse(w, r, ErrNotOwner)
+		})
+	}
+}
+
+// UserSelf allows a user to act on their own /users/{id} record
+func (a *Authorizer) UserSelf(r *http.Request) ([]string, error) {
+	return []string{mux.Vars(r)["id"]}, nil
+}
+
+// HospitalOwners resolves the owner of /hospitals/{id}
+func (a *Authorizer) HospitalOwners(r *http.Request) ([]string, error) {
+	hospital, err := a.hu.GetHospitalById(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return nil, err
+	}
+	return []string{hospital.UserID.Hex()}, nil
+}
+
+// DoctorManagers resolves the doctor's linked user and the owner of their hospital for /doctors/{id}
+func (a *Authorizer) DoctorManagers(r *http.Request) ([]string, error) {
+	return a.doctorManagers(r.Context(), mux.Vars(r)["id"])
+}
+
+// HospitalManagersForDoctor resolves only the owner of the doctor's hospital for /doctors/{id}
+func (a *Authorizer) HospitalManagersForDoctor(r *http.Request) ([]string, error) {
+	doctor, err := a.du.FindDoctorById(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return nil, err
+	}
+	hospital, err := a.hu.GetHospitalById(r.Context(), doctor.HospitalID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	return []string{hospital.UserID.Hex()}, nil
+}
+
+// AppointmentParticipants resolves the patient, the doctor's user and the hospital owner for /appointments/{id}
+func (a *Authorizer) AppointmentParticipants(r *http.Request) ([]string, error) {
+	appointment, err := a.au.GetSingleAppointmentById(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	owners := []string{appointment.UserID.Hex()}
+	staff, err := a.doctorManagers(r.Context(), appointment.DoctorID.Hex())
+	if err == nil {
+		owners = append(owners, staff...)
+	}
+	return owners, nil
+}
+
+func (a *Authorizer) doctorManagers(ctx context.Context, doctorId string) ([]string, error) {
+	doctor, err := a.du.FindDoctorById(ctx, doctorId)
+	if err != nil {
+		return nil, err
+	}
+
+	var owners []string
+	if doctor.UserID != nil {
+		owners = append(owners, doctor.UserID.Hex())
+	}
+	if hospital, err := a.hu.GetHospitalById(ctx, doctor.HospitalID.Hex()); err == nil {
+		owners = append(owners, hospital.UserID.Hex())
+	}
+	return owners, nil
+}
+
+// loadRoles fetches the caller's current roles once per request, so role
+// changes (e.g. becoming a hospital owner) apply without a new token
+func (a *Authorizer) loadRoles(w http.ResponseWriter, r *http.Request) ([]utils.Roles, *http.Request, bool) {
+	if roles, ok := r.Context().Value(RolesContextKey).([]utils.Roles); ok {
+		return roles, r, true
+	}
+
+	claims := GetUserFromContext(r.Context())
+	if claims == nil {
+		managers.ErrorResponse(w, r, ErrNotAuthenticated)
+		return nil, r, false
+	}
+
+	// a valid token for a deleted account is an authentication failure, but a
+	// failed lookup is ours and must not read as one
+	user, err := a.uu.GetUserById(r.Context(), claims.UserID)
+	if err != nil {
+		if kind, _ := utils.ClassifyError(err); kind == utils.KindNotFound {
+			err = ErrAccountGone
+		}
+		managers.ErrorResponse(w, r, err)
+		return nil, r, false
+	}
+
+	ctx := context.WithValue(r.Context(), RolesContextKey, user.Roles)
+	return user.Roles, r.WithContext(ctx), true
+}
+
+// retrieving the caller's roles once an Authorizer middleware has loaded them
+func GetRolesFromContext(ctx context.Context) []utils.Roles {
+	if roles, ok := ctx.Value(RolesContextKey).([]utils.Roles); ok {
+		return roles
+	}
+	return nil
+}
@@ -36,10 +36,30 @@ type User struct {
 	Firstname string             `json:"firstname,omitempty" bson:"firstname,omitempty" validate:"required,min=2,max=100"`
 	LastName  string             `json:"lastname,omitempty" bson:"lastname,omitempty" validate:"required,min=2,max=100"`
 	Email     string             `json:"email,omitempty" bson:"email,omitempty" validate:"required,email"`
-	Password  string             `json:"password,omitempty" bson:"password,omitempty" validate:"required,min=6"`
-	Roles     []utils.Roles      `json:"roles,omitempty" bson:"roles,omitempty" validate:"required,min=1,dive,required,roles"`
-	CreatedAt time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
-	UpdatedAt time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	// the bcrypt hash; it never leaves the server
+	Password string `json:"-" bson:"password,omitempty" validate:"required,min=6"`
+	// granted by the server only, never taken from a request body
+	Roles []utils.Roles `json:"roles,omitempty" bson:"roles,omitempty" validate:"dive,required,roles"`
+	// set by the verify-email flow only; see usecases.ErrEmailNotVerified for
+	// what requires it
+	EmailVerified   bool       `json:"emailVerified" bson:"emailVerified"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty" bson:"emailVerifiedAt,omitempty"`
+	// set by the MFA enrolment flow only
+	MFA       *MFASettings `json:"mfa,omitempty" bson:"mfa,omitempty"`
+	CreatedAt time.Time    `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt time.Time    `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// MFASettings is a user's TOTP second factor. The secret is kept from the
+// start of enrolment, but only counts once Enabled is set by a confirmed code.
+type MFASettings struct {
+	Enabled   bool       `json:"enabled" bson:"enabled"`
+	EnabledAt *time.Time `json:"enabledAt,omitempty" bson:"enabledAt,omitempty"`
+	Secret    string     `json:"-" bson:"secret"`
+	// SHA-256 hashes of the unused recovery codes
+	RecoveryCodes []string `json:"-" bson:"recoveryCodes,omitempty"`
+	// the last TOTP time step accepted, so a code cannot be replayed
+	LastUsedStep int64 `json:"-" bson:"lastUsedStep"`
 }
 
 type Doctor struct {
@@ -61,6 +81,189 @@ type Appointment struct {
 	DoctorID   primitive.ObjectID `json:"doctorId,omitempty" bson:"doctorId,omitempty"`
 	Status     utils.Status       `json:"status,omitempty" bson:"status,omitempty"`
 	Reason     string             `json:"reason,omitempty" bson:"reason,omitempty" validate:"required,min=5,max=500"`
+	StartTime  time.Time          `json:"startTime" bson:"startTime" validate:"required"`
+	EndTime    time.Time          `json:"endTime" bson:"endTime" validate:"required,gtfield=StartTime"`
+	History    []StatusChange     `json:"history,omitempty" bson:"history,omitempty"`
 	CreatedAt  time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
 	UpdatedAt  time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
 }
+
+// UserPatch lists what a user may change about their own account; email,
+// password and roles go through their dedicated flows
+type UserPatch struct {
+	Firstname *string `json:"firstname" bson:"firstname" validate:"omitempty,min=2,max=100"`
+	LastName  *string `json:"lastname" bson:"lastname" validate:"omitempty,min=2,max=100"`
+}
+
+func (UserPatch) ImmutableFields() []string {
+	return []string{"_id", "email", "password", "roles", "emailVerified", "emailVerifiedAt", "mfa", "createdAt", "updatedAt"}
+}
+
+type HospitalPatch struct {
+	Name        *string            `json:"name" bson:"name" validate:"omitempty,min=2,max=100"`
+	Location    *LocationPatch     `json:"location" bson:"location" patch:"merge"`
+	Specialties *[]utils.Specialty `json:"specialties" bson:"specialties" validate:"omitempty,min=1,dive,required,specialties"`
+	Open        *bool              `json:"open" bson:"open" patch:"nullable"`
+	Description *string            `json:"description" bson:"description" patch:"nullable"`
+	Phone       *string            `json:"phone" bson:"phone" validate:"omitempty,e164"`
+	Email       *string            `json:"email" bson:"email" validate:"omitempty,email"`
+}
+
+func (HospitalPatch) ImmutableFields() []string {
+	return []string{"_id", "userId", "createdAt", "updatedAt"}
+}
+
+type LocationPatch struct {
+	Address *string   `json:"address" bson:"address" validate:"omitempty,min=1"`
+	Point   *GeoPoint `json:"point" bson:"point"`
+}
+
+type DoctorPatch struct {
+	Firstname   *string            `json:"firstname" bson:"firstname" validate:"omitempty,min=2,max=100"`
+	LastName    *string            `json:"lastname" bson:"lastname" validate:"omitempty,min=2,max=100"`
+	Specialties *[]utils.Specialty `json:"specialties" bson:"specialties" validate:"omitempty,min=1,dive,required,specialties"`
+}
+
+func (DoctorPatch) ImmutableFields() []string {
+	return []string{"_id", "hospitalId", "userId", "inviteStatus", "createdAt", "updatedAt"}
+}
+
+// AppointmentPatch only covers details; the schedule is fixed at booking and
+// status changes go through the transition endpoints
+type AppointmentPatch struct {
+	Reason *string `json:"reason" bson:"reason" validate:"omitempty,min=5,max=500"`
+}
+
+func (AppointmentPatch) ImmutableFields() []string {
+	return []string{"_id", "hospitalId", "userId", "doctorId", "status", "startTime", "endTime", "history", "createdAt", "updatedAt"}
+}
+
+// StatusChange is one entry in an appointment's audit trail
+type StatusChange struct {
+	From    utils.Status       `json:"from,omitempty" bson:"from,omitempty"`
+	To      utils.Status       `json:"to" bson:"to"`
+	ActorID primitive.ObjectID `json:"actorId" bson:"actorId"`
+	Reason  string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	At      time.Time          `json:"at" bson:"at"`
+}
+
+// TimeRange is a wall-clock range within a day in the doctor's timezone, e.g. 09:00-17:00
+type TimeRange struct {
+	Start string `json:"start" bson:"start" validate:"required,clock"`
+	End   string `json:"end" bson:"end" validate:"required,clock"`
+}
+
+// WeeklyHours holds the recurring working hours for one weekday (0 = Sunday)
+type WeeklyHours struct {
+	Weekday time.Weekday `json:"weekday" bson:"weekday" validate:"gte=0,lte=6"`
+	Hours   []TimeRange  `json:"hours" bson:"hours" validate:"required,min=1,dive"`
+	Breaks  []TimeRange  `json:"breaks,omitempty" bson:"breaks,omitempty" validate:"dive"`
+}
+
+// AvailabilityException overrides the weekly hours on a specific date
+type AvailabilityException struct {
+	Date        string      `json:"date" bson:"date" validate:"required,datetime=2006-01-02"`
+	Unavailable bool        `json:"unavailable,omitempty" bson:"unavailable,omitempty"`
+	Hours       []TimeRange `json:"hours,omitempty" bson:"hours,omitempty" validate:"required_without=Unavailable,dive"`
+	Breaks      []TimeRange `json:"breaks,omitempty" bson:"breaks,omitempty" validate:"dive"`
+}
+
+// DoctorAvailability is a doctor's schedule at one hospital
+type DoctorAvailability struct {
+	ID          primitive.ObjectID      `json:"_id,omitempty" bson:"_id,omitempty"`
+	DoctorID    primitive.ObjectID      `json:"doctorId,omitempty" bson:"doctorId,omitempty"`
+	HospitalID  primitive.ObjectID      `json:"hospitalId,omitempty" bson:"hospitalId,omitempty"`
+	Timezone    string                  `json:"timezone" bson:"timezone" validate:"required,timezone"`
+	SlotMinutes int                     `json:"slotMinutes" bson:"slotMinutes" validate:"required,min=5,max=480"`
+	Weekly      []WeeklyHours           `json:"weekly" bson:"weekly" validate:"dive"`
+	Exceptions  []AvailabilityException `json:"exceptions,omitempty" bson:"exceptions,omitempty" validate:"dive"`
+	CreatedAt   time.Time               `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt   time.Time               `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// Slot is a bookable window computed from a doctor's availability
+type Slot struct {
+	HospitalID primitive.ObjectID `json:"hospitalId"`
+	StartTime  time.Time          `json:"startTime"`
+	EndTime    time.Time          `json:"endTime"`
+}
+
+// DoctorInvite tracks an invitation for a user to claim a doctor profile.
+// Nonce changes on every re-send so only the latest emailed token is usable.
+type DoctorInvite struct {
+	ID          primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	DoctorID    primitive.ObjectID  `json:"doctorId" bson:"doctorId"`
+	HospitalID  primitive.ObjectID  `json:"hospitalId" bson:"hospitalId"`
+	Email       string              `json:"email" bson:"email" validate:"required,email"`
+	InvitedBy   primitive.ObjectID  `json:"invitedBy" bson:"invitedBy"`
+	Status      utils.InviteStatus  `json:"status" bson:"status"`
+	Nonce       string              `json:"-" bson:"nonce"`
+	ExpiresAt   time.Time           `json:"expiresAt" bson:"expiresAt"`
+	RespondedBy *primitive.ObjectID `json:"respondedBy,omitempty" bson:"respondedBy,omitempty"`
+	RespondedAt *time.Time          `json:"respondedAt,omitempty" bson:"respondedAt,omitempty"`
+	CreatedAt   time.Time           `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt   time.Time           `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// RefreshSession is the server-side record of an issued refresh token, keyed
+// by the token's jti. Rotating a token marks it rotated and links its
+// replacement; every token from one login shares a FamilyID.
+type RefreshSession struct {
+	ID         string             `json:"_id" bson:"_id"`
+	UserID     primitive.ObjectID `json:"userId" bson:"userId"`
+	FamilyID   string             `json:"familyId" bson:"familyId"`
+	ExpiresAt  time.Time          `json:"expiresAt" bson:"expiresAt"`
+	RotatedAt  *time.Time         `json:"rotatedAt,omitempty" bson:"rotatedAt,omitempty"`
+	ReplacedBy string             `json:"replacedBy,omitempty" bson:"replacedBy,omitempty"`
+	RevokedAt  *time.Time         `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// RevokedToken is an entry in the token revocation list. Kind "token" revokes
+// one jti; kind "user" revokes every token issued to UserID before RevokedBefore.
+type RevokedToken struct {
+	ID            string             `json:"_id" bson:"_id"`
+	Kind          string             `json:"kind" bson:"kind"`
+	UserID        primitive.ObjectID `json:"userId" bson:"userId"`
+	RevokedBefore time.Time          `json:"revokedBefore,omitempty" bson:"revokedBefore,omitempty"`
+	ExpiresAt     time.Time          `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// LoginAttempts counts recent failed logins for one account or client IP. The
+// _id is "account:<email>" or "ip:<address>" so unknown emails are tracked too.
+type LoginAttempts struct {
+	ID          string    `json:"_id" bson:"_id"`
+	Failures    int       `json:"failures" bson:"failures"`
+	LockedUntil time.Time `json:"lockedUntil,omitempty" bson:"lockedUntil,omitempty"`
+	LastFailure time.Time `json:"lastFailure" bson:"lastFailure"`
+	ExpiresAt   time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// UserToken is a single-use token emailed to a user. Only the SHA-256 hash of
+// the token is stored.
+type UserToken struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Purpose   utils.TokenPurpose `json:"purpose" bson:"purpose"`
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time         `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// NearbyHospitalQuery describes a "hospitals near me" search
+type NearbyHospitalQuery struct {
+	Longitude float64         `validate:"gte=-180,lte=180"`
+	Latitude  float64         `validate:"gte=-90,lte=90"`
+	RadiusKm  float64         `validate:"gt=0,lte=200"`
+	Specialty utils.Specialty `validate:"omitempty,specialties"`
+	OpenOnly  bool
+	Limit     int64 `validate:"gte=1,lte=100"`
+}
+
+// NearbyHospital is a hospital with its distance from the search point
+type NearbyHospital struct {
+	Hospital   `bson:",inline"`
+	DistanceKm float64 `json:"distanceKm" bson:"distanceKm"`
+}
@@ -0,0 +1,71 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Ping checks that the primary is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	return c.Client.Ping(ctx, readpref.Primary())
+}
+
+// CheckTransactions reports an error unless the deployment supports
+// multi-document transactions, which booking an appointment needs: a replica
+// set (a single node is enough) or a sharded cluster, not a standalone mongod
+func (c *Client) CheckTransactions(ctx context.Context) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := c.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("could not describe the deployment: %w", err)
+	}
+	// mongos answers with msg "isdbgrid"
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return fmt.Errorf("mongo is a standalone server; transactions need a replica set, e.g. mongod --replSet rs0 followed by rs.initiate()")
+	}
+	return nil
+}
+
+// CheckIndexes reports an error naming every index from ExpectedIndexes that
+// does not exist in dbName
+func (c *Client) CheckIndexes(ctx context.Context, dbName string) error {
+	db := c.Client.Database(dbName)
+
+	var missing []string
+	for collection, names := range ExpectedIndexes {
+		cursor, err := db.Collection(collection).Indexes().List(ctx)
+		if err != nil {
+			return fmt.Errorf("could not list %s indexes: %w", collection, err)
+		}
+
+		var specs []struct {
+			Name string `bson:"name"`
+		}
+		if err := cursor.All(ctx, &specs); err != nil {
+			return fmt.Errorf("could not read %s indexes: %w", collection, err)
+		}
+
+		existing := make(map[string]bool, len(specs))
+		for _, spec := range specs {
+			existing[spec.Name] = true
+		}
+		for _, name := range names {
+			if !existing[name] {
+				missing = append(missing, collection+"."+name)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing indexes: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// schema bookkeeping collections
+const (
+	migrationCollection     = "schema_migrations"
+	migrationLockCollection = "schema_migrations_lock"
+	migrationLockID         = "migrate"
+	// a runner that dies without unlocking blocks others at most this long;
+	// a live runner renews the lease while it works
+	migrationLockLease = time.Minute
+	// how often a waiting runner checks whether the lock is free
+	migrationLockPoll = time.Second
+)
+
+// Migration is one versioned schema change. Migrations run in ascending
+// Version order, once per database. A migration that has shipped must not be
+// edited; change the schema again with a new version instead.
+type Migration struct {
+	Version int
+	Name    string
+	// Indexes to create, per collection; every index must be named
+	Indexes map[string][]mongo.IndexModel
+	// Up makes any change Indexes cannot express and runs after them; optional
+	Up func(ctx context.Context, db *mongo.Database) error
+}
+
+// AppliedMigration is a migration's record in schema_migrations
+type AppliedMigration struct {
+	Version    int       `bson:"_id"`
+	Name       string    `bson:"name"`
+	AppliedAt  time.Time `bson:"appliedAt"`
+	DurationMs int64     `bson:"durationMs"`
+}
+
+// Migrate applies every pending migration in order. It holds a lock while it
+// works, so runners started together (e.g. several replicas) wait for each
+// other and the later ones find nothing left to do. It returns the
+// migrations it applied.
+func (c *Client) Migrate(ctx context.Context, dbName string) ([]Migration, error) {
+	m, err := newMigrator(c.Client.Database(dbName), Migrations)
+	if err != nil {
+		return nil, err
+	}
+	return m.up(ctx)
+}
+
+// MigrationStatus lists the applied migrations and the ones still pending
+func (c *Client) MigrationStatus(ctx context.Context, dbName string) ([]AppliedMigration, []Migration, error) {
+	m, err := newMigrator(c.Client.Database(dbName), Migrations)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return applied, m.pending(applied), nil
+}
+
+// CheckSchema reports an error naming the pending migrations, if any
+func (c *Client) CheckSchema(ctx context.Context, dbName string) error {
+	_, pending, err := c.MigrationStatus(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		names := make([]string, len(pending))
+		for i, migration := range pending {
+			names[i] = migration.String()
+		}
+		return fmt.Errorf("pending migrations: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+type migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+	// identifies this runner in the lock document
+	owner string
+}
+
+func newMigrator(db *mongo.Database, migrations []Migration) (*migrator, error) {
+	if err := validateMigrations(migrations); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	return &migrator{
+		db:         db,
+		migrations: migrations,
+		owner:      fmt.Sprintf("%s/%d/%s", host, os.Getpid(), primitive.NewObjectID().Hex()),
+	}, nil
+}
+
+// validateMigrations checks versions are unique and ascending and that every
+// index is named, since readiness looks indexes up by name
+func validateMigrations(migrations []Migration) error {
+	for i, migration := range migrations {
+		if migration.Version <= 0 {
+			return fmt.Errorf("migration %s: version must be positive", migration)
+		}
+		if i > 0 && migration.Version <= migrations[i-1].Version {
+			return fmt.Errorf("migration %s: versions must be unique and ascending", migration)
+		}
+		for collection, indexes := range migration.Indexes {
+			for _, index := range indexes {
+				if index.Options == nil || index.Options.Name == nil || *index.Options.Name == "" {
+					return fmt.Errorf("migration %s: every %s index needs a name", migration, collection)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *migrator) up(ctx context.Context) ([]Migration, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	// losing the lease means another runner may start, so stop as soon as
+	// a renewal fails
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go m.renew(runCtx, cancel)
+
+	applied, err := m.applied(runCtx)
+	if err != nil {
+		return nil, err
+	}
+	m.warnUnknown(applied)
+
+	var done []Migration
+	for _, migration := range m.pending(applied) {
+		slog.Info("Applying migration", "migration", migration.String())
+		start := time.Now()
+
+		if err := m.apply(runCtx, migration); err != nil {
+			if cause := context.Cause(runCtx); cause != nil && !errors.Is(cause, ctx.Err()) {
+				err = cause
+			}
+			return done, fmt.Errorf("migration %s failed: %w", migration, err)
+		}
+
+		record := AppliedMigration{
+			Version:    migration.Version,
+			Name:       migration.Name,
+			AppliedAt:  time.Now().UTC(),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if _, err := m.db.Collection(migrationCollection).InsertOne(runCtx, record); err != nil {
+			return done, fmt.Errorf("could not record migration %s: %w", migration, err)
+		}
+		slog.Info("Migration applied", "migration", migration.String(), "duration_ms", record.DurationMs)
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// apply creates the migration's indexes and runs its Up step. Index creation
+// is idempotent, so a migration that failed half way can simply run again.
+func (m *migrator) apply(ctx context.Context, migration Migration) error {
+	collections := make([]string, 0, len(migration.Indexes))
+	for collection := range migration.Indexes {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		if _, err := m.db.Collection(collection).Indexes().CreateMany(ctx, migration.Indexes[collection]); err != nil {
+			return fmt.Errorf("could not create %s indexes: %w", collection, err)
+		}
+	}
+
+	if migration.Up != nil {
+		return migration.Up(ctx, m.db)
+	}
+	return nil
+}
+
+func (m *migrator) applied(ctx context.Context) ([]AppliedMigration, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := m.db.Collection(migrationCollection).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not read applied migrations: %w", err)
+	}
+	var applied []AppliedMigration
+	if err := cursor.All(ctx, &applied); err != nil {
+		return nil, fmt.Errorf("could not read applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+func (m *migrator) pending(applied []AppliedMigration) []Migration {
+	done := make(map[int]bool, len(applied))
+	for _, record := range applied {
+		done[record.Version] = true
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if !done[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+// warnUnknown logs versions recorded by a newer build, e.g. during a rollback
+func (m *migrator) warnUnknown(applied []AppliedMigration) {
+	known := make(map[int]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+	}
+	for _, record := range applied {
+		if !known[record.Version] {
+			slog.Warn("Database has a migration this build does not know", "version", record.Version, "name", record.Name)
+		}
+	}
+}
+
+// lock waits until this runner holds the migration lock or ctx is done
+func (m *migrator) lock(ctx context.Context) error {
+	for {
+		ok, err := m.tryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		slog.Info("Waiting for another migration runner to finish")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not acquire the migration lock: %w", ctx.Err())
+		case <-time.After(migrationLockPoll):
+		}
+	}
+}
+
+// tryLock takes the lock if it is free or its lease has run out. When
+// someone else holds it the filter matches nothing and the upsert collides
+// with their document on _id.
+func (m *migrator) tryLock(ctx context.Context) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": migrationLockID,
+		"$or": bson.A{
+			bson.M{"lockedUntil": bson.M{"$lt": now}},
+			bson.M{"owner": m.owner},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"owner":       m.owner,
+		"lockedAt":    now,
+		"lockedUntil": now.Add(migrationLockLease),
+	}}
+
+	_, err := m.db.Collection(migrationLockCollection).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not take the migration lock: %w", err)
+	}
+	return true, nil
+}
+
+// renew extends the lease until ctx is done, cancelling it if the lock is lost
+func (m *migrator) renew(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(migrationLockLease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			res, err := m.db.Collection(migrationLockCollection).UpdateOne(ctx,
+				bson.M{"_id": migrationLockID, "owner": m.owner},
+				bson.M{"$set": bson.M{"lockedUntil": time.Now().Add(migrationLockLease)}},
+			)
+			if err != nil && ctx.Err() == nil {
+				cancel(fmt.Errorf("could not renew the migration lock: %w", err))
+				return
+			}
+			if err == nil && res.MatchedCount == 0 {
+				cancel(errors.New("lost the migration lock"))
+				return
+			}
+		}
+	}
+}
+
+// unlock releases the lock; it runs even when ctx has been cancelled
+func (m *migrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := m.db.Collection(migrationLockCollection).DeleteOne(ctx, bson.M{"_id": migrationLockID, "owner": m.owner}); err != nil {
+		slog.Error("Could not release the migration lock", "error", err)
+	}
+}
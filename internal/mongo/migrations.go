@@ -0,0 +1,207 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migrations is the schema history, oldest first. Append new versions to the
+// end; never edit or reorder one that has shipped.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_indexes",
+		Indexes: map[string][]mongo.IndexModel{
+			"users": {
+				{
+					Keys:    bson.D{{Key: "email", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("unique_email_idx"),
+				},
+			},
+			"appointments": {
+				{
+					Keys:    bson.D{{Key: "doctorId", Value: 1}, {Key: "startTime", Value: 1}, {Key: "endTime", Value: 1}},
+					Options: options.Index().SetName("doctor_time_window_idx"),
+				},
+				{
+					Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "startTime", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("user_start_time_idx"),
+				},
+			},
+			"doctors": {
+				{
+					Keys:    bson.D{{Key: "hospitalId", Value: 1}, {Key: "lastname", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("hospital_lastname_idx"),
+				},
+			},
+			"hospitals": {
+				{
+					Keys:    bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("name_idx"),
+				},
+			},
+			"doctor_availability": {
+				{
+					Keys:    bson.D{{Key: "doctorId", Value: 1}, {Key: "hospitalId", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("doctor_hospital_availability_idx"),
+				},
+			},
+			"doctor_invites": {
+				{
+					Keys:    bson.D{{Key: "doctorId", Value: 1}, {Key: "status", Value: 1}},
+					Options: options.Index().SetName("doctor_invite_status_idx"),
+				},
+			},
+			"refresh_sessions": {
+				{
+					Keys:    bson.D{{Key: "familyId", Value: 1}},
+					Options: options.Index().SetName("session_family_idx"),
+				},
+				{
+					Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+					Options: options.Index().SetExpireAfterSeconds(0).SetName("session_expiry_ttl_idx"),
+				},
+			},
+			"revoked_tokens": {
+				{
+					Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+					Options: options.Index().SetExpireAfterSeconds(0).SetName("revocation_expiry_ttl_idx"),
+				},
+			},
+			"user_tokens": {
+				{
+					Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("user_token_hash_idx"),
+				},
+				{
+					Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+					Options: options.Index().SetExpireAfterSeconds(0).SetName("user_token_expiry_ttl_idx"),
+				},
+			},
+			"login_attempts": {
+				{
+					Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+					Options: options.Index().SetExpireAfterSeconds(0).SetName("login_attempt_expiry_ttl_idx"),
+				},
+			},
+		},
+	},
+	{
+		// used to be created by NewHospitalRepository; $geoNear needs it
+		Version: 2,
+		Name:    "hospital_location_index",
+		Indexes: map[string][]mongo.IndexModel{
+			"hospitals": {
+				{
+					Keys:    bson.D{{Key: "location.point", Value: "2dsphere"}},
+					Options: options.Index().SetName("location_point_idx"),
+				},
+			},
+		},
+	},
+	{
+		// the appointment lists page by (startTime, _id) within a doctor, a
+		// hospital or across everything
+		Version: 3,
+		Name:    "appointment_list_indexes",
+		Indexes: map[string][]mongo.IndexModel{
+			"appointments": {
+				{
+					Keys:    bson.D{{Key: "doctorId", Value: 1}, {Key: "startTime", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("doctor_start_time_idx"),
+				},
+				{
+					Keys:    bson.D{{Key: "hospitalId", Value: 1}, {Key: "startTime", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("hospital_start_time_idx"),
+				},
+				{
+					Keys:    bson.D{{Key: "startTime", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("start_time_idx"),
+				},
+			},
+		},
+	},
+	{
+		// appointments from before the status lifecycle still say waiting,
+		// ongoing or done, which no transition starts from
+		Version: 4,
+		Name:    "appointment_lifecycle_statuses",
+		Up:      migrateLegacyAppointmentStatuses,
+	},
+}
+
+// legacyAppointmentStatuses maps the statuses clients used to send on booking
+// to the lifecycle ones. Bookings could also leave the status out, those are
+// treated as booked.
+var legacyAppointmentStatuses = []struct {
+	from []interface{}
+	to   utils.Status
+}{
+	{from: []interface{}{"waiting", "", nil}, to: utils.BOOKED},
+	{from: []interface{}{"ongoing"}, to: utils.IN_PROGRESS},
+	{from: []interface{}{"done"}, to: utils.COMPLETED},
+}
+
+// migrateLegacyAppointmentStatuses renames the old statuses and, where an
+// appointment has no history yet, seeds one: booked by the patient when the
+// appointment was created, then a system entry for any later status
+func migrateLegacyAppointmentStatuses(ctx context.Context, db *mongo.Database) error {
+	appointments := db.Collection("appointments")
+
+	for _, legacy := range legacyAppointmentStatuses {
+		history := bson.A{bson.D{
+			{Key: "to", Value: utils.BOOKED},
+			{Key: "actorId", Value: "$userId"},
+			{Key: "at", Value: bson.M{"$ifNull": bson.A{"$createdAt", "$startTime"}}},
+		}}
+		if legacy.to != utils.BOOKED {
+			history = append(history, bson.D{
+				{Key: "from", Value: utils.BOOKED},
+				{Key: "to", Value: legacy.to},
+				// nobody is known to have made the change
+				{Key: "actorId", Value: primitive.NilObjectID},
+				{Key: "reason", Value: fmt.Sprintf("migrated from legacy status %q", legacy.from[0])},
+				{Key: "at", Value: bson.M{"$ifNull": bson.A{"$updatedAt", bson.M{"$ifNull": bson.A{"$createdAt", "$startTime"}}}}},
+			})
+		}
+
+		// an update pipeline, so the seeded history can read the document
+		update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"status": legacy.to,
+			"history": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$history", bson.A{}}}}, 0}},
+				"$history",
+				history,
+			}},
+		}}}}
+
+		if _, err := appointments.UpdateMany(ctx, bson.M{"status": bson.M{"$in": legacy.from}}, update); err != nil {
+			return fmt.Errorf("could not migrate %v appointments: %w", legacy.from[0], err)
+		}
+	}
+	return nil
+}
+
+// ExpectedIndexes names the indexes the migrations build per collection, so
+// readiness can tell when one is missing
+var ExpectedIndexes = expectedIndexes(Migrations)
+
+func expectedIndexes(migrations []Migration) map[string][]string {
+	expected := make(map[string][]string)
+	for _, migration := range migrations {
+		for collection, indexes := range migration.Indexes {
+			for _, index := range indexes {
+				if index.Options != nil && index.Options.Name != nil {
+					expected[collection] = append(expected[collection], *index.Options.Name)
+				}
+			}
+		}
+	}
+	return expected
+}
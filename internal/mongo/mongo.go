@@ -3,8 +3,10 @@ package mongo
 import (
 	"context"
 	"fmt"
-	"log"
-	"time"
+	"log/slog"
+
+	"github/Chidi-creator/go-medic-server/config"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -17,18 +19,18 @@ type Client struct {
 
 //New client created a new MongoDB client wrapper
 
-func NewClient(uri string, dbName string) (*Client, error) {
-	log.Println("Connecting to MongoDB...")
+func NewClient(cfg config.MongoConfig) (*Client, error) {
+	slog.Info("Connecting to MongoDB...")
 
-	if uri == "" {
+	if cfg.URI == "" {
 		return nil, fmt.Errorf("MongoDB URI is required")
 
 	}
-	// Increase the context timeout for initial connection
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// the initial connection gets both the connect and server selection budget
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout+cfg.ServerSelectionTimeout)
 	defer cancel()
 
-	clientOptions := options.Client().ApplyURI(uri).SetConnectTimeout(10 * time.Second).SetServerSelectionTimeout(15 * time.Second).SetMaxPoolSize(100).SetRetryWrites(true).SetRetryReads(true)
+	clientOptions := options.Client().ApplyURI(cfg.URI).SetConnectTimeout(cfg.ConnectTimeout).SetServerSelectionTimeout(cfg.ServerSelectionTimeout).SetMaxPoolSize(cfg.MaxPoolSize).SetRetryWrites(true).SetRetryReads(true).SetPoolMonitor(metrics.PoolMonitor())
 
 	//connect to mongo db
 	client, err := mongo.Connect(ctx, clientOptions)
@@ -38,7 +40,7 @@ func NewClient(uri string, dbName string) (*Client, error) {
 	}
 
 	// Create a separate context for ping to avoid timeout issues
-	pingCtx, pingCancel := context.WithTimeout(context.Background(), 15*time.Second)
+	pingCtx, pingCancel := context.WithTimeout(context.Background(), cfg.ServerSelectionTimeout)
 	defer pingCancel()
 
 	// Ping the database to verify connection
@@ -49,3 +51,9 @@ func NewClient(uri string, dbName string) (*Client, error) {
 	return &Client{Client: client}, nil
 
 }
+
+// Disconnect closes the pool once in-flight operations finish or ctx expires
+func (c *Client) Disconnect(ctx context.Context) error {
+	slog.Info("Disconnecting from MongoDB...")
+	return c.Client.Disconnect(ctx)
+}
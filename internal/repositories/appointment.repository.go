@@ -2,9 +2,12 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/logger"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
 	"github/Chidi-creator/go-medic-server/internal/models"
-	"log"
+	"github/Chidi-creator/go-medic-server/internal/utils"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,125 +19,163 @@ import (
 type AppointmentRepository interface {
 	CreateAppointment(ctx context.Context, details *models.Appointment) (*models.Appointment, error)
 	GetSingleAppointmentById(ctx context.Context, id string) (*models.Appointment, error)
-	GetAppointmentsByDoctorId(ctx context.Context, id string) ([]models.Appointment, error)
-	GetAppointmentsByUserId(ctx context.Context, id string) ([]models.Appointment, error)
-	GetAppointmentsByQuery(ctx context.Context, filter bson.M) ([]models.Appointment, error)
-	UpdateAppointmentById(ctx context.Context, id string, updateQuery bson.M) (*models.Appointment, error)
+	GetAppointmentsByDoctorId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error)
+	GetAppointmentsByUserId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error)
+	GetDoctorAppointmentsInRange(ctx context.Context, id string, from, to time.Time) ([]models.Appointment, error)
+	GetAppointmentsByQuery(ctx context.Context, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error)
+	UpdateAppointmentById(ctx context.Context, id string, update bson.M) (*models.Appointment, error)
+	ChangeAppointmentStatus(ctx context.Context, id primitive.ObjectID, from []utils.Status, change models.StatusChange) (*models.Appointment, error)
 	DeleteAppointmentById(ctx context.Context, id string) (int64, error)
 }
+
+// ErrAppointmentConflict is returned when a booking overlaps an existing
+// non-cancelled appointment for the same doctor
+var ErrAppointmentConflict = utils.Conflict("appointment_conflict", "doctor already has an appointment in this time window")
+
+// ErrAppointmentStateChanged is returned when an appointment is no longer in
+// the status a transition expected, e.g. because of a concurrent update
+var ErrAppointmentStateChanged = utils.Conflict("appointment_state_changed", "appointment status has changed")
+
 type appointmentRepository struct {
-	client     *mongo.Client
-	dbName     string
+	db         Database
 	collection string
 }
 
-func NewAppointmentRepository(client *mongo.Client, dbName string, collection string) AppointmentRepository {
+func NewAppointmentRepository(db Database, collection string) AppointmentRepository {
 	return &appointmentRepository{
-		client:     client,
-		dbName:     dbName,
+		db:         db,
 		collection: collection,
 	}
 }
 
 func (a *appointmentRepository) CreateAppointment(ctx context.Context, details *models.Appointment) (*models.Appointment, error) {
+	defer metrics.ObserveMongo("appointment", "CreateAppointment")()
 
 	details.CreatedAt = time.Now()
 	details.UpdatedAt = time.Now()
 
-	collection := a.client.Database(a.dbName).Collection(a.collection)
+	collection := a.db.Collection(a.collection)
+	locks := a.db.Collection(a.collection + "_locks")
+
+	// bumping the doctor's lock document makes concurrent bookings for the same
+	// doctor write-conflict, so only one of them can commit; the driver retries
+	// the loser, which then sees the winner's appointment in the overlap check
+	err := a.db.WithTransaction(ctx, func(ctx context.Context) error {
+		lockOpts := options.Update().SetUpsert(true)
+		_, err := locks.UpdateOne(ctx, bson.M{"_id": details.DoctorID}, bson.M{
+			"$inc": bson.M{"version": 1},
+			"$set": bson.M{"updatedAt": time.Now()},
+		}, lockOpts)
+		if err != nil {
+			return fmt.Errorf("could not lock doctor schedule: %w", err)
+		}
+
+		count, err := collection.CountDocuments(ctx, overlapFilter(details.DoctorID, details.StartTime, details.EndTime))
+		if err != nil {
+			return fmt.Errorf("could not check for overlapping appointments: %w", err)
+		}
+		if count > 0 {
+			return ErrAppointmentConflict
+		}
 
-	appointment, err := collection.InsertOne(ctx, details)
+		appointment, err := collection.InsertOne(ctx, details)
+		if err != nil {
+			return fmt.Errorf("error creating appointment: %w", err)
+		}
+		details.ID = appointment.InsertedID.(primitive.ObjectID)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error creating appointment: %w", err)
+		return nil, err
 	}
-	details.ID = appointment.InsertedID.(primitive.ObjectID)
 
 	return details, nil
 }
 
+// overlapFilter matches non-cancelled appointments of a doctor whose window
+// intersects [start, end)
+func overlapFilter(doctorID primitive.ObjectID, start, end time.Time) bson.M {
+	return bson.M{
+		"doctorId":  doctorID,
+		"status":    bson.M{"$ne": utils.CANCELLED},
+		"startTime": bson.M{"$lt": end},
+		"endTime":   bson.M{"$gt": start},
+	}
+}
+
 func (a *appointmentRepository) GetSingleAppointmentById(ctx context.Context, id string) (*models.Appointment, error) {
-	_id, err := primitive.ObjectIDFromHex(id)
+	defer metrics.ObserveMongo("appointment", "GetSingleAppointmentById")()
+	_id, err := parseID(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid id: %w", err)
+		return nil, err
 	}
 	filter := bson.M{"_id": _id}
-	collection := a.client.Database(a.dbName).Collection(a.collection)
+	collection := a.db.Collection(a.collection)
 
 	var appointment models.Appointment
 	err = collection.FindOne(ctx, filter).Decode(&appointment)
 
 	if err != nil {
-		return nil, fmt.Errorf("could not find appointment")
+		return nil, findErr(err, ErrAppointmentNotFound, "could not find appointment")
 	}
 	return &appointment, nil
 
 }
 
-func (a *appointmentRepository) GetAppointmentsByDoctorId(ctx context.Context, id string) ([]models.Appointment, error) {
-	_id, err := primitive.ObjectIDFromHex(id)
+func (a *appointmentRepository) GetAppointmentsByDoctorId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error) {
+	defer metrics.ObserveMongo("appointment", "GetAppointmentsByDoctorId")()
+	_id, err := parseID(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid id: %w", err)
+		return nil, nil, err
 	}
-	filter := bson.M{"_id": _id}
-	collection := a.client.Database(a.dbName).Collection(a.collection)
-	cur, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("could not find appointment with ID %v: %w", id, err)
-	}
-	defer cur.Close(ctx)
-	var appointments []models.Appointment
+	page.Filter["doctorId"] = _id
 
-	for cur.Next(ctx) {
-		var appointment models.Appointment
-		err := cur.Decode(&appointment)
-		if err != nil {
-			return nil, fmt.Errorf("cursor error")
-		}
-		appointments = append(appointments, appointment)
-	}
+	collection := a.db.Collection(a.collection)
 
-	return appointments, nil
+	appointments, info, err := findPage[models.Appointment](ctx, collection, page)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not find appointments for doctor %v: %w", id, err)
+	}
+	return appointments, info, nil
 }
 
-func (a *appointmentRepository) GetAppointmentsByUserId(ctx context.Context, id string) ([]models.Appointment, error) {
-	_id, err := primitive.ObjectIDFromHex(id)
+func (a *appointmentRepository) GetAppointmentsByUserId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error) {
+	defer metrics.ObserveMongo("appointment", "GetAppointmentsByUserId")()
+	_id, err := parseID(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid id: %w", err)
+		return nil, nil, err
 	}
-	filter := bson.M{"_id": _id}
-	collection := a.client.Database(a.dbName).Collection(a.collection)
+	page.Filter["userId"] = _id
 
-	cur, err := collection.Find(ctx, filter)
+	collection := a.db.Collection(a.collection)
+
+	appointments, info, err := findPage[models.Appointment](ctx, collection, page)
 	if err != nil {
-		return nil, fmt.Errorf("could not find appointment with ID %v: %w", id, err)
+		return nil, nil, fmt.Errorf("could not find appointments for user %v: %w", id, err)
 	}
-	defer cur.Close(ctx)
+	return appointments, info, nil
+}
 
-	var appointments []models.Appointment
-	for cur.Next(ctx) {
-		var appointment models.Appointment
-		err := cur.Decode(&appointment)
-		if err != nil {
-			return nil, fmt.Errorf("cursor error: %w", err)
-		}
-		appointments = append(appointments, appointment)
+// returns the doctor's non-cancelled appointments that overlap [from, to)
+func (a *appointmentRepository) GetDoctorAppointmentsInRange(ctx context.Context, id string, from, to time.Time) ([]models.Appointment, error) {
+	defer metrics.ObserveMongo("appointment", "GetDoctorAppointmentsInRange")()
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
 	}
-	return appointments, nil
-}
+	opts := options.Find().SetSort(bson.D{{Key: "startTime", Value: 1}})
+	collection := a.db.Collection(a.collection)
 
-func (a *appointmentRepository) FindAppointments(ctx context.Context, filter bson.M) ([]models.Appointment, error) {
-	collection := a.client.Database(a.dbName).Collection(a.collection)
-	cur, err := collection.Find(ctx, filter)
+	cur, err := collection.Find(ctx, overlapFilter(_id, from, to), opts)
 	if err != nil {
-		return nil, fmt.Errorf("could not find appointments: %w", err)
+		return nil, fmt.Errorf("could not find appointments for doctor %v: %w", id, err)
 	}
 	defer cur.Close(ctx)
 
 	var appointments []models.Appointment
 	for cur.Next(ctx) {
 		var appointment models.Appointment
-		err := cur.Decode(&appointment)
-		if err != nil {
+		if err := cur.Decode(&appointment); err != nil {
 			return nil, fmt.Errorf("cursor error: %w", err)
 		}
 		appointments = append(appointments, appointment)
@@ -142,38 +183,64 @@ func (a *appointmentRepository) FindAppointments(ctx context.Context, filter bso
 	return appointments, nil
 }
 
-func (a *appointmentRepository) UpdateAppointmentById(ctx context.Context, id string, updateQuery bson.M) (*models.Appointment, error) {
-	_id, err := primitive.ObjectIDFromHex(id)
+// UpdateAppointmentById applies a full update document, e.g. {"$set": {...}}
+func (a *appointmentRepository) UpdateAppointmentById(ctx context.Context, id string, update bson.M) (*models.Appointment, error) {
+	defer metrics.ObserveMongo("appointment", "UpdateAppointmentById")()
+	_id, err := parseID(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid id: %w", err)
+		return nil, err
 	}
 	filter := bson.M{"_id": _id}
-	updateQuery["updatedAt"] = time.Now()
-
-	update := bson.M{"$set": updateQuery}
 
 	var updatedResult models.Appointment
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
-	collection := a.client.Database(a.dbName).Collection(a.collection)
+	collection := a.db.Collection(a.collection)
 
-	err = collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedResult)
+	err = collection.FindOneAndUpdate(ctx, filter, withUpdatedAt(update), opts).Decode(&updatedResult)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find hospitals: %w", err)
+		return nil, findErr(err, ErrAppointmentNotFound, "could not update appointment")
 	}
 
 	return &updatedResult, nil
 
 }
 
+// ChangeAppointmentStatus moves the appointment to change.To and records the
+// change, only if it is still in one of the from statuses
+func (a *appointmentRepository) ChangeAppointmentStatus(ctx context.Context, id primitive.ObjectID, from []utils.Status, change models.StatusChange) (*models.Appointment, error) {
+	defer metrics.ObserveMongo("appointment", "ChangeAppointmentStatus")()
+	filter := bson.M{"_id": id, "status": bson.M{"$in": from}}
+	update := bson.M{
+		"$set":  bson.M{"status": change.To, "updatedAt": change.At},
+		"$push": bson.M{"history": change},
+	}
+
+	var updated models.Appointment
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	collection := a.db.Collection(a.collection)
+
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAppointmentStateChanged
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not change appointment status: %w", err)
+	}
+
+	return &updated, nil
+}
+
 func (a *appointmentRepository) DeleteAppointmentById(ctx context.Context, id string) (int64, error) {
-	_id, err := primitive.ObjectIDFromHex(id)
+	defer metrics.ObserveMongo("appointment", "DeleteAppointmentById")()
+	_id, err := parseID(id)
 	if err != nil {
-		return 0, fmt.Errorf("invalid id: %w", err)
+		return 0, err
 	}
 	filter := bson.M{"_id": _id}
 
-	collection := a.client.Database(a.dbName).Collection(a.collection)
+	collection := a.db.Collection(a.collection)
 
 	res, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
@@ -181,32 +248,19 @@ func (a *appointmentRepository) DeleteAppointmentById(ctx context.Context, id st
 	}
 
 	if res.DeletedCount == 0 {
-		log.Println("No record was deleted")
+		logger.FromContext(ctx).Info("No appointment was deleted", "appointment_id", id)
 	}
 
 	return res.DeletedCount, err
 }
 
-func (a *appointmentRepository) GetAppointmentsByQuery(ctx context.Context, filter bson.M) ([]models.Appointment, error) {
-	collection := a.client.Database(a.dbName).Collection(a.collection)
+func (a *appointmentRepository) GetAppointmentsByQuery(ctx context.Context, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error) {
+	defer metrics.ObserveMongo("appointment", "GetAppointmentsByQuery")()
+	collection := a.db.Collection(a.collection)
 
-	cur, err := collection.Find(ctx, filter)
+	appointments, info, err := findPage[models.Appointment](ctx, collection, page)
 	if err != nil {
-		return nil, fmt.Errorf("could not find appointments: %w", err)
+		return nil, nil, fmt.Errorf("could not find appointments: %w", err)
 	}
-	defer cur.Close(ctx)
-
-	var appointments []models.Appointment
-	for cur.Next(ctx) {
-		var appointment models.Appointment
-		err := cur.Decode(&appointment)
-		if err != nil {
-			return nil, fmt.Errorf("cursor error: %w", err)
-		}
-		appointments = append(appointments, appointment)
-	}
-
-	return appointments, nil
+	return appointments, info, nil
 }
-
-
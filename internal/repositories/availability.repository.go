@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AvailabilityRepository interface {
+	UpsertAvailability(ctx context.Context, availability *models.DoctorAvailability) (*models.DoctorAvailability, error)
+	GetAvailabilityByDoctorId(ctx context.Context, id string) ([]models.DoctorAvailability, error)
+}
+
+type availabilityRepository struct {
+	db         Database
+	collection string
+}
+
+func NewAvailabilityRepository(db Database, collection string) AvailabilityRepository {
+	return &availabilityRepository{
+		db:         db,
+		collection: collection,
+	}
+}
+
+// a doctor has at most one schedule per hospital, so saving replaces it
+func (a *availabilityRepository) UpsertAvailability(ctx context.Context, availability *models.DoctorAvailability) (*models.DoctorAvailability, error) {
+	defer metrics.ObserveMongo("availability", "UpsertAvailability")()
+	collection := a.db.Collection(a.collection)
+
+	now := time.Now()
+	filter := bson.M{"doctorId": availability.DoctorID, "hospitalId": availability.HospitalID}
+	update := bson.M{
+		"$set": bson.M{
+			"timezone":    availability.Timezone,
+			"slotMinutes": availability.SlotMinutes,
+			"weekly":      availability.Weekly,
+			"exceptions":  availability.Exceptions,
+			"updatedAt":   now,
+		},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var saved models.DoctorAvailability
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved)
+	if err != nil {
+		return nil, fmt.Errorf("could not save availability: %w", err)
+	}
+
+	return &saved, nil
+}
+
+func (a *availabilityRepository) GetAvailabilityByDoctorId(ctx context.Context, id string) ([]models.DoctorAvailability, error) {
+	defer metrics.ObserveMongo("availability", "GetAvailabilityByDoctorId")()
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	collection := a.db.Collection(a.collection)
+
+	cur, err := collection.Find(ctx, bson.M{"doctorId": _id})
+	if err != nil {
+		return nil, fmt.Errorf("could not find availability: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var schedules []models.DoctorAvailability
+	for cur.Next(ctx) {
+		var schedule models.DoctorAvailability
+		if err := cur.Decode(&schedule); err != nil {
+			return nil, fmt.Errorf("cursor error: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
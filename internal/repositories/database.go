@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection is the part of *mongo.Collection the repositories use. A
+// *mongo.Collection satisfies it as is; the in-memory database emulates it.
+type Collection interface {
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error)
+}
+
+// Database is where the repositories keep their collections: a Mongo
+// database in production, or the in-memory one for --storage=memory and tests
+type Database interface {
+	Collection(name string) Collection
+	// WithTransaction runs fn in a transaction, committing when it returns
+	// nil. fn may run more than once and must use the context it is given.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type mongoDatabase struct {
+	client *mongo.Client
+	db     *mongo.Database
+}
+
+// NewMongoDatabase serves the repositories from the named Mongo database
+func NewMongoDatabase(client *mongo.Client, dbName string) Database {
+	return &mongoDatabase{
+		client: client,
+		db:     client.Database(dbName),
+	}
+}
+
+func (m *mongoDatabase) Collection(name string) Collection {
+	return m.db.Collection(name)
+}
+
+func (m *mongoDatabase) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := m.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("could not start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -3,40 +3,40 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/logger"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
 	"github/Chidi-creator/go-medic-server/internal/models"
-	"log"
+	"github/Chidi-creator/go-medic-server/internal/utils"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type DoctorRepository interface {
 	CreateDoctor(ctx context.Context, doctor *models.Doctor) (*models.Doctor, error)
 	FindDoctorById(ctx context.Context, id string) (*models.Doctor, error)
 	FindDoctorsByQuery(ctx context.Context, filter bson.M) ([]models.Doctor, error)
-	GetDoctorsByHospitalId(ctx context.Context, id string) ([]models.Doctor, error)
-	UpdateDoctorById(ctx context.Context, id string, updateQuery bson.M) error
+	GetDoctorsByHospitalId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Doctor, *utils.PageInfo, error)
+	UpdateDoctorById(ctx context.Context, id string, update bson.M) error
 	DeleteDoctorByUserId(ctx context.Context, id string) error
 }
 
 type doctorRepository struct {
-	Client     *mongo.Client
-	dbName     string
+	db         Database
 	collection string
 }
 
-func NewDoctorRepository(client *mongo.Client, dbName string, collection string) DoctorRepository {
+func NewDoctorRepository(db Database, collection string) DoctorRepository {
 	return &doctorRepository{
-		Client:     client,
-		dbName:     dbName,
+		db:         db,
 		collection: collection,
 	}
 }
 
 func (d *doctorRepository) CreateDoctor(ctx context.Context, doctor *models.Doctor) (*models.Doctor, error) {
-	collection := d.Client.Database(d.dbName).Collection(d.collection)
+	defer metrics.ObserveMongo("doctor", "CreateDoctor")()
+	collection := d.db.Collection(d.collection)
 
 	doctor.CreatedAt = time.Now()
 	doctor.UpdatedAt = time.Now()
@@ -45,7 +45,7 @@ func (d *doctorRepository) CreateDoctor(ctx context.Context, doctor *models.Doct
 	if err != nil {
 		return nil, fmt.Errorf("could not insert record: %w", err)
 	}
-	fmt.Println("inserted record with id of: ", res.InsertedID)
+	logger.FromContext(ctx).Debug("Inserted doctor", "doctor_id", res.InsertedID)
 
 	doctor.ID = res.InsertedID.(primitive.ObjectID)
 
@@ -53,12 +53,13 @@ func (d *doctorRepository) CreateDoctor(ctx context.Context, doctor *models.Doct
 }
 
 func (d *doctorRepository) FindDoctorById(ctx context.Context, id string) (*models.Doctor, error) {
+	defer metrics.ObserveMongo("doctor", "FindDoctorById")()
 
-	_id, err := primitive.ObjectIDFromHex(id)
+	_id, err := parseID(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid Id: %w", err)
+		return nil, err
 	}
-	collection := d.Client.Database(d.dbName).Collection(d.collection)
+	collection := d.db.Collection(d.collection)
 
 	filter := bson.M{"_id": _id}
 
@@ -66,41 +67,33 @@ func (d *doctorRepository) FindDoctorById(ctx context.Context, id string) (*mode
 	err = collection.FindOne(ctx, filter).Decode(&doctor)
 
 	if err != nil {
-		return nil, fmt.Errorf("could not find user: %w", err)
+		return nil, findErr(err, ErrDoctorNotFound, "could not find doctor")
 	}
 
 	return &doctor, nil
 
 }
 
-func (d *doctorRepository) GetDoctorsByHospitalId(ctx context.Context, id string) ([]models.Doctor, error) {
-	_id, err := primitive.ObjectIDFromHex(id)
+func (d *doctorRepository) GetDoctorsByHospitalId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Doctor, *utils.PageInfo, error) {
+	defer metrics.ObserveMongo("doctor", "GetDoctorsByHospitalId")()
+	_id, err := parseID(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid object id: %w", err)
+		return nil, nil, err
 	}
-	filter := bson.M{"hospitalId": _id}
+	page.Filter["hospitalId"] = _id
 
-	collection := d.Client.Database(d.dbName).Collection(d.collection)
+	collection := d.db.Collection(d.collection)
 
-	cur, err := collection.Find(ctx, filter)
+	doctors, info, err := findPage[models.Doctor](ctx, collection, page)
 	if err != nil {
-		return nil, fmt.Errorf("could not find doctors: %w", err)
-	}
-	defer cur.Close(ctx)
-	var doctors []models.Doctor
-	for cur.Next(ctx) {
-		var doctor models.Doctor
-		err := cur.Decode(&doctor)
-		if err != nil {
-			return nil, fmt.Errorf("cursor error: %w", err)
-		}
-		doctors = append(doctors, doctor)
+		return nil, nil, fmt.Errorf("could not find doctors: %w", err)
 	}
 
-	return doctors, nil
+	return doctors, info, nil
 }
 func (d *doctorRepository) FindDoctorsByQuery(ctx context.Context, filter bson.M) ([]models.Doctor, error) {
-	collection := d.Client.Database(d.dbName).Collection(d.collection)
+	defer metrics.ObserveMongo("doctor", "FindDoctorsByQuery")()
+	collection := d.db.Collection(d.collection)
 
 	cur, err := collection.Find(ctx, filter)
 	if err != nil {
@@ -120,49 +113,48 @@ func (d *doctorRepository) FindDoctorsByQuery(ctx context.Context, filter bson.M
 
 }
 
-func (d *doctorRepository) UpdateDoctorById(ctx context.Context, id string, updateQuery bson.M) error {
-	_id, err := primitive.ObjectIDFromHex(id)
+// UpdateDoctorById applies a full update document, e.g. {"$set": {...}}
+func (d *doctorRepository) UpdateDoctorById(ctx context.Context, id string, update bson.M) error {
+	defer metrics.ObserveMongo("doctor", "UpdateDoctorById")()
+	_id, err := parseID(id)
 	if err != nil {
-		return fmt.Errorf("invalid object id: %w", err)
+		return err
 	}
-	collection := d.Client.Database(d.dbName).Collection(d.collection)
-
-	updateQuery["updatedAt"] = time.Now()
+	collection := d.db.Collection(d.collection)
 
 	filter := bson.M{"_id": _id}
-	update := bson.M{"$set": updateQuery}
 
-	res, err := collection.UpdateOne(ctx, filter, update)
+	res, err := collection.UpdateOne(ctx, filter, withUpdatedAt(update))
 
 	if err != nil {
-		return fmt.Errorf("could not update user: %w", err)
+		return fmt.Errorf("could not update doctor: %w", err)
 	}
 
 	if res.MatchedCount == 0 {
-		return fmt.Errorf("no documents matched: %w", err)
+		return ErrDoctorNotFound
 	}
 
-	log.Printf("A total number of %v was updated", res.ModifiedCount)
+	logger.FromContext(ctx).Debug("Updated doctor", "doctor_id", id, "modified", res.ModifiedCount)
 	return nil
 
 }
 
 func (d *doctorRepository) DeleteDoctorByUserId(ctx context.Context, id string) error {
-	_id, err := primitive.ObjectIDFromHex(id)
-
+	defer metrics.ObserveMongo("doctor", "DeleteDoctorByUserId")()
+	_id, err := parseID(id)
 	if err != nil {
-		return fmt.Errorf("invalid object id: %w", err)
+		return err
 	}
 	filter := bson.M{"_id": _id}
 
-	collection := d.Client.Database(d.dbName).Collection(d.collection)
+	collection := d.db.Collection(d.collection)
 	res, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("could not delete doctor by id: %w", err)
+	}
 
 	if res.DeletedCount == 0 {
-		log.Println("No record was deleted")
-	}
-	if err != nil {
-		return fmt.Errorf("could not delete doctor by id")
+		return ErrDoctorNotFound
 	}
 	return nil
 
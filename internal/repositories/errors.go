@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidID           = utils.Validation("invalid_id", "invalid id")
+	ErrUserNotFound        = utils.NotFound("user_not_found", "user not found")
+	ErrDoctorNotFound      = utils.NotFound("doctor_not_found", "doctor not found")
+	ErrHospitalNotFound    = utils.NotFound("hospital_not_found", "hospital not found")
+	ErrAppointmentNotFound = utils.NotFound("appointment_not_found", "appointment not found")
+	ErrEmailTaken          = utils.Conflict("email_taken", "an account with this email already exists")
+)
+
+// parseID turns a hex id from the URL into an ObjectID
+func parseID(id string) (primitive.ObjectID, error) {
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidID
+	}
+	return _id, nil
+}
+
+// findErr reports a missing document as notFound and wraps anything else
+func findErr(err error, notFound error, action string) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return notFound
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
@@ -3,9 +3,11 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
 	"time"
 
 	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/utils"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,43 +18,23 @@ import (
 type HospitalRepository interface {
 	CreateHospital(ctx context.Context, hospital *models.Hospital) (*models.Hospital, error)
 	GetHospitalById(ctx context.Context, id string) (*models.Hospital, error)
-	GetAllHospitals(ctx context.Context) ([]models.Hospital, error)
+	GetAllHospitals(ctx context.Context, page *utils.PageRequest) ([]models.Hospital, *utils.PageInfo, error)
 	GetHospitalsByQuery(ctx context.Context, filter bson.M) ([]models.Hospital, error)
-	UpdateHospitalById(ctx context.Context, id string, updateQuery bson.M) (*models.Hospital, error)
+	FindHospitalsNear(ctx context.Context, query models.NearbyHospitalQuery) ([]models.NearbyHospital, error)
+	UpdateHospitalById(ctx context.Context, id string, update bson.M) (*models.Hospital, error)
 	DeleteHospital(ctx context.Context, id string) (int64, error)
 }
 
 // hospitalRepostory implements HospitalRepository
 type hospitalRepository struct {
-	client         *mongo.Client
-	dbName         string
+	db             Database
 	collectionName string
 }
 
 // function that returns new Hospital Repository with necessary arguments
-func NewHospitalRepository(client *mongo.Client, dbName string, collectionName string) HospitalRepository {
-
-	collection := client.Database(dbName).Collection(collectionName)
-
-	//Ensuring location functions & filters work
-
-	indexModel := mongo.IndexModel{
-		Keys:    bson.M{"location.point": "2dsphere"},
-		Options: options.Index().SetName("location_point_idx"),
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	_, err := collection.Indexes().CreateOne(ctx, indexModel)
-
-	if err != nil {
-		fmt.Printf("Failed to create geo index for hospitals: %v\n", err)
-	}
-
+func NewHospitalRepository(db Database, collectionName string) HospitalRepository {
 	return &hospitalRepository{
-		client:         client,
-		dbName:         dbName,
+		db:             db,
 		collectionName: collectionName,
 	}
 }
@@ -60,7 +42,8 @@ func NewHospitalRepository(client *mongo.Client, dbName string, collectionName s
 //function that creates one hospital
 
 func (h *hospitalRepository) CreateHospital(ctx context.Context, hospital *models.Hospital) (*models.Hospital, error) {
-	collection := h.client.Database(h.dbName).Collection(h.collectionName)
+	defer metrics.ObserveMongo("hospital", "CreateHospital")()
+	collection := h.db.Collection(h.collectionName)
 	hospital.CreatedAt = time.Now()
 	res, err := collection.InsertOne(ctx, hospital)
 	if err != nil {
@@ -74,33 +57,50 @@ func (h *hospitalRepository) CreateHospital(ctx context.Context, hospital *model
 
 // function that retrieves hospital by Id
 func (h *hospitalRepository) GetHospitalById(ctx context.Context, id string) (*models.Hospital, error) {
-	collection := h.client.Database(h.dbName).Collection(h.collectionName)
-	_id, _ := primitive.ObjectIDFromHex(id)
+	defer metrics.ObserveMongo("hospital", "GetHospitalById")()
+	collection := h.db.Collection(h.collectionName)
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
 
 	filter := bson.M{"_id": _id}
 
 	var hospital models.Hospital
-	err := collection.FindOne(ctx, filter).Decode(&hospital)
+	err = collection.FindOne(ctx, filter).Decode(&hospital)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to find hospital: %w", err)
+		return nil, findErr(err, ErrHospitalNotFound, "failed to find hospital")
 	}
 
 	return &hospital, nil
 }
 
-// function that gets all hospital
-func (h *hospitalRepository) GetAllHospitals(ctx context.Context) ([]models.Hospital, error) {
-	collection := h.client.Database(h.dbName).Collection(h.collectionName)
+// function that gets a page of hospitals
+func (h *hospitalRepository) GetAllHospitals(ctx context.Context, page *utils.PageRequest) ([]models.Hospital, *utils.PageInfo, error) {
+	defer metrics.ObserveMongo("hospital", "GetAllHospitals")()
+	collection := h.db.Collection(h.collectionName)
+
+	hospitals, info, err := findPage[models.Hospital](ctx, collection, page)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find hospitals: %w", err)
+	}
+	return hospitals, info, nil
 
-	cur, err := collection.Find(ctx, bson.M{})
+}
 
+// function that gets hospitals by flexible query
+func (h *hospitalRepository) GetHospitalsByQuery(ctx context.Context, filter bson.M) ([]models.Hospital, error) {
+	defer metrics.ObserveMongo("hospital", "GetHospitalsByQuery")()
+	collection := h.db.Collection(h.collectionName)
+
+	cur, err := collection.Find(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find hospitals: %w", err)
 	}
 	defer cur.Close(ctx)
-	var hospitals []models.Hospital
 
+	var hospitals []models.Hospital
 	for cur.Next(ctx) {
 		var hospital models.Hospital
 		err := cur.Decode(&hospital)
@@ -108,50 +108,76 @@ func (h *hospitalRepository) GetAllHospitals(ctx context.Context) ([]models.Hosp
 			return nil, fmt.Errorf("cursor error: %w", err)
 		}
 		hospitals = append(hospitals, hospital)
+
 	}
 	return hospitals, nil
 
 }
 
-// function that gets hospitals by flexible query
-func (h *hospitalRepository) GetHospitalsByQuery(ctx context.Context, filter bson.M) ([]models.Hospital, error) {
-	collection := h.client.Database(h.dbName).Collection(h.collectionName)
+// function that finds hospitals within a radius of a point, nearest first
+func (h *hospitalRepository) FindHospitalsNear(ctx context.Context, query models.NearbyHospitalQuery) ([]models.NearbyHospital, error) {
+	defer metrics.ObserveMongo("hospital", "FindHospitalsNear")()
+	collection := h.db.Collection(h.collectionName)
 
-	cur, err := collection.Find(ctx, filter)
+	filter := bson.M{}
+	if query.Specialty != "" {
+		filter["specialties"] = query.Specialty
+	}
+	if query.OpenOnly {
+		filter["open"] = true
+	}
+
+	// $geoNear must be the first stage and uses the location.point 2dsphere index
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: bson.M{
+			"near": bson.M{
+				"type":        "Point",
+				"coordinates": bson.A{query.Longitude, query.Latitude},
+			},
+			"key":                "location.point",
+			"distanceField":      "distanceKm",
+			"distanceMultiplier": 0.001,
+			"maxDistance":        query.RadiusKm * 1000,
+			"spherical":          true,
+			"query":              filter,
+		}}},
+		{{Key: "$limit", Value: query.Limit}},
+	}
+
+	cur, err := collection.Aggregate(ctx, pipeline)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find hospitals: %w", err)
+		return nil, fmt.Errorf("failed to find nearby hospitals: %w", err)
 	}
 	defer cur.Close(ctx)
 
-	var hospitals []models.Hospital
+	hospitals := []models.NearbyHospital{}
 	for cur.Next(ctx) {
-		var hospital models.Hospital
-		err := cur.Decode(&hospital)
-		if err != nil {
+		var hospital models.NearbyHospital
+		if err := cur.Decode(&hospital); err != nil {
 			return nil, fmt.Errorf("cursor error: %w", err)
 		}
 		hospitals = append(hospitals, hospital)
-
 	}
 	return hospitals, nil
-
 }
 
-// function that updates hospitals by id
-func (h *hospitalRepository) UpdateHospitalById(ctx context.Context, id string, updateQuery bson.M) (*models.Hospital, error) {
-	collection := h.client.Database(h.dbName).Collection(h.collectionName)
-	_id, _ := primitive.ObjectIDFromHex(id)
+// function that applies a full update document to a hospital
+func (h *hospitalRepository) UpdateHospitalById(ctx context.Context, id string, update bson.M) (*models.Hospital, error) {
+	defer metrics.ObserveMongo("hospital", "UpdateHospitalById")()
+	collection := h.db.Collection(h.collectionName)
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
 	filter := bson.M{"_id": _id}
-	updateQuery["updatedAt"] = time.Now()
 
-	update := bson.M{"$set": updateQuery}
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
 	var updatedResult models.Hospital
-	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedResult)
+	err = collection.FindOneAndUpdate(ctx, filter, withUpdatedAt(update), opts).Decode(&updatedResult)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to find hospitals: %w", err)
+		return nil, findErr(err, ErrHospitalNotFound, "failed to update hospital")
 	}
 
 	return &updatedResult, nil
@@ -161,8 +187,12 @@ func (h *hospitalRepository) UpdateHospitalById(ctx context.Context, id string,
 //function that deletes hospital
 
 func (h *hospitalRepository) DeleteHospital(ctx context.Context, id string) (int64, error) {
-	collection := h.client.Database(h.dbName).Collection(h.collectionName)
-	_id, _ := primitive.ObjectIDFromHex(id)
+	defer metrics.ObserveMongo("hospital", "DeleteHospital")()
+	collection := h.db.Collection(h.collectionName)
+	_id, err := parseID(id)
+	if err != nil {
+		return 0, err
+	}
 	filter := bson.M{"_id": _id}
 	res, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
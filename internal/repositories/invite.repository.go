@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInviteNotUsable is returned when an invite has already been answered,
+// has expired, or the token presented is not the latest one issued
+var ErrInviteNotUsable = utils.Conflict("invite_not_usable", "invite is no longer valid")
+
+var ErrInviteNotFound = utils.NotFound("invite_not_found", "invite not found")
+
+type InviteRepository interface {
+	CreateInvite(ctx context.Context, invite *models.DoctorInvite) (*models.DoctorInvite, error)
+	GetInviteById(ctx context.Context, id string) (*models.DoctorInvite, error)
+	GetPendingInviteByDoctorId(ctx context.Context, id primitive.ObjectID) (*models.DoctorInvite, error)
+	RenewInvite(ctx context.Context, id primitive.ObjectID, nonce string, expiresAt time.Time) (*models.DoctorInvite, error)
+	RespondToInvite(ctx context.Context, id primitive.ObjectID, nonce string, status utils.InviteStatus, userId primitive.ObjectID) (*models.DoctorInvite, error)
+}
+
+type inviteRepository struct {
+	db         Database
+	collection string
+}
+
+func NewInviteRepository(db Database, collection string) InviteRepository {
+	return &inviteRepository{
+		db:         db,
+		collection: collection,
+	}
+}
+
+func (i *inviteRepository) CreateInvite(ctx context.Context, invite *models.DoctorInvite) (*models.DoctorInvite, error) {
+	defer metrics.ObserveMongo("invite", "CreateInvite")()
+	collection := i.db.Collection(i.collection)
+
+	invite.CreatedAt = time.Now()
+	invite.UpdatedAt = time.Now()
+
+	res, err := collection.InsertOne(ctx, invite)
+	if err != nil {
+		return nil, fmt.Errorf("could not create invite: %w", err)
+	}
+	invite.ID = res.InsertedID.(primitive.ObjectID)
+
+	return invite, nil
+}
+
+func (i *inviteRepository) GetInviteById(ctx context.Context, id string) (*models.DoctorInvite, error) {
+	defer metrics.ObserveMongo("invite", "GetInviteById")()
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	collection := i.db.Collection(i.collection)
+
+	var invite models.DoctorInvite
+	if err := collection.FindOne(ctx, bson.M{"_id": _id}).Decode(&invite); err != nil {
+		return nil, findErr(err, ErrInviteNotFound, "could not find invite")
+	}
+	return &invite, nil
+}
+
+// returns nil without an error when the doctor has no pending invite
+func (i *inviteRepository) GetPendingInviteByDoctorId(ctx context.Context, id primitive.ObjectID) (*models.DoctorInvite, error) {
+	defer metrics.ObserveMongo("invite", "GetPendingInviteByDoctorId")()
+	collection := i.db.Collection(i.collection)
+
+	var invite models.DoctorInvite
+	err := collection.FindOne(ctx, bson.M{"doctorId": id, "status": utils.PENDING}).Decode(&invite)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not find invite: %w", err)
+	}
+	return &invite, nil
+}
+
+// RenewInvite rotates the nonce of a pending invite, which invalidates every
+// token issued for it before
+func (i *inviteRepository) RenewInvite(ctx context.Context, id primitive.ObjectID, nonce string, expiresAt time.Time) (*models.DoctorInvite, error) {
+	defer metrics.ObserveMongo("invite", "RenewInvite")()
+	collection := i.db.Collection(i.collection)
+
+	filter := bson.M{"_id": id, "status": utils.PENDING}
+	update := bson.M{"$set": bson.M{"nonce": nonce, "expiresAt": expiresAt, "updatedAt": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var invite models.DoctorInvite
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&invite)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInviteNotUsable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not renew invite: %w", err)
+	}
+	return &invite, nil
+}
+
+// RespondToInvite moves a pending invite to accepted or rejected. The update
+// only matches while the invite is pending, unexpired and the nonce is
+// current, so each token can be used once.
+func (i *inviteRepository) RespondToInvite(ctx context.Context, id primitive.ObjectID, nonce string, status utils.InviteStatus, userId primitive.ObjectID) (*models.DoctorInvite, error) {
+	defer metrics.ObserveMongo("invite", "RespondToInvite")()
+	collection := i.db.Collection(i.collection)
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":       id,
+		"nonce":     nonce,
+		"status":    utils.PENDING,
+		"expiresAt": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":      status,
+		"respondedBy": userId,
+		"respondedAt": now,
+		"updatedAt":   now,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var invite models.DoctorInvite
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&invite)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInviteNotUsable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not update invite: %w", err)
+	}
+	return &invite, nil
+}
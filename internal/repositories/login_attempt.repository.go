@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptRepository tracks failed logins per account and per IP. Entries
+// carry an expiresAt so the TTL index forgets quiet keys.
+type LoginAttemptRepository interface {
+	GetAttempts(ctx context.Context, keys []string) ([]models.LoginAttempts, error)
+	RecordFailure(ctx context.Context, key string, expiresAt time.Time) (*models.LoginAttempts, error)
+	Lock(ctx context.Context, key string, until time.Time, expiresAt time.Time) error
+	ClearAttempts(ctx context.Context, keys ...string) error
+}
+
+type loginAttemptRepository struct {
+	db         Database
+	collection string
+}
+
+func NewLoginAttemptRepository(db Database, collection string) LoginAttemptRepository {
+	return &loginAttemptRepository{
+		db:         db,
+		collection: collection,
+	}
+}
+
+func (la *loginAttemptRepository) GetAttempts(ctx context.Context, keys []string) ([]models.LoginAttempts, error) {
+	defer metrics.ObserveMongo("login_attempt", "GetAttempts")()
+	collection := la.db.Collection(la.collection)
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	if err != nil {
+		return nil, fmt.Errorf("could not get login attempts: %w", err)
+	}
+
+	var attempts []models.LoginAttempts
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, fmt.Errorf("could not decode login attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+// RecordFailure counts one more failure for key and returns the updated entry
+func (la *loginAttemptRepository) RecordFailure(ctx context.Context, key string, expiresAt time.Time) (*models.LoginAttempts, error) {
+	defer metrics.ObserveMongo("login_attempt", "RecordFailure")()
+	collection := la.db.Collection(la.collection)
+
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"lastFailure": time.Now()},
+		"$max": bson.M{"expiresAt": expiresAt},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var attempts models.LoginAttempts
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&attempts); err != nil {
+		return nil, fmt.Errorf("could not record login failure: %w", err)
+	}
+	return &attempts, nil
+}
+
+func (la *loginAttemptRepository) Lock(ctx context.Context, key string, until time.Time, expiresAt time.Time) error {
+	defer metrics.ObserveMongo("login_attempt", "Lock")()
+	collection := la.db.Collection(la.collection)
+
+	update := bson.M{"$max": bson.M{"lockedUntil": until, "expiresAt": expiresAt}}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": key}, update); err != nil {
+		return fmt.Errorf("could not lock login: %w", err)
+	}
+	return nil
+}
+
+func (la *loginAttemptRepository) ClearAttempts(ctx context.Context, keys ...string) error {
+	defer metrics.ObserveMongo("login_attempt", "ClearAttempts")()
+	collection := la.db.Collection(la.collection)
+
+	if _, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": keys}}); err != nil {
+		return fmt.Errorf("could not clear login attempts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,1071 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MemoryDatabase is an in-memory Database for --storage=memory and tests. The
+// repositories run against it unchanged: it takes the same filter, update and
+// pipeline documents and answers with the driver's own result, cursor and
+// error types. Only the operators, options and stages the repositories use
+// are emulated; anything else is an error rather than a silent mismatch.
+type MemoryDatabase struct {
+	// transactions hold mu exclusively, every other operation shares it
+	mu          sync.RWMutex
+	collMu      sync.Mutex
+	collections map[string]*memoryCollection
+}
+
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{collections: map[string]*memoryCollection{}}
+}
+
+func (db *MemoryDatabase) Collection(name string) Collection {
+	return db.collection(name)
+}
+
+func (db *MemoryDatabase) collection(name string) *memoryCollection {
+	db.collMu.Lock()
+	defer db.collMu.Unlock()
+	c, ok := db.collections[name]
+	if !ok {
+		c = &memoryCollection{db: db, name: name}
+		db.collections[name] = c
+	}
+	return c
+}
+
+// CreateIndexes applies the indexes that change behaviour: unique indexes and
+// TTL indexes with expireAfterSeconds 0. The rest only matter for speed and
+// are skipped.
+func (db *MemoryDatabase) CreateIndexes(collection string, models []mongo.IndexModel) error {
+	c := db.collection(collection)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, model := range models {
+		keys, ok := model.Keys.(bson.D)
+		if !ok {
+			return fmt.Errorf("index keys on %s must be a bson.D", collection)
+		}
+		opts := model.Options
+		if opts == nil {
+			continue
+		}
+		if opts.ExpireAfterSeconds != nil {
+			if *opts.ExpireAfterSeconds != 0 || len(keys) != 1 {
+				return fmt.Errorf("only single field TTL indexes expiring at the stored time are supported")
+			}
+			c.ttlField = keys[0].Key
+		}
+		if opts.Unique != nil && *opts.Unique {
+			fields := make([]string, len(keys))
+			for i, key := range keys {
+				fields[i] = key.Key
+			}
+			c.unique = append(c.unique, fields)
+		}
+	}
+	return nil
+}
+
+type memoryTxKey struct{}
+
+// WithTransaction runs fn with the database to itself and restores every
+// collection when fn fails, so a transaction is atomic and isolated
+func (db *MemoryDatabase) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.collMu.Lock()
+	snapshot := make(map[string][]bson.M, len(db.collections))
+	for name, c := range db.collections {
+		snapshot[name] = append([]bson.M(nil), c.docs...)
+	}
+	db.collMu.Unlock()
+
+	err := fn(context.WithValue(ctx, memoryTxKey{}, db))
+	if err != nil {
+		db.collMu.Lock()
+		for name, c := range db.collections {
+			c.docs = snapshot[name]
+		}
+		db.collMu.Unlock()
+	}
+	return err
+}
+
+// enter waits out any transaction but the caller's own
+func (db *MemoryDatabase) enter(ctx context.Context) func() {
+	if ctx.Value(memoryTxKey{}) == db {
+		return func() {}
+	}
+	db.mu.RLock()
+	return db.mu.RUnlock
+}
+
+// memoryCollection stores documents as bson.M after a round trip through the
+// bson codec, so values have the types the driver reads back from a server
+type memoryCollection struct {
+	db   *MemoryDatabase
+	name string
+	mu   sync.RWMutex
+	docs []bson.M
+	// each entry is the field list of one unique index
+	unique [][]string
+	// documents whose ttlField is in the past are treated as deleted
+	ttlField string
+}
+
+func (c *memoryCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	defer c.db.enter(ctx)()
+	if err := checkOptions(opts); err != nil {
+		return nil, err
+	}
+	doc, err := toDocument(document)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = primitive.NewObjectID()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purgeExpiredLocked()
+	if err := c.checkUniqueLocked(doc, -1); err != nil {
+		return nil, err
+	}
+	c.docs = append(c.docs, doc)
+	return &mongo.InsertOneResult{InsertedID: doc["_id"]}, nil
+}
+
+func (c *memoryCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	defer c.db.enter(ctx)()
+	if err := checkOptions(opts, "Sort", "Limit"); err != nil {
+		return nil, err
+	}
+	var sortBy bson.D
+	var limit int64
+	for _, opt := range opts {
+		if opt.Sort != nil {
+			d, ok := opt.Sort.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("sort must be a bson.D")
+			}
+			sortBy = d
+		}
+		if opt.Limit != nil {
+			limit = *opt.Limit
+		}
+	}
+
+	docs, err := c.find(filter, sortBy, limit)
+	if err != nil {
+		return nil, err
+	}
+	return newMemoryCursor(docs)
+}
+
+func (c *memoryCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	defer c.db.enter(ctx)()
+	if err := checkOptions(opts); err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	docs, err := c.find(filter, nil, 1)
+	return singleResult(docs, err)
+}
+
+func (c *memoryCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	defer c.db.enter(ctx)()
+	if err := checkOptions(opts, "ReturnDocument", "Upsert"); err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	upsert, after := false, false
+	for _, opt := range opts {
+		if opt.Upsert != nil {
+			upsert = *opt.Upsert
+		}
+		if opt.ReturnDocument != nil {
+			after = *opt.ReturnDocument == options.After
+		}
+	}
+
+	before, updated, _, err := c.update(filter, update, upsert, false)
+	if after {
+		return singleResult(updated, err)
+	}
+	return singleResult(before, err)
+}
+
+func (c *memoryCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	defer c.db.enter(ctx)()
+	upsert, err := updateUpsert(opts)
+	if err != nil {
+		return nil, err
+	}
+	_, _, res, err := c.update(filter, update, upsert, false)
+	return res, err
+}
+
+func (c *memoryCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	defer c.db.enter(ctx)()
+	upsert, err := updateUpsert(opts)
+	if err != nil {
+		return nil, err
+	}
+	_, _, res, err := c.update(filter, update, upsert, true)
+	return res, err
+}
+
+func (c *memoryCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	defer c.db.enter(ctx)()
+	if err := checkOptions(opts); err != nil {
+		return nil, err
+	}
+	return c.delete(filter, false)
+}
+
+func (c *memoryCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	defer c.db.enter(ctx)()
+	if err := checkOptions(opts); err != nil {
+		return nil, err
+	}
+	return c.delete(filter, true)
+}
+
+func (c *memoryCollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	defer c.db.enter(ctx)()
+	if err := checkOptions(opts, "Limit"); err != nil {
+		return 0, err
+	}
+	var limit int64
+	for _, opt := range opts {
+		if opt.Limit != nil {
+			limit = *opt.Limit
+		}
+	}
+	docs, err := c.find(filter, nil, limit)
+	return int64(len(docs)), err
+}
+
+// Aggregate supports a leading $geoNear and $limit
+func (c *memoryCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	defer c.db.enter(ctx)()
+	if err := checkOptions(opts); err != nil {
+		return nil, err
+	}
+	stages, ok := pipeline.(mongo.Pipeline)
+	if !ok {
+		return nil, fmt.Errorf("pipeline must be a mongo.Pipeline")
+	}
+
+	var docs []bson.M
+	var err error
+	for i, stage := range stages {
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("pipeline stage %d must have exactly one operator", i)
+		}
+		switch op, arg := stage[0].Key, stage[0].Value; {
+		case op == "$geoNear" && i == 0:
+			if docs, err = c.geoNear(arg); err != nil {
+				return nil, err
+			}
+		case op == "$limit":
+			if i == 0 {
+				if docs, err = c.find(bson.M{}, nil, 0); err != nil {
+					return nil, err
+				}
+			}
+			n, ok := toFloat(arg)
+			if !ok || n < 1 {
+				return nil, fmt.Errorf("$limit must be a positive number")
+			}
+			if int64(len(docs)) > int64(n) {
+				docs = docs[:int64(n)]
+			}
+		default:
+			return nil, fmt.Errorf("unsupported pipeline stage %s at %d", op, i)
+		}
+	}
+	return newMemoryCursor(docs)
+}
+
+// geoNear sorts the documents matching the stage's query by their spherical
+// distance in meters from near, the way Mongo does for GeoJSON points
+func (c *memoryCollection) geoNear(arg interface{}) ([]bson.M, error) {
+	spec, err := toDocument(arg)
+	if err != nil {
+		return nil, err
+	}
+	for key := range spec {
+		switch key {
+		case "near", "key", "distanceField", "distanceMultiplier", "maxDistance", "spherical", "query":
+		default:
+			return nil, fmt.Errorf("unsupported $geoNear option %s", key)
+		}
+	}
+
+	lng, lat, ok := geoPoint(spec["near"])
+	key, _ := spec["key"].(string)
+	distanceField, _ := spec["distanceField"].(string)
+	if !ok || key == "" || distanceField == "" {
+		return nil, fmt.Errorf("$geoNear needs a GeoJSON point near, a key and a distanceField")
+	}
+	multiplier := 1.0
+	if v, found := spec["distanceMultiplier"]; found {
+		if multiplier, ok = toFloat(v); !ok {
+			return nil, fmt.Errorf("$geoNear distanceMultiplier must be a number")
+		}
+	}
+	maxDistance := math.Inf(1)
+	if v, found := spec["maxDistance"]; found {
+		if maxDistance, ok = toFloat(v); !ok {
+			return nil, fmt.Errorf("$geoNear maxDistance must be a number")
+		}
+	}
+	query, _ := spec["query"].(bson.M)
+
+	matched, err := c.find(query, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	type near struct {
+		doc      bson.M
+		distance float64
+	}
+	var found []near
+	for _, doc := range matched {
+		point, _ := lookupPath(doc, key)
+		pointLng, pointLat, ok := geoPoint(point)
+		if !ok {
+			continue
+		}
+		if distance := sphereDistance(lng, lat, pointLng, pointLat); distance <= maxDistance {
+			found = append(found, near{doc: doc, distance: distance})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].distance < found[j].distance
+	})
+
+	docs := make([]bson.M, len(found))
+	for i, n := range found {
+		setPath(n.doc, distanceField, n.distance*multiplier)
+		docs[i] = n.doc
+	}
+	return docs, nil
+}
+
+// geoPoint reads a GeoJSON point's longitude and latitude
+func geoPoint(v interface{}) (float64, float64, bool) {
+	point, ok := v.(bson.M)
+	if !ok || point["type"] != "Point" {
+		return 0, 0, false
+	}
+	coordinates, ok := point["coordinates"].(primitive.A)
+	if !ok || len(coordinates) != 2 {
+		return 0, 0, false
+	}
+	lng, okLng := toFloat(coordinates[0])
+	lat, okLat := toFloat(coordinates[1])
+	return lng, lat, okLng && okLat
+}
+
+// the radius Mongo's spherical geometry uses
+const earthRadiusMeters = 6378100
+
+// sphereDistance is the haversine distance in meters between two points
+func sphereDistance(lng1, lat1, lng2, lat2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// find returns copies of the matching documents ordered by sortBy, at most
+// limit of them when limit is positive
+func (c *memoryCollection) find(filter interface{}, sortBy bson.D, limit int64) ([]bson.M, error) {
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	var matched []bson.M
+	now := time.Now()
+	for _, doc := range c.docs {
+		if c.expired(doc, now) {
+			continue
+		}
+		ok, err := matchDocument(doc, f)
+		if err != nil {
+			c.mu.RUnlock()
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, doc)
+		}
+	}
+	c.mu.RUnlock()
+
+	if len(sortBy) > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			for _, key := range sortBy {
+				a, _ := lookupPath(matched[i], key.Key)
+				b, _ := lookupPath(matched[j], key.Key)
+				if cmp := compareOrder(a, b); cmp != 0 {
+					if direction, _ := key.Value.(int); direction < 0 {
+						return cmp > 0
+					}
+					return cmp < 0
+				}
+			}
+			return false
+		})
+	}
+	if limit > 0 && int64(len(matched)) > limit {
+		matched = matched[:limit]
+	}
+
+	out := make([]bson.M, len(matched))
+	for i, doc := range matched {
+		if out[i], err = toDocument(doc); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// update applies update to the first match, or every match when many, and
+// returns copies of the documents before and after. With upsert a document
+// built from the filter's equality fields is inserted when nothing matches.
+func (c *memoryCollection) update(filter interface{}, update interface{}, upsert bool, many bool) ([]bson.M, []bson.M, *mongo.UpdateResult, error) {
+	res := &mongo.UpdateResult{}
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	u, err := toDocument(update)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purgeExpiredLocked()
+
+	var before, after []bson.M
+	for i, doc := range c.docs {
+		ok, err := matchDocument(doc, f)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if !ok {
+			continue
+		}
+		res.MatchedCount++
+
+		// apply to a copy so a failed update or unique check leaves no trace
+		next, err := toDocument(doc)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err := applyUpdate(next, u, false); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := c.checkUniqueLocked(next, i); err != nil {
+			return nil, nil, nil, err
+		}
+		if !reflect.DeepEqual(doc, next) {
+			res.ModifiedCount++
+		}
+		c.docs[i] = next
+		before = append(before, doc)
+		after = append(after, next)
+		if !many {
+			break
+		}
+	}
+
+	if res.MatchedCount == 0 && upsert {
+		doc := upsertSeed(f)
+		if err := applyUpdate(doc, u, true); err != nil {
+			return nil, nil, nil, err
+		}
+		if _, ok := doc["_id"]; !ok {
+			doc["_id"] = primitive.NewObjectID()
+		}
+		if err := c.checkUniqueLocked(doc, -1); err != nil {
+			return nil, nil, nil, err
+		}
+		c.docs = append(c.docs, doc)
+		res.UpsertedCount = 1
+		res.UpsertedID = doc["_id"]
+		after = append(after, doc)
+	}
+
+	if before, err = copyDocuments(before); err != nil {
+		return nil, nil, nil, err
+	}
+	if after, err = copyDocuments(after); err != nil {
+		return nil, nil, nil, err
+	}
+	return before, after, res, nil
+}
+
+func (c *memoryCollection) delete(filter interface{}, many bool) (*mongo.DeleteResult, error) {
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purgeExpiredLocked()
+
+	res := &mongo.DeleteResult{}
+	kept := make([]bson.M, 0, len(c.docs))
+	for _, doc := range c.docs {
+		if many || res.DeletedCount == 0 {
+			ok, err := matchDocument(doc, f)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				res.DeletedCount++
+				continue
+			}
+		}
+		kept = append(kept, doc)
+	}
+	c.docs = kept
+	return res, nil
+}
+
+func (c *memoryCollection) expired(doc bson.M, now time.Time) bool {
+	if c.ttlField == "" {
+		return false
+	}
+	at, ok := doc[c.ttlField].(primitive.DateTime)
+	return ok && at.Time().Before(now)
+}
+
+func (c *memoryCollection) purgeExpiredLocked() {
+	if c.ttlField == "" {
+		return
+	}
+	now := time.Now()
+	kept := make([]bson.M, 0, len(c.docs))
+	for _, doc := range c.docs {
+		if !c.expired(doc, now) {
+			kept = append(kept, doc)
+		}
+	}
+	c.docs = kept
+}
+
+// checkUniqueLocked reports a duplicate key write error, as the server would,
+// when doc collides with a document other than the one at index self
+func (c *memoryCollection) checkUniqueLocked(doc bson.M, self int) error {
+	for _, fields := range c.unique {
+		for i, other := range c.docs {
+			if i == self {
+				continue
+			}
+			same := true
+			for _, field := range fields {
+				a, _ := lookupPath(doc, field)
+				b, _ := lookupPath(other, field)
+				if !valuesEqual(a, b) {
+					same = false
+					break
+				}
+			}
+			if same {
+				return mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+					Code:    11000,
+					Message: fmt.Sprintf("E11000 duplicate key error collection: %s index on %s", c.name, strings.Join(fields, ", ")),
+				}}}
+			}
+		}
+	}
+	return nil
+}
+
+func newMemoryCursor(docs []bson.M) (*mongo.Cursor, error) {
+	items := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		items[i] = doc
+	}
+	return mongo.NewCursorFromDocuments(items, nil, nil)
+}
+
+// singleResult answers like FindOne: the first document, or mongo.ErrNoDocuments
+func singleResult(docs []bson.M, err error) *mongo.SingleResult {
+	if err == nil && len(docs) == 0 {
+		err = mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	return mongo.NewSingleResultFromDocument(docs[0], nil, nil)
+}
+
+func updateUpsert(opts []*options.UpdateOptions) (bool, error) {
+	if err := checkOptions(opts, "Upsert"); err != nil {
+		return false, err
+	}
+	upsert := false
+	for _, opt := range opts {
+		if opt.Upsert != nil {
+			upsert = *opt.Upsert
+		}
+	}
+	return upsert, nil
+}
+
+// checkOptions rejects any option outside supported, so a repository that
+// starts using a new one fails here instead of behaving differently
+func checkOptions[T any](opts []*T, supported ...string) error {
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		v := reflect.ValueOf(opt).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Name
+			if !v.Field(i).IsZero() && !containsString(supported, name) {
+				return fmt.Errorf("unsupported %s option %s", v.Type().Name(), name)
+			}
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// toDocument converts a struct or map into a fresh bson.M with the types the
+// driver would read back from the server: time.Time becomes
+// primitive.DateTime, named strings become string, slices become primitive.A
+func toDocument(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode document: %w", err)
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("could not decode document: %w", err)
+	}
+	return doc, nil
+}
+
+func copyDocuments(docs []bson.M) ([]bson.M, error) {
+	out := make([]bson.M, len(docs))
+	for i, doc := range docs {
+		var err error
+		if out[i], err = toDocument(doc); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// upsertSeed is the document an upsert starts from: the filter's plain
+// equality conditions
+func upsertSeed(filter bson.M) bson.M {
+	doc := bson.M{}
+	for key, cond := range filter {
+		if strings.HasPrefix(key, "$") || isOperatorDocument(cond) {
+			continue
+		}
+		setPath(doc, key, cond)
+	}
+	return doc
+}
+
+func matchDocument(doc bson.M, filter bson.M) (bool, error) {
+	for key, cond := range filter {
+		var ok bool
+		var err error
+		switch key {
+		case "$and", "$or":
+			ok, err = matchLogical(doc, key, cond)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported query operator %s", key)
+			}
+			ok, err = matchField(doc, key, cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, op string, cond interface{}) (bool, error) {
+	clauses, ok := cond.(primitive.A)
+	if !ok || len(clauses) == 0 {
+		return false, fmt.Errorf("%s needs a non-empty array", op)
+	}
+	for _, clause := range clauses {
+		sub, ok := clause.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("%s clauses must be documents", op)
+		}
+		matched, err := matchDocument(doc, sub)
+		if err != nil {
+			return false, err
+		}
+		if op == "$and" && !matched {
+			return false, nil
+		}
+		if op == "$or" && matched {
+			return true, nil
+		}
+	}
+	return op == "$and", nil
+}
+
+func matchField(doc bson.M, path string, cond interface{}) (bool, error) {
+	value, found := lookupPath(doc, path)
+	if !isOperatorDocument(cond) {
+		return matchEqual(value, found, cond), nil
+	}
+
+	for op, arg := range cond.(bson.M) {
+		var ok bool
+		switch op {
+		case "$ne":
+			ok = !matchEqual(value, found, arg)
+		case "$gt", "$gte", "$lt":
+			ok = matchCompare(value, found, op, arg)
+		case "$in":
+			list, isList := arg.(primitive.A)
+			if !isList {
+				return false, fmt.Errorf("$in needs an array")
+			}
+			for _, item := range list {
+				if matchEqual(value, found, item) {
+					ok = true
+					break
+				}
+			}
+		case "$exists":
+			want, _ := arg.(bool)
+			ok = found == want
+		default:
+			return false, fmt.Errorf("unsupported query operator %s", op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchEqual follows Mongo: null matches a missing field, and an array field
+// matches when it equals the value or any element does
+func matchEqual(value interface{}, found bool, want interface{}) bool {
+	if want == nil {
+		return !found || value == nil
+	}
+	if !found {
+		return false
+	}
+	for _, candidate := range candidates(value) {
+		if valuesEqual(candidate, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCompare only compares values of the same kind, like Mongo's type bracketing
+func matchCompare(value interface{}, found bool, op string, want interface{}) bool {
+	if !found {
+		return false
+	}
+	for _, candidate := range candidates(value) {
+		cmp, ok := compareValues(candidate, want)
+		if !ok {
+			continue
+		}
+		switch {
+		case op == "$gt" && cmp > 0,
+			op == "$gte" && cmp >= 0,
+			op == "$lt" && cmp < 0:
+			return true
+		}
+	}
+	return false
+}
+
+func candidates(value interface{}) []interface{} {
+	if arr, ok := value.(primitive.A); ok {
+		return append([]interface{}{value}, arr...)
+	}
+	return []interface{}{value}
+}
+
+func isOperatorDocument(v interface{}) bool {
+	m, ok := v.(bson.M)
+	if !ok || len(m) == 0 {
+		return false
+	}
+	for key := range m {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupPath follows a dotted path through embedded documents
+func lookupPath(doc bson.M, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(bson.M)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func setPath(doc bson.M, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(bson.M)
+		if !ok {
+			next = bson.M{}
+			doc[part] = next
+		}
+		doc = next
+	}
+	doc[parts[len(parts)-1]] = value
+}
+
+func unsetPath(doc bson.M, path string) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(bson.M)
+		if !ok {
+			return
+		}
+		doc = next
+	}
+	delete(doc, parts[len(parts)-1])
+}
+
+func applyUpdate(doc bson.M, update bson.M, inserting bool) error {
+	if len(update) == 0 {
+		return fmt.Errorf("update document must not be empty")
+	}
+	for op, arg := range update {
+		fields, ok := arg.(bson.M)
+		if !ok {
+			return fmt.Errorf("%s needs a document", op)
+		}
+		for path, value := range fields {
+			current, found := lookupPath(doc, path)
+			switch op {
+			case "$set":
+				setPath(doc, path, value)
+			case "$setOnInsert":
+				if inserting {
+					setPath(doc, path, value)
+				}
+			case "$unset":
+				unsetPath(doc, path)
+			case "$inc":
+				if !found {
+					current = int32(0)
+				}
+				sum, err := addNumbers(current, value)
+				if err != nil {
+					return fmt.Errorf("$inc %s: %w", path, err)
+				}
+				setPath(doc, path, sum)
+			case "$max":
+				cmp, comparable := compareValues(value, current)
+				if !found || (comparable && cmp > 0) {
+					setPath(doc, path, value)
+				}
+			case "$push", "$addToSet":
+				arr, isArray := current.(primitive.A)
+				if found && !isArray {
+					return fmt.Errorf("%s %s: field is not an array", op, path)
+				}
+				if op == "$addToSet" && matchEqual(arr, isArray, value) {
+					continue
+				}
+				setPath(doc, path, append(append(primitive.A{}, arr...), value))
+			case "$pull":
+				arr, isArray := current.(primitive.A)
+				if !isArray {
+					continue
+				}
+				kept := primitive.A{}
+				for _, item := range arr {
+					if !valuesEqual(item, value) {
+						kept = append(kept, item)
+					}
+				}
+				setPath(doc, path, kept)
+			default:
+				return fmt.Errorf("unsupported update operator %s", op)
+			}
+		}
+	}
+	return nil
+}
+
+func addNumbers(a, b interface{}) (interface{}, error) {
+	x, okA := toFloat(a)
+	y, okB := toFloat(b)
+	if !okA || !okB {
+		return nil, fmt.Errorf("cannot add %T and %T", a, b)
+	}
+	_, floatA := a.(float64)
+	_, floatB := b.(float64)
+	_, longA := a.(int64)
+	_, longB := b.(int64)
+	switch {
+	case floatA || floatB:
+		return x + y, nil
+	case longA || longB || x+y > math.MaxInt32 || x+y < math.MinInt32:
+		return int64(x + y), nil
+	default:
+		return int32(x + y), nil
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues orders two values of the same kind; ok is false when they
+// cannot be compared
+func compareValues(a, b interface{}) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		return compareOrdered(x, y), true
+	}
+	switch x := a.(type) {
+	case nil:
+		return 0, b == nil
+	case string:
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x == y:
+			return 0, true
+		case !x:
+			return -1, true
+		default:
+			return 1, true
+		}
+	case primitive.DateTime:
+		y, ok := b.(primitive.DateTime)
+		return compareOrdered(x, y), ok
+	case primitive.ObjectID:
+		y, ok := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:]), ok
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64 | primitive.DateTime](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// compareOrder sorts any two values, falling back to Mongo's order of types
+// when they are of different kinds
+func compareOrder(a, b interface{}) int {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp
+	}
+	return compareOrdered(int64(typeRank(a)), int64(typeRank(b)))
+}
+
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 1
+	case int32, int64, float64:
+		return 2
+	case string:
+		return 3
+	case bson.M:
+		return 4
+	case primitive.A:
+		return 5
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	}
+	return 10
+}
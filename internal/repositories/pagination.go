@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// pageCursor is the decoded form of a continuation token: the sort key and _id
+// of the last item returned, plus the sort it was issued for. Tokens reach
+// clients signed by utils.Cursors, which checks them before they get here.
+type pageCursor struct {
+	SortField string             `bson:"s"`
+	SortDesc  bool               `bson:"d"`
+	Value     bson.RawValue      `bson:"v"`
+	ID        primitive.ObjectID `bson:"id"`
+}
+
+// findPage runs keyset pagination over a collection: results are ordered by
+// (sort field, _id) and each page resumes strictly after the previous cursor
+func findPage[T any](ctx context.Context, collection Collection, page *utils.PageRequest) ([]T, *utils.PageInfo, error) {
+	filter, sort, err := pageQuery(page, reflect.TypeFor[T]())
+	if err != nil {
+		return nil, nil, err
+	}
+	// one extra document tells us whether another page exists
+	opts := options.Find().SetSort(sort).SetLimit(page.Limit + 1)
+
+	cur, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list documents: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	items := []T{}
+	var raws []bson.Raw
+	for cur.Next(ctx) {
+		var item T
+		if err := cur.Decode(&item); err != nil {
+			return nil, nil, fmt.Errorf("cursor error: %w", err)
+		}
+		items = append(items, item)
+		raws = append(raws, append(bson.Raw(nil), cur.Current...))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return finishPage(items, raws, page)
+}
+
+// pageQuery builds the filter and sort for one page of page over documents
+// of type model
+func pageQuery(page *utils.PageRequest, model reflect.Type) (bson.M, bson.D, error) {
+	sortField := pageSortField(page)
+	direction := 1
+	cmp := "$gt"
+	if page.SortDesc {
+		direction = -1
+		cmp = "$lt"
+	}
+
+	filter := bson.M{}
+	for k, v := range page.Filter {
+		filter[k] = v
+	}
+
+	if page.Cursor != "" {
+		cursor, err := decodeCursor(page.Cursor)
+		if err != nil || cursor.SortField != sortField || cursor.SortDesc != page.SortDesc {
+			return nil, nil, utils.ErrInvalidCursor
+		}
+		var after bson.M
+		if sortField == "_id" {
+			after = bson.M{"_id": bson.M{cmp: cursor.ID}}
+		} else {
+			// the value goes into the filter as is, so it must be a plain
+			// value of the field's own type and never an operator document
+			want, ok := fieldType(model, sortField)
+			if !ok || (cursor.Value.Type != want && cursor.Value.Type != bson.TypeNull) {
+				return nil, nil, utils.ErrInvalidCursor
+			}
+			after = bson.M{"$or": bson.A{
+				bson.M{sortField: bson.M{cmp: cursor.Value}},
+				bson.M{sortField: cursor.Value, "_id": bson.M{cmp: cursor.ID}},
+			}}
+		}
+		filter = bson.M{"$and": bson.A{filter, after}}
+	}
+
+	sort := bson.D{{Key: sortField, Value: direction}}
+	if sortField != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: direction})
+	}
+	return filter, sort, nil
+}
+
+// fieldType is the BSON type model stores at the dotted path field, for the
+// field types lists are sorted by
+func fieldType(model reflect.Type, field string) (bsontype.Type, bool) {
+	t := model
+	for _, name := range strings.Split(field, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return 0, false
+		}
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if tag, _, _ := strings.Cut(t.Field(i).Tag.Get("bson"), ","); tag == name {
+				t, found = t.Field(i).Type, true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeFor[time.Time]():
+		return bson.TypeDateTime, true
+	case t == reflect.TypeFor[primitive.ObjectID]():
+		return bson.TypeObjectID, true
+	case t.Kind() == reflect.String:
+		return bson.TypeString, true
+	case t.Kind() == reflect.Bool:
+		return bson.TypeBoolean, true
+	case t.Kind() == reflect.Float64:
+		return bson.TypeDouble, true
+	}
+	return 0, false
+}
+
+func pageSortField(page *utils.PageRequest) string {
+	if page.SortField == "" {
+		return "_id"
+	}
+	return page.SortField
+}
+
+// finishPage trims the look-ahead item and issues the cursor for the next page
+func finishPage[T any](items []T, raws []bson.Raw, page *utils.PageRequest) ([]T, *utils.PageInfo, error) {
+	info := &utils.PageInfo{Limit: page.Limit}
+	if int64(len(items)) > page.Limit {
+		items = items[:page.Limit]
+		token, err := encodeCursor(raws[page.Limit-1], pageSortField(page), page.SortDesc)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.HasMore = true
+		info.NextCursor = token
+	}
+
+	return items, info, nil
+}
+
+func encodeCursor(last bson.Raw, sortField string, desc bool) (string, error) {
+	id, ok := last.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", fmt.Errorf("document has no object id")
+	}
+	value, err := last.LookupErr(strings.Split(sortField, ".")...)
+	if err != nil {
+		// documents missing the sort field sort as null
+		value = bson.RawValue{Type: bson.TypeNull}
+	}
+	cursor := pageCursor{
+		SortField: sortField,
+		SortDesc:  desc,
+		Value:     value,
+		ID:        id,
+	}
+	b, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("could not encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(token string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err := bson.Unmarshal(b, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
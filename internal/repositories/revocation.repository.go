@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	revokedTokenKind = "token"
+	revokedUserKind  = "user"
+)
+
+// RevocationRepository is the Mongo backed services.RevocationStore. Entries
+// carry an expiresAt so the TTL index drops them once the tokens are dead.
+type RevocationRepository interface {
+	RevokeToken(ctx context.Context, jti string, userId string, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userId string, before time.Time, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	UserTokensRevokedBefore(ctx context.Context, userId string) (time.Time, error)
+}
+
+type revocationRepository struct {
+	db         Database
+	collection string
+}
+
+func NewRevocationRepository(db Database, collection string) RevocationRepository {
+	return &revocationRepository{
+		db:         db,
+		collection: collection,
+	}
+}
+
+func (rr *revocationRepository) RevokeToken(ctx context.Context, jti string, userId string, expiresAt time.Time) error {
+	defer metrics.ObserveMongo("revocation", "RevokeToken")()
+	collection := rr.db.Collection(rr.collection)
+
+	_userId, _ := primitive.ObjectIDFromHex(userId)
+	filter := bson.M{"_id": revokedTokenKind + ":" + jti}
+	update := bson.M{"$setOnInsert": models.RevokedToken{
+		ID:        revokedTokenKind + ":" + jti,
+		Kind:      revokedTokenKind,
+		UserID:    _userId,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}}
+
+	if _, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("could not revoke token: %w", err)
+	}
+	return nil
+}
+
+func (rr *revocationRepository) RevokeUserTokens(ctx context.Context, userId string, before time.Time, expiresAt time.Time) error {
+	defer metrics.ObserveMongo("revocation", "RevokeUserTokens")()
+	_userId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+	collection := rr.db.Collection(rr.collection)
+
+	filter := bson.M{"_id": revokedUserKind + ":" + userId}
+	update := bson.M{
+		"$max": bson.M{"revokedBefore": before, "expiresAt": expiresAt},
+		"$setOnInsert": bson.M{
+			"kind":      revokedUserKind,
+			"userId":    _userId,
+			"createdAt": time.Now(),
+		},
+	}
+
+	if _, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("could not revoke user tokens: %w", err)
+	}
+	return nil
+}
+
+func (rr *revocationRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	defer metrics.ObserveMongo("revocation", "IsTokenRevoked")()
+	collection := rr.db.Collection(rr.collection)
+
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": revokedTokenKind + ":" + jti}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("could not check token revocation: %w", err)
+	}
+	return count > 0, nil
+}
+
+// returns the zero time when the user has no revoke-all in effect
+func (rr *revocationRepository) UserTokensRevokedBefore(ctx context.Context, userId string) (time.Time, error) {
+	defer metrics.ObserveMongo("revocation", "UserTokensRevokedBefore")()
+	collection := rr.db.Collection(rr.collection)
+
+	var entry models.RevokedToken
+	err := collection.FindOne(ctx, bson.M{"_id": revokedUserKind + ":" + userId}).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not check user revocation: %w", err)
+	}
+	return entry.RevokedBefore, nil
+}
@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrSessionNotFound is returned when no session exists for a refresh token
+	ErrSessionNotFound = errors.New("refresh session not found")
+	// ErrSessionReused is returned when a refresh token that was already
+	// rotated or revoked is presented again
+	ErrSessionReused = errors.New("refresh token has already been used")
+)
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.RefreshSession) error
+	RotateSession(ctx context.Context, id string, replacedBy string) (*models.RefreshSession, error)
+	RevokeFamily(ctx context.Context, familyId string) error
+	RevokeUserSessions(ctx context.Context, userId string) error
+}
+
+type sessionRepository struct {
+	db         Database
+	collection string
+}
+
+func NewSessionRepository(db Database, collection string) SessionRepository {
+	return &sessionRepository{
+		db:         db,
+		collection: collection,
+	}
+}
+
+func (s *sessionRepository) CreateSession(ctx context.Context, session *models.RefreshSession) error {
+	defer metrics.ObserveMongo("session", "CreateSession")()
+	collection := s.db.Collection(s.collection)
+
+	session.CreatedAt = time.Now()
+
+	if _, err := collection.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("could not create session: %w", err)
+	}
+	return nil
+}
+
+// RotateSession atomically marks an active session as rotated. If the session
+// exists but was already rotated or revoked, ErrSessionReused is returned.
+func (s *sessionRepository) RotateSession(ctx context.Context, id string, replacedBy string) (*models.RefreshSession, error) {
+	defer metrics.ObserveMongo("session", "RotateSession")()
+	collection := s.db.Collection(s.collection)
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":       id,
+		"rotatedAt": bson.M{"$exists": false},
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"rotatedAt": now, "replacedBy": replacedBy}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var session models.RefreshSession
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&session)
+	if err == nil {
+		return &session, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("could not rotate session: %w", err)
+	}
+
+	// distinguish a token we never issued (or that expired) from a replayed one
+	err = collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not find session: %w", err)
+	}
+	if session.RotatedAt != nil || session.RevokedAt != nil {
+		return &session, ErrSessionReused
+	}
+	return nil, ErrSessionNotFound
+}
+
+func (s *sessionRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	defer metrics.ObserveMongo("session", "RevokeFamily")()
+	return s.revoke(ctx, bson.M{"familyId": familyId})
+}
+
+func (s *sessionRepository) RevokeUserSessions(ctx context.Context, userId string) error {
+	defer metrics.ObserveMongo("session", "RevokeUserSessions")()
+	_id, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+	return s.revoke(ctx, bson.M{"userId": _id})
+}
+
+func (s *sessionRepository) revoke(ctx context.Context, filter bson.M) error {
+	collection := s.db.Collection(s.collection)
+
+	filter["revokedAt"] = bson.M{"$exists": false}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+
+	if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("could not revoke sessions: %w", err)
+	}
+	return nil
+}
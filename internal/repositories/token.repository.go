@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrTokenNotUsable is returned for unknown, expired or already used tokens
+var ErrTokenNotUsable = errors.New("token is invalid or has expired")
+
+type UserTokenRepository interface {
+	CreateToken(ctx context.Context, token *models.UserToken) error
+	ConsumeToken(ctx context.Context, purpose utils.TokenPurpose, tokenHash string) (*models.UserToken, error)
+	InvalidateUserTokens(ctx context.Context, userId primitive.ObjectID, purpose utils.TokenPurpose) error
+}
+
+type userTokenRepository struct {
+	db         Database
+	collection string
+}
+
+func NewUserTokenRepository(db Database, collection string) UserTokenRepository {
+	return &userTokenRepository{
+		db:         db,
+		collection: collection,
+	}
+}
+
+func (t *userTokenRepository) CreateToken(ctx context.Context, token *models.UserToken) error {
+	defer metrics.ObserveMongo("token", "CreateToken")()
+	collection := t.db.Collection(t.collection)
+
+	token.CreatedAt = time.Now()
+
+	res, err := collection.InsertOne(ctx, token)
+	if err != nil {
+		return fmt.Errorf("could not create token: %w", err)
+	}
+	token.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ConsumeToken atomically marks an unused, unexpired token as used so it can
+// only be redeemed once
+func (t *userTokenRepository) ConsumeToken(ctx context.Context, purpose utils.TokenPurpose, tokenHash string) (*models.UserToken, error) {
+	defer metrics.ObserveMongo("token", "ConsumeToken")()
+	collection := t.db.Collection(t.collection)
+
+	now := time.Now()
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"purpose":   purpose,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"usedAt": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var token models.UserToken
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrTokenNotUsable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not consume token: %w", err)
+	}
+	return &token, nil
+}
+
+// InvalidateUserTokens burns every outstanding token of a purpose, so only the
+// most recently emailed link works
+func (t *userTokenRepository) InvalidateUserTokens(ctx context.Context, userId primitive.ObjectID, purpose utils.TokenPurpose) error {
+	defer metrics.ObserveMongo("token", "InvalidateUserTokens")()
+	collection := t.db.Collection(t.collection)
+
+	filter := bson.M{"userId": userId, "purpose": purpose, "usedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"usedAt": time.Now()}}
+
+	if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("could not invalidate tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package repositories
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// withUpdatedAt stamps updatedAt onto an update document's $set
+func withUpdatedAt(update bson.M) bson.M {
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+	}
+	set["updatedAt"] = time.Now()
+	update["$set"] = set
+	return update
+}
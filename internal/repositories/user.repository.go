@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
 	"github/Chidi-creator/go-medic-server/internal/models"
 	"time"
 
@@ -17,29 +18,33 @@ type UserRepository interface {
 	GetUserById(ctx context.Context, id string) (*models.User, error)
 	UpdateUserById(ctx context.Context, id string, updateQuery bson.M) error
 	DeleteUserById(ctx context.Context, id string) (int64, error)
+	UseMFAStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, codeHash string) (bool, error)
 }
 
 type userRepository struct {
-	client         *mongo.Client
-	dbName         string
+	db             Database
 	collectionName string
 }
 
-func NewUserRepository(client *mongo.Client, dbName string, collectionName string) UserRepository {
+func NewUserRepository(db Database, collectionName string) UserRepository {
 	return &userRepository{
-		client:         client,
-		dbName:         dbName,
+		db:             db,
 		collectionName: collectionName,
 	}
 }
 
 func (u *userRepository) RegisterUser(ctx context.Context, user *models.User) (*models.User, error) {
-	collection := u.client.Database(u.dbName).Collection(u.collectionName)
+	defer metrics.ObserveMongo("user", "RegisterUser")()
+	collection := u.db.Collection(u.collectionName)
 
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
 	res, err := collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrEmailTaken
+	}
 	if err != nil {
 		return nil, fmt.Errorf("could not insert user: %w", err)
 	}
@@ -50,7 +55,8 @@ func (u *userRepository) RegisterUser(ctx context.Context, user *models.User) (*
 }
 
 func (u *userRepository) GetUsersByQuery(ctx context.Context, filter bson.M) ([]models.User, error) {
-	collection := u.client.Database(u.dbName).Collection(u.collectionName)
+	defer metrics.ObserveMongo("user", "GetUsersByQuery")()
+	collection := u.db.Collection(u.collectionName)
 
 	cur, err := collection.Find(ctx, filter)
 	if err != nil {
@@ -72,13 +78,13 @@ func (u *userRepository) GetUsersByQuery(ctx context.Context, filter bson.M) ([]
 }
 
 func (u *userRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	defer metrics.ObserveMongo("user", "GetUserById")()
 
-	_id, err := primitive.ObjectIDFromHex(id)
-
+	_id, err := parseID(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+		return nil, err
 	}
-	collection := u.client.Database(u.dbName).Collection(u.collectionName)
+	collection := u.db.Collection(u.collectionName)
 
 	filter := bson.M{"_id": _id}
 
@@ -87,7 +93,7 @@ func (u *userRepository) GetUserById(ctx context.Context, id string) (*models.Us
 	err = collection.FindOne(ctx, filter).Decode(&user)
 
 	if err != nil {
-		return nil, fmt.Errorf("could not find User: %w", err)
+		return nil, findErr(err, ErrUserNotFound, "could not find user")
 	}
 
 	return &user, nil
@@ -95,12 +101,12 @@ func (u *userRepository) GetUserById(ctx context.Context, id string) (*models.Us
 }
 
 func (u *userRepository) UpdateUserById(ctx context.Context, id string, updateQuery bson.M) error {
-	collection := u.client.Database(u.dbName).Collection(u.collectionName)
-
-	_id, err := primitive.ObjectIDFromHex(id)
+	defer metrics.ObserveMongo("user", "UpdateUserById")()
+	collection := u.db.Collection(u.collectionName)
 
+	_id, err := parseID(id)
 	if err != nil {
-		return fmt.Errorf("invalid user ID: %w", err)
+		return err
 	}
 
 	filter := bson.M{"_id": _id}
@@ -111,7 +117,7 @@ func (u *userRepository) UpdateUserById(ctx context.Context, id string, updateQu
 	}
 
 	if res.MatchedCount == 0 {
-		return fmt.Errorf("no documents matched: %w", err)
+		return ErrUserNotFound
 	}
 
 	return nil
@@ -119,11 +125,12 @@ func (u *userRepository) UpdateUserById(ctx context.Context, id string, updateQu
 }
 
 func (u *userRepository) DeleteUserById(ctx context.Context, id string) (int64, error) {
-	collection := u.client.Database(u.dbName).Collection(u.collectionName)
+	defer metrics.ObserveMongo("user", "DeleteUserById")()
+	collection := u.db.Collection(u.collectionName)
 
-	_id, err := primitive.ObjectIDFromHex(id)
+	_id, err := parseID(id)
 	if err != nil {
-		return 0, fmt.Errorf("invalid user ID: %w", err)
+		return 0, err
 	}
 
 	filter := bson.M{"_id": _id}
@@ -135,3 +142,31 @@ func (u *userRepository) DeleteUserById(ctx context.Context, id string) (int64,
 	}
 	return res.DeletedCount, nil
 }
+
+// UseMFAStep records step as the last accepted TOTP step. It reports false when
+// that step or a later one was already used, i.e. the code is being replayed.
+func (u *userRepository) UseMFAStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error) {
+	defer metrics.ObserveMongo("user", "UseMFAStep")()
+	collection := u.db.Collection(u.collectionName)
+
+	filter := bson.M{"_id": id, "mfa.enabled": true, "mfa.lastUsedStep": bson.M{"$lt": step}}
+	res, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"mfa.lastUsedStep": step}})
+	if err != nil {
+		return false, fmt.Errorf("could not record MFA step: %w", err)
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes a recovery code, reporting false when it was not
+// one of the user's unused codes
+func (u *userRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, codeHash string) (bool, error) {
+	defer metrics.ObserveMongo("user", "UseRecoveryCode")()
+	collection := u.db.Collection(u.collectionName)
+
+	filter := bson.M{"_id": id, "mfa.enabled": true, "mfa.recoveryCodes": codeHash}
+	res, err := collection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"mfa.recoveryCodes": codeHash}})
+	if err != nil {
+		return false, fmt.Errorf("could not use recovery code: %w", err)
+	}
+	return res.ModifiedCount == 1, nil
+}
@@ -3,8 +3,11 @@ package routes
 import (
 	"github/Chidi-creator/go-medic-server/internal/handlers"
 	"github/Chidi-creator/go-medic-server/internal/middleware"
-	"log"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -16,6 +19,20 @@ type Router struct {
 	HospitalHandler    handlers.HospitalHandler
 	AppointmentHandler handlers.AppointmentHandler
 	AuthHandler        handlers.AuthHandler
+	InviteHandler      handlers.DoctorInviteHandler
+	HealthHandler      *handlers.HealthHandler
+	Authorizer         *middleware.Authorizer
+	Limiter            services.RateLimitStore
+	Authenticate       mux.MiddlewareFunc
+	TrustedProxies     utils.TrustedProxies
+}
+
+// mfaExempt are the only protected routes staff may call without MFA: enough
+// to enrol and to log out
+var mfaExempt = []string{
+	"POST /auth/mfa/enroll",
+	"POST /auth/mfa/confirm",
+	"POST /auth/logout",
 }
 
 func NewRouter(h handlers.UserHandler,
@@ -23,6 +40,12 @@ func NewRouter(h handlers.UserHandler,
 	hh handlers.HospitalHandler,
 	a handlers.AppointmentHandler,
 	ah *handlers.AuthHandler,
+	ih handlers.DoctorInviteHandler,
+	hc *handlers.HealthHandler,
+	az *middleware.Authorizer,
+	rl services.RateLimitStore,
+	tokens *services.TokenService,
+	proxies utils.TrustedProxies,
 ) *Router {
 	return &Router{
 		R:                  mux.NewRouter(),
@@ -31,57 +54,129 @@ func NewRouter(h handlers.UserHandler,
 		HospitalHandler:    hh,
 		AppointmentHandler: a,
 		AuthHandler:        *ah,
+		InviteHandler:      ih,
+		HealthHandler:      hc,
+		Authorizer:         az,
+		Limiter:            rl,
+		Authenticate:       authenticate(middleware.AuthMiddleware(tokens), az.RequireMFA(mfaExempt...)),
+		TrustedProxies:     proxies,
 	}
 }
 
 func (r *Router) SetUpRoutes() {
-	log.Println("Setting up routes")
-	r.R.HandleFunc("/healthcheck", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("<h1>Chidi Medic Server Up and Running<h1>"))
-	})
+	slog.Info("Setting up routes")
+	r.R.Use(middleware.ClientIP(r.TrustedProxies), middleware.RequestLogger, middleware.Metrics)
+	//probes
+	r.R.HandleFunc("/livez", r.HealthHandler.Live).Methods("GET")
+	r.R.HandleFunc("/readyz", r.HealthHandler.Ready).Methods("GET")
+	r.R.HandleFunc("/healthcheck", r.HealthHandler.Live).Methods("GET")
+	// /metrics is served on the admin listener, see app.App.AdminHandler
 
 	//user routes
 
 	userRouter := r.R.PathPrefix("/users").Subrouter()
+	self := r.Authorizer.RequireOwner(r.Authorizer.UserSelf)
 
-	userRouter.HandleFunc("", r.UserHandler.RegisterUser).Methods("POST")
-	userRouter.HandleFunc("/{id}", r.UserHandler.GetUserById).Methods("GET")
-	userRouter.HandleFunc("/{id}", r.UserHandler.UpdateUserById).Methods("PATCH")
-	userRouter.HandleFunc("/{id}", r.UserHandler.DeleteUserById).Methods("DELETE")
+	userRouter.Handle("", r.limit("register", 10, time.Hour, middleware.KeyByIP)(http.HandlerFunc(r.UserHandler.RegisterUser))).Methods("POST")
+	userRouter.Handle("/{id}", r.protect(r.UserHandler.GetUserById, self)).Methods("GET")
+	userRouter.Handle("/{id}", r.protect(r.UserHandler.UpdateUserById, self)).Methods("PATCH")
+	userRouter.Handle("/{id}", r.protect(r.UserHandler.DeleteUserById, self)).Methods("DELETE")
 
-	
 	//auth routes
 	authRouter := r.R.PathPrefix("/auth").Subrouter()
-
-	authRouter.HandleFunc("/login", r.AuthHandler.LoginUser).Methods("POST")
-	//protect refresh route
-	authRouter.Handle("/refresh", middleware.AuthMiddleware(http.HandlerFunc(r.AuthHandler.GenerateRefreshToken))).Methods("GET")
+	authRouter.Use(r.limit("auth", 60, time.Minute, middleware.KeyByIP))
+
+	authRouter.Handle("/login", r.limit("login", 10, time.Minute, middleware.KeyByIP)(http.HandlerFunc(r.AuthHandler.LoginUser))).Methods("POST")
+	authRouter.HandleFunc("/refresh", r.AuthHandler.RefreshToken).Methods("POST")
+	authRouter.Handle("/logout", r.protect(r.AuthHandler.Logout)).Methods("POST")
+	authRouter.Handle("/forgot-password", r.limit("forgot-password", 5, 15*time.Minute, middleware.KeyByIP)(http.HandlerFunc(r.AuthHandler.ForgotPassword))).Methods("POST")
+	authRouter.HandleFunc("/reset-password", r.AuthHandler.ResetPassword).Methods("POST")
+	authRouter.HandleFunc("/verify-email", r.AuthHandler.VerifyEmail).Methods("POST")
+	authRouter.Handle("/verify-email/resend", r.protect(r.AuthHandler.ResendVerificationEmail)).Methods("POST")
+	authRouter.Handle("/users/{id}/revoke-sessions", r.protect(r.AuthHandler.RevokeUserSessions, r.Authorizer.RequireRoles(utils.ADMIN))).Methods("POST")
+	authRouter.Handle("/users/{id}/unlock", r.protect(r.AuthHandler.UnlockUser, r.Authorizer.RequireRoles(utils.ADMIN))).Methods("POST")
+
+	//mfa routes; enrolment only needs a token, so staff can enrol before the MFA policy lets them in elsewhere
+	authRouter.Handle("/mfa/verify", r.limit("login", 10, time.Minute, middleware.KeyByIP)(http.HandlerFunc(r.AuthHandler.VerifyMFA))).Methods("POST")
+	authRouter.Handle("/mfa/enroll", r.protect(r.AuthHandler.EnrollMFA)).Methods("POST")
+	authRouter.Handle("/mfa/confirm", r.protect(r.AuthHandler.ConfirmMFA)).Methods("POST")
+	authRouter.Handle("/mfa/disable", r.protect(r.AuthHandler.DisableMFA)).Methods("POST")
 
 	doctorRouter := r.R.PathPrefix("/doctors").Subrouter()
-
-	doctorRouter.HandleFunc("", r.DoctorHandler.CreateDoctor).Methods("POST")
+	hospitalStaff := r.Authorizer.RequireRoles(utils.HOSPITAL, utils.ADMIN)
+	doctorManagers := r.Authorizer.RequireOwner(r.Authorizer.DoctorManagers)
+	doctorHospitalOwner := r.Authorizer.RequireOwner(r.Authorizer.HospitalManagersForDoctor)
+
+	doctorRouter.Handle("", r.protect(r.DoctorHandler.CreateDoctor, hospitalStaff)).Methods("POST")
+
+	//doctor invite routes
+	doctorRouter.HandleFunc("/invites/{token}", r.InviteHandler.GetInvite).Methods("GET")
+	doctorRouter.Handle("/invites/{token}/accept", r.protect(r.InviteHandler.AcceptInvite)).Methods("POST")
+	doctorRouter.Handle("/invites/{token}/reject", r.protect(r.InviteHandler.RejectInvite)).Methods("POST")
+	doctorRouter.Handle("/invites/{id}/resend", r.protect(r.InviteHandler.ResendInvite, hospitalStaff)).Methods("POST")
+	doctorRouter.Handle("/{id}/invites", r.protect(r.InviteHandler.InviteDoctor, hospitalStaff, doctorHospitalOwner)).Methods("POST")
+
+	doctorRouter.HandleFunc("/{id}/slots", r.DoctorHandler.GetAvailableSlots).Methods("GET")
+	doctorRouter.HandleFunc("/{id}/availability", r.DoctorHandler.GetAvailability).Methods("GET")
+	doctorRouter.Handle("/{id}/availability", r.protect(r.DoctorHandler.SetAvailability, doctorManagers)).Methods("PUT")
+	doctorRouter.HandleFunc("/hospital/{id}", r.DoctorHandler.GetDoctorsByHospitalId).Methods("GET")
 	doctorRouter.HandleFunc("/{id}", r.DoctorHandler.FindDoctorById).Methods("GET")
-	doctorRouter.HandleFunc("/{id}", r.DoctorHandler.GetDoctorsByHospitalId).Methods("GET")
-	doctorRouter.HandleFunc("/{id}", r.DoctorHandler.UpdateDoctorById).Methods("PATCH")
-	doctorRouter.HandleFunc("/{id}", r.DoctorHandler.DeleteDoctorByUserId).Methods("DELETE")
+	doctorRouter.Handle("/{id}", r.protect(r.DoctorHandler.UpdateDoctorById, doctorManagers)).Methods("PATCH")
+	doctorRouter.Handle("/{id}", r.protect(r.DoctorHandler.DeleteDoctorByUserId, doctorHospitalOwner)).Methods("DELETE")
 
 	appointmentRouter := r.R.PathPrefix("/appointments").Subrouter()
-	appointmentRouter.Use(middleware.AuthMiddleware) // Protect all appointment routes
+	appointmentRouter.Use(r.Authenticate) // Protect all appointment routes
+	appointmentRouter.Use(r.limit("appointments", 120, time.Minute, middleware.KeyByUser))
+	participants := r.Authorizer.RequireOwner(r.Authorizer.AppointmentParticipants)
 
 	appointmentRouter.HandleFunc("", r.AppointmentHandler.CreateAppointment).Methods("POST")
-	appointmentRouter.HandleFunc("/{id}", r.AppointmentHandler.GetSingleAppointmentById).Methods("GET")
-	appointmentRouter.HandleFunc("/user/{id}", r.AppointmentHandler.GetAppointmentsByUserId).Methods("GET")
-	appointmentRouter.HandleFunc("/doctor/{id}", r.AppointmentHandler.GetAppointmentsByDoctorId).Methods("GET")
-	appointmentRouter.HandleFunc("/{id}", r.AppointmentHandler.UpdateAppointmentById).Methods("PATCH")
-	appointmentRouter.HandleFunc("/{id}", r.AppointmentHandler.DeleteAppointmentById).Methods("DELETE")
+	appointmentRouter.Handle("", r.Authorizer.RequireRoles(utils.ADMIN)(http.HandlerFunc(r.AppointmentHandler.GetAppointments))).Methods("GET")
+	appointmentRouter.Handle("/{id}", participants(http.HandlerFunc(r.AppointmentHandler.GetSingleAppointmentById))).Methods("GET")
+	appointmentRouter.Handle("/user/{id}", self(http.HandlerFunc(r.AppointmentHandler.GetAppointmentsByUserId))).Methods("GET")
+	appointmentRouter.Handle("/doctor/{id}", doctorManagers(http.HandlerFunc(r.AppointmentHandler.GetAppointmentsByDoctorId))).Methods("GET")
+	appointmentRouter.Handle("/{id}", participants(http.HandlerFunc(r.AppointmentHandler.UpdateAppointmentById))).Methods("PATCH")
+	appointmentRouter.Handle("/{id}/check-in", participants(http.HandlerFunc(r.AppointmentHandler.CheckInAppointment))).Methods("POST")
+	appointmentRouter.Handle("/{id}/start", participants(http.HandlerFunc(r.AppointmentHandler.StartAppointment))).Methods("POST")
+	appointmentRouter.Handle("/{id}/complete", participants(http.HandlerFunc(r.AppointmentHandler.CompleteAppointment))).Methods("POST")
+	appointmentRouter.Handle("/{id}/cancel", participants(http.HandlerFunc(r.AppointmentHandler.CancelAppointment))).Methods("POST")
+	appointmentRouter.Handle("/{id}/no-show", participants(http.HandlerFunc(r.AppointmentHandler.MarkAppointmentNoShow))).Methods("POST")
+	// participants cancel instead, so the history survives; deleting is for admins
+	appointmentRouter.Handle("/{id}", r.Authorizer.RequireRoles(utils.ADMIN)(http.HandlerFunc(r.AppointmentHandler.DeleteAppointmentById))).Methods("DELETE")
 
 	hospitalRouter := r.R.PathPrefix("/hospitals").Subrouter()
-	hospitalRouter.Use(middleware.AuthMiddleware) // Protect all hospital routes
+	hospitalRouter.Use(r.Authenticate) // Protect all hospital routes
+	hospitalRouter.Use(r.limit("hospitals", 120, time.Minute, middleware.KeyByUser))
+	hospitalOwner := r.Authorizer.RequireOwner(r.Authorizer.HospitalOwners)
 
 	hospitalRouter.HandleFunc("", r.HospitalHandler.CreateHospital).Methods("POST")
+	// geo queries are the most expensive reads, so each user gets a tighter budget
+	hospitalRouter.Handle("/nearby", r.limit("nearby", 30, time.Minute, middleware.KeyByUser)(http.HandlerFunc(r.HospitalHandler.GetNearbyHospitals))).Methods("GET")
 	hospitalRouter.HandleFunc("/{id}", r.HospitalHandler.GetHospitalById).Methods("GET")
 	hospitalRouter.HandleFunc("", r.HospitalHandler.GetAllHospitals).Methods("GET")
-	hospitalRouter.HandleFunc("/{id}", r.HospitalHandler.UpdateHospitalById).Methods("PATCH")
-	hospitalRouter.HandleFunc("/{id}", r.HospitalHandler.DeleteHospital).Methods("DELETE")
+	hospitalRouter.Handle("/{id}", hospitalOwner(http.HandlerFunc(r.HospitalHandler.UpdateHospitalById))).Methods("PATCH")
+	hospitalRouter.Handle("/{id}", hospitalOwner(http.HandlerFunc(r.HospitalHandler.DeleteHospital))).Methods("DELETE")
+
+}
 
+// authenticate validates the token and then enforces the MFA policy, so no
+// protected route can skip it
+func authenticate(validate, mfa mux.MiddlewareFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return validate(mfa(next))
+	}
+}
+
+// limit builds a rate limiting middleware backed by the router's store
+func (r *Router) limit(name string, requests int, per time.Duration, key middleware.RateLimitKey) mux.MiddlewareFunc {
+	return middleware.RateLimit(r.Limiter, name, services.RateLimit{Requests: requests, Per: per}, key)
+}
+
+// protect requires a valid token and then applies the given authorisation
+// middlewares in order
+func (r *Router) protect(h http.HandlerFunc, mws ...mux.MiddlewareFunc) http.Handler {
+	var handler http.Handler = h
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	return r.Authenticate(handler)
 }
@@ -1,81 +1,212 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github/Chidi-creator/go-medic-server/config"
-
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var JWT_SECRET = []byte(config.AppConfig.JWT_SECRET)
+// token subjects, used to stop one kind of token being accepted as another
+const (
+	AccessTokenSubject       = "access"
+	RefreshTokenSubject      = "refresh"
+	MFAChallengeTokenSubject = "mfa_challenge"
+	inviteTokenSubject       = "doctor_invite"
+)
 
-// expiry time for initial access and
 var (
-	AccessTokenExpiry  = time.Hour
-	RefreshTokenExpiry = 7 * 24 * time.Hour
+	// ErrInvalidToken is returned for tokens that are malformed, badly signed,
+	// expired or of the wrong kind
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrTokenRevoked is returned for access tokens revoked by logout or an admin
+	ErrTokenRevoked = errors.New("token has been revoked")
 )
 
+// TokenConfig is the signing key and the lifetime of each kind of token
+type TokenConfig struct {
+	Secret             []byte
+	AccessTokenExpiry  time.Duration
+	RefreshTokenExpiry time.Duration
+	// how long a user has to enter their TOTP code after the password step
+	MFAChallengeExpiry time.Duration
+	// how long an emailed doctor invite stays valid
+	InviteTokenExpiry time.Duration
+}
+
+// TokenService issues and validates every JWT the server hands out
+type TokenService struct {
+	cfg         TokenConfig
+	revocations *RevocationChecker
+}
+
+// NewTokenService builds the token service; access tokens are checked against
+// revocations when it is not nil
+func NewTokenService(cfg TokenConfig, revocations *RevocationChecker) *TokenService {
+	return &TokenService{
+		cfg:         cfg,
+		revocations: revocations,
+	}
+}
+
+func (t *TokenService) AccessTokenExpiry() time.Duration {
+	return t.cfg.AccessTokenExpiry
+}
+
+func (t *TokenService) InviteTokenExpiry() time.Duration {
+	return t.cfg.InviteTokenExpiry
+}
+
 // jwt claims
 type Claims struct {
 	UserID string `json:"userid"`
+	// FamilyID links every refresh token rotated from the same login
+	FamilyID string `json:"fid,omitempty"`
+	// MFA is set when the login that started the token family passed a second factor
+	MFA bool `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userId primitive.ObjectID, tokenType string) (string, error) {
+func (t *TokenService) GenerateToken(userId primitive.ObjectID, tokenType string, mfa bool) (string, error) {
+	token, _, err := t.issueToken(userId, tokenType, "", mfa)
+	return token, err
+}
+
+// GenerateRefreshToken issues a refresh token in the given family and returns
+// its claims so the caller can persist the session under the token's ID
+func (t *TokenService) GenerateRefreshToken(userId primitive.ObjectID, familyId string, mfa bool) (string, *Claims, error) {
+	return t.issueToken(userId, RefreshTokenSubject, familyId, mfa)
+}
+
+func (t *TokenService) issueToken(userId primitive.ObjectID, tokenType string, familyId string, mfa bool) (string, *Claims, error) {
 	var expirationTime time.Duration
-	var subject string
 
 	switch tokenType {
-	case "access":
-		expirationTime = AccessTokenExpiry
-		subject = "access"
-	case "refresh":
-		expirationTime = RefreshTokenExpiry
-		subject = "refesh"
+	case AccessTokenSubject:
+		expirationTime = t.cfg.AccessTokenExpiry
+	case RefreshTokenSubject:
+		expirationTime = t.cfg.RefreshTokenExpiry
+	case MFAChallengeTokenSubject:
+		expirationTime = t.cfg.MFAChallengeExpiry
 	default:
-		return "", fmt.Errorf("invalid Token Type")
+		return "", nil, fmt.Errorf("invalid Token Type")
 
 	}
 
+	now := time.Now()
 	claims := &Claims{
-		UserID: userId.Hex(),
+		UserID:   userId.Hex(),
+		FamilyID: familyId,
+		MFA:      mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expirationTime)),
+			ID:        primitive.NewObjectID().Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expirationTime)),
 			Issuer:    "medic-server",
-			Subject:   subject,
+			Subject:   tokenType,
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	accessToken, err := token.SignedString(JWT_SECRET)
+	signed, err := token.SignedString(t.cfg.Secret)
 
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	return signed, claims, nil
+}
+
+// ValidateToken validates an access token and checks it has not been revoked
+func (t *TokenService) ValidateToken(ctx context.Context, tokenstr string) (*Claims, error) {
+	claims := &Claims{}
+	if err := t.parseToken(tokenstr, AccessTokenSubject, claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if t.revocations != nil {
+		// a failed lookup is our problem, not the token's, so it is not
+		// reported as ErrInvalidToken
+		revoked, err := t.revocations.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, fmt.Errorf("could not check token revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
 	}
 
-	return accessToken, nil
+	return claims, nil
 }
 
-func ValidateToken(tokenstr string) (*Claims, error) {
+// ValidateRefreshToken validates a refresh token; access tokens are rejected
+func (t *TokenService) ValidateRefreshToken(tokenstr string) (*Claims, error) {
 	claims := &Claims{}
+	if err := t.parseToken(tokenstr, RefreshTokenSubject, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
 
+// ValidateMFAChallengeToken validates the token handed out after a correct
+// password for an account with MFA enabled
+func (t *TokenService) ValidateMFAChallengeToken(tokenstr string) (*Claims, error) {
+	claims := &Claims{}
+	if err := t.parseToken(tokenstr, MFAChallengeTokenSubject, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (t *TokenService) parseToken(tokenstr string, subject string, claims jwt.Claims) error {
 	token, err := jwt.ParseWithClaims(tokenstr, claims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return JWT_SECRET, nil
-	})
+		return t.cfg.Secret, nil
+	}, jwt.WithSubject(subject))
 
 	if err != nil {
-		return nil, fmt.Errorf("error with parsing tokens: %w", err)
+		return fmt.Errorf("error with parsing tokens: %w", err)
 	}
 	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
+		return fmt.Errorf("invalid token")
 	}
 
+	return nil
+}
+
+// claims carried by a doctor invite token
+type InviteClaims struct {
+	InviteID string `json:"inviteid"`
+	Nonce    string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+func (t *TokenService) GenerateInviteToken(inviteId primitive.ObjectID, nonce string, expiresAt time.Time) (string, error) {
+	claims := &InviteClaims{
+		InviteID: inviteId.Hex(),
+		Nonce:    nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			Issuer:    "medic-server",
+			Subject:   inviteTokenSubject,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString(t.cfg.Secret)
+}
+
+func (t *TokenService) ValidateInviteToken(tokenstr string) (*InviteClaims, error) {
+	claims := &InviteClaims{}
+	if err := t.parseToken(tokenstr, inviteTokenSubject, claims); err != nil {
+		return nil, fmt.Errorf("invalid invite token: %w", err)
+	}
 	return claims, nil
 }
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// DependencyCheck probes one dependency; a nil error means it is usable
+type DependencyCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type DependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	// why the check failed; it names drivers, hosts and schema details, so it
+	// is logged and never served
+	Error string `json:"-"`
+}
+
+type HealthReport struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// HealthChecker runs every dependency check concurrently for readiness probes
+type HealthChecker struct {
+	checks  []DependencyCheck
+	timeout time.Duration
+}
+
+func NewHealthChecker(timeout time.Duration, checks ...DependencyCheck) *HealthChecker {
+	return &HealthChecker{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Check reports each dependency's status and latency; the instance is only up
+// when every dependency is
+func (h *HealthChecker) Check(ctx context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	report := HealthReport{
+		Status:       StatusUp,
+		Dependencies: make(map[string]DependencyStatus, len(h.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check DependencyCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check.Check(ctx)
+			status := DependencyStatus{
+				Status:    StatusUp,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				status.Status = StatusDown
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Dependencies[check.Name] = status
+			if err != nil {
+				report.Status = StatusDown
+			}
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	return report
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/logger"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends transactional email; swap implementations per environment
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailer builds the mailer selected by driver: "smtp", "log" (default) or
+// "file"; only smtp actually delivers anything
+func NewMailer(driver string, dir string, smtpConfig SMTPConfig) (Mailer, error) {
+	switch driver {
+	case "", "log":
+		return &LogMailer{}, nil
+	case "file":
+		return NewFileMailer(dir)
+	case "smtp":
+		return NewSMTPMailer(smtpConfig)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", driver)
+	}
+}
+
+// LogMailer writes emails to the application log, for local development.
+// Bodies carry live reset and verification links, and nothing is delivered,
+// so config refuses it in production.
+type LogMailer struct{}
+
+func (l *LogMailer) Send(ctx context.Context, msg Message) error {
+	logger.FromContext(ctx).Info("mail", "email", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileMailer writes each email as an .eml file into a directory, for local
+// development and QA; nothing is delivered
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if dir == "" {
+		dir = "mail"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (f *FileMailer) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFilename(msg.To))
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+
+	if err := os.WriteFile(filepath.Join(f.dir, name), []byte(content), 0o600); err != nil {
+		return fmt.Errorf("could not write mail: %w", err)
+	}
+	return nil
+}
+
+// SMTPConfig is the relay emails are delivered through
+type SMTPConfig struct {
+	Host string
+	Port string
+	// both empty to send without authenticating
+	Username string
+	Password string
+	// sender address of every email
+	From string
+	// how long one delivery may take when the caller sets no deadline
+	Timeout time.Duration
+}
+
+// SMTPMailer delivers email through an SMTP relay. It upgrades the connection
+// with STARTTLS whenever the relay offers it and refuses to send credentials
+// over a connection that was not upgraded.
+type SMTPMailer struct {
+	cfg  SMTPConfig
+	from *mail.Address
+}
+
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	if cfg.Host == "" || cfg.Port == "" {
+		return nil, errors.New("smtp mailer needs a host and a port")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %q: %w", cfg.From, err)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &SMTPMailer{cfg: cfg, from: from}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return errors.New("could not send mail: header contains a line break")
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.cfg.Timeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.cfg.Host, m.cfg.Port))
+	if err != nil {
+		return fmt.Errorf("could not reach mail relay: %w", err)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("could not greet mail relay: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return fmt.Errorf("could not start tls with mail relay: %w", err)
+		}
+	}
+	if m.cfg.Username != "" {
+		// PlainAuth itself refuses to send credentials in the clear to
+		// anything but localhost
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("could not authenticate with mail relay: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.from.Address); err != nil {
+		return fmt.Errorf("mail relay refused sender: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("mail relay refused recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("could not send mail: %w", err)
+	}
+	content := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		m.from.String(), msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	if _, err := w.Write([]byte(content)); err != nil {
+		return fmt.Errorf("could not send mail: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("could not send mail: %w", err)
+	}
+	return client.Quit()
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
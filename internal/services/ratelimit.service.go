@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit allows Requests per Per on average, in bursts of up to Requests
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l RateLimit) perSecond() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// RateLimitResult is the outcome of taking one request from a bucket
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// how long until the bucket is full again
+	Reset time.Duration
+	// how long until the next request would be allowed, when it was not
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps token buckets. MemoryRateLimitStore limits each
+// instance on its own; a shared store (e.g. Redis) can implement the same
+// interface to limit across instances.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   RateLimit
+}
+
+// refill tops the bucket up for the time passed since it was last touched
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Requests), b.tokens+now.Sub(b.updated).Seconds()*b.limit.perSecond())
+	b.updated = now
+}
+
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (m *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Requests), updated: now, limit: limit}
+		m.buckets[key] = b
+	}
+	b.refill(now)
+
+	result := RateLimitResult{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsDuration((1 - b.tokens) / limit.perSecond())
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsDuration((float64(limit.Requests) - b.tokens) / limit.perSecond())
+	return result, nil
+}
+
+// Run drops buckets that have refilled completely every interval until ctx
+// is cancelled; a full bucket is the same as no bucket
+func (m *MemoryRateLimitStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			m.mu.Lock()
+			for key, b := range m.buckets {
+				b.refill(now)
+				if b.tokens >= float64(b.limit.Requests) {
+					delete(m.buckets, key)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
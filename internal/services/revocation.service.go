@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationStore persists revoked token IDs and per-user cutoffs. Entries only
+// need to outlive the tokens they revoke.
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jti string, userId string, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userId string, before time.Time, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	UserTokensRevokedBefore(ctx context.Context, userId string) (time.Time, error)
+}
+
+type cachedLookup struct {
+	revoked  bool
+	cutoff   time.Time
+	cachedAt time.Time
+}
+
+// RevocationChecker fronts a RevocationStore with an in-process cache so
+// checking a token costs a map lookup on most requests
+type RevocationChecker struct {
+	store RevocationStore
+	// how long a lookup result is trusted before the store is asked again; a
+	// revocation made on another instance takes at most this long to apply here
+	ttl time.Duration
+	// access token lifetime; a revocation never needs to outlive it
+	tokenExpiry time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]cachedLookup
+	users  map[string]cachedLookup
+}
+
+func NewRevocationChecker(store RevocationStore, cacheTTL time.Duration, accessTokenExpiry time.Duration) *RevocationChecker {
+	return &RevocationChecker{
+		store:       store,
+		ttl:         cacheTTL,
+		tokenExpiry: accessTokenExpiry,
+		tokens:      make(map[string]cachedLookup),
+		users:       make(map[string]cachedLookup),
+	}
+}
+
+// RevokeToken revokes a single token until it would have expired anyway
+func (c *RevocationChecker) RevokeToken(ctx context.Context, claims *Claims) error {
+	if err := c.store.RevokeToken(ctx, claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.tokens[claims.ID] = cachedLookup{revoked: true, cachedAt: time.Now()}
+	c.mu.Unlock()
+	return nil
+}
+
+// RevokeUser invalidates every access token issued to the user before the
+// current second. iat only has second precision, so the cutoff is kept at the
+// same precision: a session started right after the revocation, in the same
+// second, must still work.
+func (c *RevocationChecker) RevokeUser(ctx context.Context, userId string) error {
+	now := time.Now()
+	cutoff := now.Truncate(time.Second)
+	if err := c.store.RevokeUserTokens(ctx, userId, cutoff, now.Add(c.tokenExpiry)); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.users[userId] = cachedLookup{cutoff: cutoff, cachedAt: now}
+	c.mu.Unlock()
+	return nil
+}
+
+// IsRevoked reports whether the token was revoked individually or by a
+// revoke-all for its user
+func (c *RevocationChecker) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	revoked, err := c.tokenRevoked(ctx, claims.ID)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	cutoff, err := c.userCutoff(ctx, claims.UserID)
+	if err != nil || cutoff.IsZero() || claims.IssuedAt == nil {
+		return false, err
+	}
+	return claims.IssuedAt.Time.Before(cutoff), nil
+}
+
+func (c *RevocationChecker) tokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if jti == "" {
+		return false, nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.tokens[jti]
+	c.mu.Unlock()
+	if ok && (entry.revoked || time.Since(entry.cachedAt) < c.ttl) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := c.store.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.sweepLocked()
+	c.tokens[jti] = cachedLookup{revoked: revoked, cachedAt: time.Now()}
+	c.mu.Unlock()
+	return revoked, nil
+}
+
+func (c *RevocationChecker) userCutoff(ctx context.Context, userId string) (time.Time, error) {
+	c.mu.Lock()
+	entry, ok := c.users[userId]
+	c.mu.Unlock()
+	if ok && time.Since(entry.cachedAt) < c.ttl {
+		return entry.cutoff, nil
+	}
+
+	cutoff, err := c.store.UserTokensRevokedBefore(ctx, userId)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	c.mu.Lock()
+	c.sweepLocked()
+	c.users[userId] = cachedLookup{cutoff: cutoff, cachedAt: time.Now()}
+	c.mu.Unlock()
+	return cutoff, nil
+}
+
+// Run sweeps stale entries every interval until ctx is cancelled, so an idle
+// instance does not hold on to lookups it will never reuse
+func (c *RevocationChecker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			c.purgeLocked()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// sweepLocked drops stale entries once the cache grows
+func (c *RevocationChecker) sweepLocked() {
+	const maxEntries = 10000
+	if len(c.tokens)+len(c.users) < maxEntries {
+		return
+	}
+	c.purgeLocked()
+}
+
+// purgeLocked drops stale entries; revoked tokens are kept until their access
+// token lifetime has certainly passed
+func (c *RevocationChecker) purgeLocked() {
+	now := time.Now()
+	for jti, entry := range c.tokens {
+		if now.Sub(entry.cachedAt) > c.ttl && (!entry.revoked || now.Sub(entry.cachedAt) > c.tokenExpiry) {
+			delete(c.tokens, jti)
+		}
+	}
+	for userId, entry := range c.users {
+		if now.Sub(entry.cachedAt) > c.ttl {
+			delete(c.users, userId)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/logger"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/repositories"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AccountConfig holds where emailed links point and how long they stay valid
+type AccountConfig struct {
+	AppURL                       string
+	PasswordResetTokenExpiry     time.Duration
+	EmailVerificationTokenExpiry time.Duration
+}
+
+// ErrInvalidUserToken is returned for unknown, expired or already used reset/verification tokens
+var ErrInvalidUserToken = utils.Validation("invalid_token", "token is invalid or has expired")
+
+// ErrEmailNotVerified is returned when an action trusts the user's email
+// address before it has been verified.
+//
+// Verification policy: signing up, logging in and everyday customer actions
+// work with an unverified address, so users can always reach the resend
+// flow. Anything that grants privileges because of the address itself, such
+// as answering a doctor invite, requires it to be verified first, since
+// anyone can register with any address.
+var ErrEmailNotVerified = utils.Forbidden("email_not_verified", "verify your email address first")
+
+type AccountUsecase interface {
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	SendVerificationEmail(ctx context.Context, user *models.User) error
+	ResendVerificationEmail(ctx context.Context, userId string) error
+	VerifyEmail(ctx context.Context, token string) error
+}
+
+type accountUsecase struct {
+	userRepo    repositories.UserRepository
+	tokenRepo   repositories.UserTokenRepository
+	sessionRepo repositories.SessionRepository
+	revocations *services.RevocationChecker
+	mailer      services.Mailer
+	cfg         AccountConfig
+}
+
+func NewAccountUsecase(userRepo repositories.UserRepository, tokenRepo repositories.UserTokenRepository, sessionRepo repositories.SessionRepository, revocations *services.RevocationChecker, mailer services.Mailer, cfg AccountConfig) AccountUsecase {
+	return &accountUsecase{
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		sessionRepo: sessionRepo,
+		revocations: revocations,
+		mailer:      mailer,
+		cfg:         cfg,
+	}
+}
+
+// RequestPasswordReset emails a reset link. Unknown emails are ignored without
+// an error so the endpoint does not reveal which accounts exist.
+func (a *accountUsecase) RequestPasswordReset(ctx context.Context, email string) error {
+	users, err := a.userRepo.GetUsersByQuery(ctx, bson.M{"email": email})
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	user := users[0]
+
+	token, err := a.issueToken(ctx, &user, utils.PASSWORD_RESET, a.cfg.PasswordResetTokenExpiry)
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, services.Message{
+		To:      user.Email,
+		Subject: "Reset your Medic password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %v.\n\n%s\n\nIf you did not ask for this, you can ignore this email.",
+			user.Firstname, a.cfg.PasswordResetTokenExpiry, a.link("/reset-password", token)),
+	})
+}
+
+// ResetPassword sets a new password and logs the user out everywhere
+func (a *accountUsecase) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	record, err := a.tokenRepo.ConsumeToken(ctx, utils.PASSWORD_RESET, hashToken(token))
+	if errors.Is(err, repositories.ErrTokenNotUsable) {
+		return ErrInvalidUserToken
+	}
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+
+	userId := record.UserID.Hex()
+	err = a.userRepo.UpdateUserById(ctx, userId, bson.M{
+		"$set": bson.M{"password": string(hashedPassword), "updatedAt": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := a.revocations.RevokeUser(ctx, userId); err != nil {
+		return err
+	}
+	return a.sessionRepo.RevokeUserSessions(ctx, userId)
+}
+
+func (a *accountUsecase) SendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := a.issueToken(ctx, user, utils.EMAIL_VERIFICATION, a.cfg.EmailVerificationTokenExpiry)
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, services.Message{
+		To:      user.Email,
+		Subject: "Verify your Medic email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address using the link below. It expires in %v.\n\n%s",
+			user.Firstname, a.cfg.EmailVerificationTokenExpiry, a.link("/verify-email", token)),
+	})
+}
+
+func (a *accountUsecase) ResendVerificationEmail(ctx context.Context, userId string) error {
+	user, err := a.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return a.SendVerificationEmail(ctx, user)
+}
+
+func (a *accountUsecase) VerifyEmail(ctx context.Context, token string) error {
+	record, err := a.tokenRepo.ConsumeToken(ctx, utils.EMAIL_VERIFICATION, hashToken(token))
+	if errors.Is(err, repositories.ErrTokenNotUsable) {
+		return ErrInvalidUserToken
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return a.userRepo.UpdateUserById(ctx, record.UserID.Hex(), bson.M{
+		"$set": bson.M{"emailVerified": true, "emailVerifiedAt": now, "updatedAt": now},
+	})
+}
+
+// issueToken replaces any outstanding token of the same purpose with a new one
+// and returns the raw token; only its hash is stored
+func (a *accountUsecase) issueToken(ctx context.Context, user *models.User, purpose utils.TokenPurpose, ttl time.Duration) (string, error) {
+	if err := a.tokenRepo.InvalidateUserTokens(ctx, user.ID, purpose); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	err := a.tokenRepo.CreateToken(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	logger.FromContext(ctx).Info("Issued user token", "purpose", purpose, "user_id", user.ID.Hex())
+	return token, nil
+}
+
+func (a *accountUsecase) link(path string, token string) string {
+	return a.cfg.AppURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
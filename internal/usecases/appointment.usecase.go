@@ -2,52 +2,192 @@ package usecases
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
 	"github/Chidi-creator/go-medic-server/internal/models"
 	"github/Chidi-creator/go-medic-server/internal/repositories"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AppointmentUsecase interface {
 	CreateAppointment(ctx context.Context, details *models.Appointment) (*models.Appointment, error)
 	GetSingleAppointmentById(ctx context.Context, id string) (*models.Appointment, error)
-	GetAppointmentsByDoctorId(ctx context.Context, id string) ([]models.Appointment, error)
-	GetAppointmentsByUserId(ctx context.Context, id string) ([]models.Appointment, error)
-	GetAppointmentsByQuery(ctx context.Context, filter bson.M) ([]models.Appointment, error)
-	UpdateAppointmentById(ctx context.Context, id string, updateQuery bson.M) (*models.Appointment, error)
-	DeleteAppointmentById(ctx context.Context, id string) (int64, error)
+	GetAppointmentsByDoctorId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error)
+	GetAppointmentsByUserId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error)
+	GetAppointmentsByQuery(ctx context.Context, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error)
+	UpdateAppointmentById(ctx context.Context, id string, patch *utils.MergePatch) (*models.Appointment, error)
+	TransitionAppointment(ctx context.Context, id string, action AppointmentAction, actorId string, reason string) (*models.Appointment, error)
+	DeleteAppointmentById(ctx context.Context, id string) error
 }
 
-type appointmentUsecase struct{
+// ErrInvalidAppointmentWindow is returned when an appointment's start/end times
+// cannot be booked
+var ErrInvalidAppointmentWindow = utils.Validation("invalid_appointment_window", "invalid appointment time window")
+
+// ErrDoctorHospitalMismatch is returned when an appointment names a hospital
+// the doctor does not practise at
+var ErrDoctorHospitalMismatch = utils.Validation("doctor_hospital_mismatch", "doctor does not practise at this hospital")
+
+var (
+	// ErrInvalidTransition is returned when the appointment's current status
+	// does not allow the requested action
+	ErrInvalidTransition = utils.Conflict("invalid_status_transition", "appointment cannot make this status change")
+	// ErrTransitionForbidden is returned when the actor may not perform the action
+	ErrTransitionForbidden = utils.Forbidden("status_transition_forbidden", "you are not allowed to make this status change")
+)
+
+type appointmentUsecase struct {
 	appointmentRepo repositories.AppointmentRepository
+	doctorRepo      repositories.DoctorRepository
+	hospitalRepo    repositories.HospitalRepository
+	userRepo        repositories.UserRepository
 }
 
-func NewAppointmentUsecase(appointmentRepo repositories.AppointmentRepository) AppointmentUsecase {
+func NewAppointmentUsecase(appointmentRepo repositories.AppointmentRepository, doctorRepo repositories.DoctorRepository, hospitalRepo repositories.HospitalRepository, userRepo repositories.UserRepository) AppointmentUsecase {
 	return &appointmentUsecase{
 		appointmentRepo: appointmentRepo,
+		doctorRepo:      doctorRepo,
+		hospitalRepo:    hospitalRepo,
+		userRepo:        userRepo,
 	}
 }
 
 func (a *appointmentUsecase) CreateAppointment(ctx context.Context, details *models.Appointment) (*models.Appointment, error) {
-	return a.appointmentRepo.CreateAppointment(ctx, details)
+	if details.DoctorID.IsZero() {
+		return nil, fmt.Errorf("%w: doctorId is required", ErrInvalidAppointmentWindow)
+	}
+	if !details.EndTime.After(details.StartTime) {
+		return nil, fmt.Errorf("%w: endTime must be after startTime", ErrInvalidAppointmentWindow)
+	}
+	if details.StartTime.Before(time.Now()) {
+		return nil, fmt.Errorf("%w: startTime is in the past", ErrInvalidAppointmentWindow)
+	}
+
+	// the doctor decides where the appointment is filed, so hospital listings
+	// only ever show their own doctors' bookings
+	doctor, err := a.doctorRepo.FindDoctorById(ctx, details.DoctorID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if details.HospitalID.IsZero() {
+		details.HospitalID = doctor.HospitalID
+	}
+	if details.HospitalID != doctor.HospitalID {
+		return nil, ErrDoctorHospitalMismatch
+	}
+
+	details.StartTime = details.StartTime.UTC()
+	details.EndTime = details.EndTime.UTC()
+	details.Status = utils.BOOKED
+	details.History = []models.StatusChange{{
+		To:      utils.BOOKED,
+		ActorID: details.UserID,
+		At:      time.Now().UTC(),
+	}}
+
+	appointment, err := a.appointmentRepo.CreateAppointment(ctx, details)
+	if err != nil {
+		return nil, err
+	}
+	metrics.AppointmentsCreated.Inc()
+	return appointment, nil
 }
 
 func (a *appointmentUsecase) GetSingleAppointmentById(ctx context.Context, id string) (*models.Appointment, error) {
 	return a.appointmentRepo.GetSingleAppointmentById(ctx, id)
 }
 
-func (a *appointmentUsecase) GetAppointmentsByDoctorId(ctx context.Context, id string) ([]models.Appointment, error) {
-	return a.appointmentRepo.GetAppointmentsByDoctorId(ctx, id)
+func (a *appointmentUsecase) GetAppointmentsByDoctorId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error) {
+	return a.appointmentRepo.GetAppointmentsByDoctorId(ctx, id, page)
+}
+func (a *appointmentUsecase) GetAppointmentsByUserId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error) {
+	return a.appointmentRepo.GetAppointmentsByUserId(ctx, id, page)
 }
-func (a *appointmentUsecase) GetAppointmentsByUserId(ctx context.Context, id string) ([]models.Appointment, error) {
-	return a.appointmentRepo.GetAppointmentsByUserId(ctx, id)
+func (a *appointmentUsecase) GetAppointmentsByQuery(ctx context.Context, page *utils.PageRequest) ([]models.Appointment, *utils.PageInfo, error) {
+	return a.appointmentRepo.GetAppointmentsByQuery(ctx, page)
 }
-func (a *appointmentUsecase) GetAppointmentsByQuery(ctx context.Context, filter bson.M) ([]models.Appointment, error) {
-	return a.appointmentRepo.GetAppointmentsByQuery(ctx, filter)
+func (a *appointmentUsecase) UpdateAppointmentById(ctx context.Context, id string, patch *utils.MergePatch) (*models.Appointment, error) {
+	return a.appointmentRepo.UpdateAppointmentById(ctx, id, patch.Update())
 }
-func (a *appointmentUsecase) UpdateAppointmentById(ctx context.Context, id string, updateQuery bson.M) (*models.Appointment, error) {
-	return a.appointmentRepo.UpdateAppointmentById(ctx, id, updateQuery)
+
+// TransitionAppointment applies a status change after checking that the
+// current status allows it and that the actor's relation to the appointment
+// is one permitted to make it
+func (a *appointmentUsecase) TransitionAppointment(ctx context.Context, id string, action AppointmentAction, actorId string, reason string) (*models.Appointment, error) {
+	t, ok := transitions[action]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidTransition, action)
+	}
+
+	appointment, err := a.appointmentRepo.GetSingleAppointmentById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	actor, err := primitive.ObjectIDFromHex(actorId)
+	if err != nil {
+		return nil, ErrTransitionForbidden
+	}
+	if a.participantsOf(ctx, appointment, actor)&t.allowed == 0 {
+		return nil, ErrTransitionForbidden
+	}
+
+	if !t.allows(appointment.Status) {
+		return nil, fmt.Errorf("%w: cannot %s an appointment that is %s", ErrInvalidTransition, action, appointment.Status)
+	}
+	if t.afterStart && time.Now().Before(appointment.StartTime) {
+		return nil, fmt.Errorf("%w: appointment has not started yet", ErrInvalidTransition)
+	}
+
+	updated, err := a.appointmentRepo.ChangeAppointmentStatus(ctx, appointment.ID, t.from, models.StatusChange{
+		From:    appointment.Status,
+		To:      t.to,
+		ActorID: actor,
+		Reason:  reason,
+		At:      time.Now().UTC(),
+	})
+	if errors.Is(err, repositories.ErrAppointmentStateChanged) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransition, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// participantsOf works out every way actor is involved in the appointment
+func (a *appointmentUsecase) participantsOf(ctx context.Context, appointment *models.Appointment, actor primitive.ObjectID) participant {
+	var p participant
+	if appointment.UserID == actor {
+		p |= patientParticipant
+	}
+
+	if doctor, err := a.doctorRepo.FindDoctorById(ctx, appointment.DoctorID.Hex()); err == nil {
+		if doctor.UserID != nil && *doctor.UserID == actor {
+			p |= doctorParticipant
+		}
+		if hospital, err := a.hospitalRepo.GetHospitalById(ctx, doctor.HospitalID.Hex()); err == nil && hospital.UserID == actor {
+			p |= hospitalParticipant
+		}
+	}
+
+	if user, err := a.userRepo.GetUserById(ctx, actor.Hex()); err == nil && utils.IsRoleValid([]utils.Roles{utils.ADMIN}, user.Roles) {
+		p |= adminParticipant
+	}
+	return p
+}
+func (a *appointmentUsecase) DeleteAppointmentById(ctx context.Context, id string) error {
+	deletedCount, err := a.appointmentRepo.DeleteAppointmentById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if deletedCount == 0 {
+		return repositories.ErrAppointmentNotFound
+	}
+	return nil
 }
-func (a *appointmentUsecase) DeleteAppointmentById(ctx context.Context, id string) (int64, error) {
-	return a.appointmentRepo.DeleteAppointmentById(ctx, id)
-}
\ No newline at end of file
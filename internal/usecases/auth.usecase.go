@@ -0,0 +1,342 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/logger"
+	"github/Chidi-creator/go-medic-server/internal/metrics"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/repositories"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials  = utils.Unauthorized("invalid_credentials", "check email and password")
+	ErrInvalidRefreshToken = utils.Unauthorized("invalid_refresh_token", "invalid or expired refresh token")
+	// ErrRefreshTokenReused means a rotated refresh token was replayed; the
+	// whole token family has been revoked and the user must log in again
+	ErrRefreshTokenReused = utils.Unauthorized("refresh_token_reused", "refresh token reuse detected, please log in again")
+	ErrInvalidMFAToken    = utils.Unauthorized("invalid_mfa_token", "MFA challenge is invalid or has expired, please log in again")
+)
+
+// AuthTokens is the access/refresh pair handed to clients
+type AuthTokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int64  `json:"expiresIn"`
+}
+
+type LoginResult struct {
+	User *models.User `json:"user,omitempty"`
+	*AuthTokens
+	// set instead of tokens when the account has MFA enabled; MFAToken and a
+	// code are exchanged for tokens at /auth/mfa/verify
+	MFARequired bool   `json:"mfaRequired,omitempty"`
+	MFAToken    string `json:"mfaToken,omitempty"`
+}
+
+type AuthUsecase interface {
+	LoginUser(ctx context.Context, details *utils.LoginRequest, clientIP string) (*LoginResult, error)
+	VerifyMFALogin(ctx context.Context, mfaToken string, code string, clientIP string) (*LoginResult, error)
+	RefreshTokens(ctx context.Context, refreshToken string) (*AuthTokens, error)
+	Logout(ctx context.Context, claims *services.Claims, refreshToken string) error
+	RevokeAllSessions(ctx context.Context, userId string) error
+	UnlockUser(ctx context.Context, userId string) error
+}
+
+type authUsecase struct {
+	userRepo    repositories.UserRepository
+	sessionRepo repositories.SessionRepository
+	attemptRepo repositories.LoginAttemptRepository
+	mfa         MFAUsecase
+	revocations *services.RevocationChecker
+	tokens      *services.TokenService
+}
+
+func NewAuthUsecase(userRepo repositories.UserRepository, sessionRepo repositories.SessionRepository, attemptRepo repositories.LoginAttemptRepository, mfa MFAUsecase, revocations *services.RevocationChecker, tokens *services.TokenService) AuthUsecase {
+	return &authUsecase{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		attemptRepo: attemptRepo,
+		mfa:         mfa,
+		revocations: revocations,
+		tokens:      tokens,
+	}
+}
+
+// compared against when the email is unknown, so those logins cost the same
+// bcrypt work as a wrong password
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// LoginUser checks credentials, refusing while the account or client IP is
+// locked out. Every failure gets the same error whether or not the email exists.
+// Accounts with MFA get a challenge token instead of tokens.
+func (a *authUsecase) LoginUser(ctx context.Context, details *utils.LoginRequest, clientIP string) (*LoginResult, error) {
+	keys := attemptKeys(details.Email, clientIP)
+	if err := a.checkLockout(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"email": details.Email}
+
+	users, err := a.userRepo.GetUsersByQuery(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+	if len(users) == 0 || users == nil {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(details.Password))
+		return nil, a.loginFailed(ctx, details.Email, clientIP, ErrInvalidCredentials)
+	}
+
+	user := users[0]
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(details.Password))
+	if err != nil {
+		return nil, a.loginFailed(ctx, details.Email, clientIP, ErrInvalidCredentials)
+	}
+
+	// failures are only cleared once every factor has passed, so MFA codes
+	// share the password's lockout
+	if user.MFA != nil && user.MFA.Enabled {
+		token, err := a.tokens.GenerateToken(user.ID, services.MFAChallengeTokenSubject, false)
+		if err != nil {
+			return nil, fmt.Errorf("error generating MFA challenge: %w", err)
+		}
+		return &LoginResult{MFARequired: true, MFAToken: token}, nil
+	}
+
+	return a.completeLogin(ctx, &user, keys, false)
+}
+
+// VerifyMFALogin is the second login step for accounts with MFA: it exchanges
+// the challenge token from LoginUser and a TOTP or recovery code for tokens
+func (a *authUsecase) VerifyMFALogin(ctx context.Context, mfaToken string, code string, clientIP string) (*LoginResult, error) {
+	claims, err := a.tokens.ValidateMFAChallengeToken(mfaToken)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	user, err := a.userRepo.GetUserById(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	keys := attemptKeys(user.Email, clientIP)
+	if err := a.checkLockout(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	err = a.mfa.Verify(ctx, user, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		return nil, a.loginFailed(ctx, user.Email, clientIP, ErrInvalidMFACode)
+	}
+	if errors.Is(err, ErrMFANotEnabled) {
+		return nil, ErrInvalidMFAToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return a.completeLogin(ctx, user, keys, true)
+}
+
+// completeLogin resets the account's failures, but not the IP's, so one valid
+// login cannot launder guesses against other accounts; every login starts a
+// new refresh token family
+func (a *authUsecase) completeLogin(ctx context.Context, user *models.User, keys []string, mfa bool) (*LoginResult, error) {
+	if err := a.attemptRepo.ClearAttempts(ctx, keys[0]); err != nil {
+		return nil, err
+	}
+
+	tokens, err := a.issueTokens(ctx, user.ID, primitive.NewObjectID().Hex(), mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return &LoginResult{User: user, AuthTokens: tokens}, nil
+}
+
+func attemptKeys(email string, clientIP string) []string {
+	keys := []string{accountAttemptKey(email)}
+	if clientIP != "" {
+		keys = append(keys, ipAttemptKey(clientIP))
+	}
+	return keys
+}
+
+// checkLockout refuses the attempt while the account or IP is locked out
+func (a *authUsecase) checkLockout(ctx context.Context, keys []string) error {
+	attempts, err := a.attemptRepo.GetAttempts(ctx, keys)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, attempt := range attempts {
+		if attempt.LockedUntil.After(now) {
+			metrics.LoginsFailed.Inc()
+			return ErrTooManyLoginAttempts
+		}
+	}
+	return nil
+}
+
+// loginFailed records the failure against the account and IP, locking each
+// once it runs out of free attempts, and returns failure for the caller
+func (a *authUsecase) loginFailed(ctx context.Context, email string, clientIP string, failure error) error {
+	metrics.LoginsFailed.Inc()
+
+	keys := map[string]int{accountAttemptKey(email): accountFreeAttempts}
+	if clientIP != "" {
+		keys[ipAttemptKey(clientIP)] = ipFreeAttempts
+	}
+
+	now := time.Now()
+	for key, free := range keys {
+		attempts, err := a.attemptRepo.RecordFailure(ctx, key, now.Add(attemptWindow))
+		if err != nil {
+			return err
+		}
+		if lockout := lockoutFor(attempts.Failures, free); lockout > 0 {
+			until := now.Add(lockout)
+			if err := a.attemptRepo.Lock(ctx, key, until, until.Add(attemptWindow)); err != nil {
+				return err
+			}
+			logger.FromContext(ctx).Warn("Login locked out", "key_kind", strings.SplitN(key, ":", 2)[0], "failures", attempts.Failures, "locked_until", until)
+		}
+	}
+	return failure
+}
+
+// RefreshTokens exchanges a refresh token for a new pair. Each refresh token
+// can be used once; presenting a rotated token revokes its whole family.
+func (a *authUsecase) RefreshTokens(ctx context.Context, refreshToken string) (*AuthTokens, error) {
+	claims, err := a.tokens.ValidateRefreshToken(refreshToken)
+	if err != nil || claims.ID == "" || claims.FamilyID == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	userId, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// the family keeps the factors its login passed
+	newRefresh, newClaims, err := a.tokens.GenerateRefreshToken(userId, claims.FamilyID, claims.MFA)
+	if err != nil {
+		return nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	_, err = a.sessionRepo.RotateSession(ctx, claims.ID, newClaims.ID)
+	if errors.Is(err, repositories.ErrSessionReused) {
+		logger.FromContext(ctx).Warn("Refresh token reuse detected, revoking family", "user_id", claims.UserID, "family_id", claims.FamilyID)
+		if err := a.sessionRepo.RevokeFamily(ctx, claims.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if errors.Is(err, repositories.ErrSessionNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.saveSession(ctx, userId, newClaims); err != nil {
+		return nil, err
+	}
+
+	return a.pairWithAccessToken(userId, newRefresh, claims.MFA)
+}
+
+// Logout revokes the presented access token and, when given, the refresh
+// token family it was logged in with
+func (a *authUsecase) Logout(ctx context.Context, claims *services.Claims, refreshToken string) error {
+	if err := a.revocations.RevokeToken(ctx, claims); err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	refreshClaims, err := a.tokens.ValidateRefreshToken(refreshToken)
+	if err != nil || refreshClaims.UserID != claims.UserID {
+		return ErrInvalidRefreshToken
+	}
+	return a.sessionRepo.RevokeFamily(ctx, refreshClaims.FamilyID)
+}
+
+// RevokeAllSessions logs a user out everywhere: outstanding access tokens are
+// rejected and every refresh session is revoked
+func (a *authUsecase) RevokeAllSessions(ctx context.Context, userId string) error {
+	_, err := a.userRepo.GetUserById(ctx, userId)
+	// a malformed id names no user either
+	if errors.Is(err, repositories.ErrInvalidID) {
+		return repositories.ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.revocations.RevokeUser(ctx, userId); err != nil {
+		return err
+	}
+	return a.sessionRepo.RevokeUserSessions(ctx, userId)
+}
+
+// UnlockUser lifts a lockout on the user's account and forgets its failures
+func (a *authUsecase) UnlockUser(ctx context.Context, userId string) error {
+	user, err := a.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return a.attemptRepo.ClearAttempts(ctx, accountAttemptKey(user.Email))
+}
+
+func (a *authUsecase) issueTokens(ctx context.Context, userId primitive.ObjectID, familyId string, mfa bool) (*AuthTokens, error) {
+	refreshToken, claims, err := a.tokens.GenerateRefreshToken(userId, familyId, mfa)
+	if err != nil {
+		return nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	if err := a.saveSession(ctx, userId, claims); err != nil {
+		return nil, err
+	}
+
+	return a.pairWithAccessToken(userId, refreshToken, mfa)
+}
+
+// pairWithAccessToken issues a fresh access token to go with refreshToken
+func (a *authUsecase) pairWithAccessToken(userId primitive.ObjectID, refreshToken string, mfa bool) (*AuthTokens, error) {
+	accessToken, err := a.tokens.GenerateToken(userId, services.AccessTokenSubject, mfa)
+	if err != nil {
+		return nil, fmt.Errorf("error generating user token: %w", err)
+	}
+
+	return &AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(a.tokens.AccessTokenExpiry().Seconds()),
+	}, nil
+}
+
+func (a *authUsecase) saveSession(ctx context.Context, userId primitive.ObjectID, claims *services.Claims) error {
+	return a.sessionRepo.CreateSession(ctx, &models.RefreshSession{
+		ID:        claims.ID,
+		UserID:    userId,
+		FamilyID:  claims.FamilyID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+}
@@ -2,8 +2,12 @@ package usecases
 
 import (
 	"context"
+	"fmt"
 	"github/Chidi-creator/go-medic-server/internal/models"
 	"github/Chidi-creator/go-medic-server/internal/repositories"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"sort"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -12,18 +16,28 @@ type DoctorUsecase interface {
 	CreateDoctor(ctx context.Context, doctor *models.Doctor) (*models.Doctor, error)
 	FindDoctorById(ctx context.Context, id string) (*models.Doctor, error)
 	FindDoctorsByQuery(ctx context.Context, filter bson.M) ([]models.Doctor, error)
-	GetDoctorsByHospitalId(ctx context.Context, id string) ([]models.Doctor, error)
-	UpdateDoctorById(ctx context.Context, id string, updateQuery bson.M) error
+	GetDoctorsByHospitalId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Doctor, *utils.PageInfo, error)
+	UpdateDoctorById(ctx context.Context, id string, patch *utils.MergePatch) error
 	DeleteDoctorByUserId(ctx context.Context, id string) error
+	SetAvailability(ctx context.Context, id string, availability *models.DoctorAvailability) (*models.DoctorAvailability, error)
+	GetAvailability(ctx context.Context, id string) ([]models.DoctorAvailability, error)
+	GetAvailableSlots(ctx context.Context, id string, hospitalId string, from, to time.Time) ([]models.Slot, error)
 }
 
+// ErrInvalidAvailability is returned for schedules or slot queries that do not make sense
+var ErrInvalidAvailability = utils.Validation("invalid_availability", "invalid availability")
+
 type doctorUsecase struct {
-	doctorRepo repositories.DoctorRepository
+	doctorRepo       repositories.DoctorRepository
+	availabilityRepo repositories.AvailabilityRepository
+	appointmentRepo  repositories.AppointmentRepository
 }
 
-func NewDoctorUseCase(doctorRepo repositories.DoctorRepository) DoctorUsecase {
+func NewDoctorUseCase(doctorRepo repositories.DoctorRepository, availabilityRepo repositories.AvailabilityRepository, appointmentRepo repositories.AppointmentRepository) DoctorUsecase {
 	return &doctorUsecase{
-		doctorRepo: doctorRepo,
+		doctorRepo:       doctorRepo,
+		availabilityRepo: availabilityRepo,
+		appointmentRepo:  appointmentRepo,
 	}
 }
 
@@ -49,15 +63,15 @@ func (d *doctorUsecase) FindDoctorsByQuery(ctx context.Context, filter bson.M) (
 	}
 	return doctors, nil
 }
-func (d *doctorUsecase) GetDoctorsByHospitalId(ctx context.Context, id string) ([]models.Doctor, error) {
-	doctors, err := d.doctorRepo.GetDoctorsByHospitalId(ctx, id)
+func (d *doctorUsecase) GetDoctorsByHospitalId(ctx context.Context, id string, page *utils.PageRequest) ([]models.Doctor, *utils.PageInfo, error) {
+	doctors, info, err := d.doctorRepo.GetDoctorsByHospitalId(ctx, id, page)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return doctors, nil
+	return doctors, info, nil
 }
-func (d *doctorUsecase) UpdateDoctorById(ctx context.Context, id string, updateQuery bson.M) error {
-	err := d.doctorRepo.UpdateDoctorById(ctx, id, updateQuery)
+func (d *doctorUsecase) UpdateDoctorById(ctx context.Context, id string, patch *utils.MergePatch) error {
+	err := d.doctorRepo.UpdateDoctorById(ctx, id, patch.Update())
 	if err != nil {
 		return err
 	}
@@ -70,3 +84,87 @@ func (d *doctorUsecase) DeleteDoctorByUserId(ctx context.Context, id string) err
 	}
 	return nil
 }
+
+func (d *doctorUsecase) SetAvailability(ctx context.Context, id string, availability *models.DoctorAvailability) (*models.DoctorAvailability, error) {
+	doctor, err := d.doctorRepo.FindDoctorById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// a doctor only publishes slots at the hospital they are registered with
+	if availability.HospitalID.IsZero() {
+		availability.HospitalID = doctor.HospitalID
+	}
+	if availability.HospitalID != doctor.HospitalID {
+		return nil, fmt.Errorf("%w: doctor does not practise at this hospital", ErrInvalidAvailability)
+	}
+	availability.DoctorID = doctor.ID
+
+	if err := checkSchedule(availability); err != nil {
+		return nil, err
+	}
+
+	return d.availabilityRepo.UpsertAvailability(ctx, availability)
+}
+
+func (d *doctorUsecase) GetAvailability(ctx context.Context, id string) ([]models.DoctorAvailability, error) {
+	return d.availabilityRepo.GetAvailabilityByDoctorId(ctx, id)
+}
+
+func (d *doctorUsecase) GetAvailableSlots(ctx context.Context, id string, hospitalId string, from, to time.Time) ([]models.Slot, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: 'to' must be after 'from'", ErrInvalidAvailability)
+	}
+	if to.Sub(from) > maxSlotQueryRange {
+		return nil, fmt.Errorf("%w: range cannot exceed %v days", ErrInvalidAvailability, int(maxSlotQueryRange.Hours()/24))
+	}
+	// slots in the past can never be booked
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+
+	schedules, err := d.availabilityRepo.GetAvailabilityByDoctorId(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	booked, err := d.appointmentRepo.GetDoctorAppointmentsInRange(ctx, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []models.Slot{}
+	for _, schedule := range schedules {
+		if hospitalId != "" && schedule.HospitalID.Hex() != hospitalId {
+			continue
+		}
+		daySlots, err := computeSlots(schedule, from, to, booked)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, daySlots...)
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].StartTime.Before(slots[j].StartTime) })
+	return slots, nil
+}
+
+// checkSchedule rejects time ranges that end before they start
+func checkSchedule(availability *models.DoctorAvailability) error {
+	var ranges []models.TimeRange
+	for _, w := range availability.Weekly {
+		ranges = append(ranges, w.Hours...)
+		ranges = append(ranges, w.Breaks...)
+	}
+	for _, e := range availability.Exceptions {
+		ranges = append(ranges, e.Hours...)
+		ranges = append(ranges, e.Breaks...)
+	}
+	for _, r := range ranges {
+		// HH:MM strings compare in chronological order
+		if r.End <= r.Start {
+			return fmt.Errorf("%w: range %s-%s ends before it starts", ErrInvalidAvailability, r.Start, r.End)
+		}
+	}
+	return nil
+}
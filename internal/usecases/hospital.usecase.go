@@ -4,6 +4,7 @@ import (
 	"context"
 	"github/Chidi-creator/go-medic-server/internal/models"
 	"github/Chidi-creator/go-medic-server/internal/repositories"
+	"github/Chidi-creator/go-medic-server/internal/utils"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -11,10 +12,11 @@ import (
 type HospitalUsecase interface {
 	CreateHospital(ctx context.Context, hospital *models.Hospital) (*models.Hospital, error)
 	GetHospitalById(ctx context.Context, id string) (*models.Hospital, error)
-	GetAllHospitals(ctx context.Context) ([]models.Hospital, error)
+	GetAllHospitals(ctx context.Context, page *utils.PageRequest) ([]models.Hospital, *utils.PageInfo, error)
 	GetHospitalsByQuery(ctx context.Context, filter bson.M) ([]models.Hospital, error)
-	UpdateHospitalById(ctx context.Context, id string, updateQuery bson.M) (*models.Hospital, error)
-	DeleteHospital(ctx context.Context, id string) (int64, error)
+	FindHospitalsNear(ctx context.Context, query models.NearbyHospitalQuery) ([]models.NearbyHospital, error)
+	UpdateHospitalById(ctx context.Context, id string, patch *utils.MergePatch) (*models.Hospital, error)
+	DeleteHospital(ctx context.Context, id string) error
 }
 
 type hospitalUsecase struct {
@@ -42,12 +44,12 @@ func (hu *hospitalUsecase) GetHospitalById(ctx context.Context, id string) (*mod
 	}
 	return hospital, nil
 }
-func (hu *hospitalUsecase) GetAllHospitals(ctx context.Context) ([]models.Hospital, error) {
-	hospitals, err := hu.hospitalRepo.GetAllHospitals(ctx)
+func (hu *hospitalUsecase) GetAllHospitals(ctx context.Context, page *utils.PageRequest) ([]models.Hospital, *utils.PageInfo, error) {
+	hospitals, info, err := hu.hospitalRepo.GetAllHospitals(ctx, page)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return hospitals, nil
+	return hospitals, info, nil
 }
 func (hu *hospitalUsecase) GetHospitalsByQuery(ctx context.Context, filter bson.M) ([]models.Hospital, error) {
 	hospitals, err := hu.hospitalRepo.GetHospitalsByQuery(ctx, filter)
@@ -56,17 +58,27 @@ func (hu *hospitalUsecase) GetHospitalsByQuery(ctx context.Context, filter bson.
 	}
 	return hospitals, nil
 }
-func (hu *hospitalUsecase) UpdateHospitalById(ctx context.Context, id string, updateQuery bson.M) (*models.Hospital, error) {
-	updatedHospital, err := hu.hospitalRepo.UpdateHospitalById(ctx, id, updateQuery)
+func (hu *hospitalUsecase) FindHospitalsNear(ctx context.Context, query models.NearbyHospitalQuery) ([]models.NearbyHospital, error) {
+	hospitals, err := hu.hospitalRepo.FindHospitalsNear(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return hospitals, nil
+}
+func (hu *hospitalUsecase) UpdateHospitalById(ctx context.Context, id string, patch *utils.MergePatch) (*models.Hospital, error) {
+	updatedHospital, err := hu.hospitalRepo.UpdateHospitalById(ctx, id, patch.Update())
 	if err != nil {
 		return nil, err
 	}
 	return updatedHospital, nil
 }
-func (hu *hospitalUsecase) DeleteHospital(ctx context.Context, id string) (int64, error) {
+func (hu *hospitalUsecase) DeleteHospital(ctx context.Context, id string) error {
 	deletedCount, err := hu.hospitalRepo.DeleteHospital(ctx, id)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if deletedCount == 0 {
+		return repositories.ErrHospitalNotFound
 	}
-	return deletedCount, nil
+	return nil
 }
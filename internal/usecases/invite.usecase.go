@@ -0,0 +1,271 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/repositories"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInviteForbidden = utils.Forbidden("invite_forbidden", "only the hospital owner or an admin can manage this doctor's invites")
+	ErrInviteConflict  = utils.Conflict("invite_conflict", "doctor already has an open or accepted invite")
+	ErrInviteInvalid   = utils.Gone("invite_invalid", "invite token is invalid, expired or already used")
+	ErrInviteMismatch  = utils.Forbidden("invite_email_mismatch", "invite was sent to a different email address")
+)
+
+type DoctorInviteUsecase interface {
+	InviteDoctor(ctx context.Context, actorId string, doctorId string, email string) (*models.DoctorInvite, error)
+	ResendInvite(ctx context.Context, actorId string, inviteId string) (*models.DoctorInvite, error)
+	GetInvite(ctx context.Context, token string) (*models.DoctorInvite, error)
+	AcceptInvite(ctx context.Context, token string, userId string) (*models.DoctorInvite, error)
+	RejectInvite(ctx context.Context, token string, userId string) (*models.DoctorInvite, error)
+}
+
+type doctorInviteUsecase struct {
+	inviteRepo   repositories.InviteRepository
+	doctorRepo   repositories.DoctorRepository
+	hospitalRepo repositories.HospitalRepository
+	userRepo     repositories.UserRepository
+	tokens       *services.TokenService
+	mailer       services.Mailer
+	appURL       string
+}
+
+func NewDoctorInviteUsecase(inviteRepo repositories.InviteRepository, doctorRepo repositories.DoctorRepository, hospitalRepo repositories.HospitalRepository, userRepo repositories.UserRepository, tokens *services.TokenService, mailer services.Mailer, appURL string) DoctorInviteUsecase {
+	return &doctorInviteUsecase{
+		inviteRepo:   inviteRepo,
+		doctorRepo:   doctorRepo,
+		hospitalRepo: hospitalRepo,
+		userRepo:     userRepo,
+		tokens:       tokens,
+		mailer:       mailer,
+		appURL:       appURL,
+	}
+}
+
+func (d *doctorInviteUsecase) InviteDoctor(ctx context.Context, actorId string, doctorId string, email string) (*models.DoctorInvite, error) {
+	doctor, err := d.doctorRepo.FindDoctorById(ctx, doctorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkCanManage(ctx, actorId, doctor.HospitalID); err != nil {
+		return nil, err
+	}
+	if doctor.UserID != nil || doctor.InviteStatus == utils.ACCEPTED {
+		return nil, ErrInviteConflict
+	}
+
+	pending, err := d.inviteRepo.GetPendingInviteByDoctorId(ctx, doctor.ID)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("%w: re-send invite %s instead", ErrInviteConflict, pending.ID.Hex())
+	}
+
+	nonce, err := generateNonce()
+	if err != nil {
+		return nil, err
+	}
+	actor, _ := primitive.ObjectIDFromHex(actorId)
+
+	invite, err := d.inviteRepo.CreateInvite(ctx, &models.DoctorInvite{
+		DoctorID:   doctor.ID,
+		HospitalID: doctor.HospitalID,
+		Email:      strings.ToLower(strings.TrimSpace(email)),
+		InvitedBy:  actor,
+		Status:     utils.PENDING,
+		Nonce:      nonce,
+		ExpiresAt:  time.Now().Add(d.tokens.InviteTokenExpiry()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.doctorRepo.UpdateDoctorById(ctx, doctorId, bson.M{"$set": bson.M{"inviteStatus": utils.PENDING}}); err != nil {
+		return nil, err
+	}
+
+	return d.issue(ctx, invite)
+}
+
+// ResendInvite issues a fresh token with a new expiry; older tokens stop working
+func (d *doctorInviteUsecase) ResendInvite(ctx context.Context, actorId string, inviteId string) (*models.DoctorInvite, error) {
+	invite, err := d.inviteRepo.GetInviteById(ctx, inviteId)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkCanManage(ctx, actorId, invite.HospitalID); err != nil {
+		return nil, err
+	}
+
+	nonce, err := generateNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	renewed, err := d.inviteRepo.RenewInvite(ctx, invite.ID, nonce, time.Now().Add(d.tokens.InviteTokenExpiry()))
+	if errors.Is(err, repositories.ErrInviteNotUsable) {
+		return nil, fmt.Errorf("%w: invite has already been answered", ErrInviteConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return d.issue(ctx, renewed)
+}
+
+func (d *doctorInviteUsecase) GetInvite(ctx context.Context, token string) (*models.DoctorInvite, error) {
+	invite, _, err := d.resolve(ctx, token)
+	return invite, err
+}
+
+func (d *doctorInviteUsecase) AcceptInvite(ctx context.Context, token string, userId string) (*models.DoctorInvite, error) {
+	invite, user, err := d.respond(ctx, token, userId, utils.ACCEPTED)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.doctorRepo.UpdateDoctorById(ctx, invite.DoctorID.Hex(), bson.M{
+		"$set": bson.M{
+			"userId":       user.ID,
+			"inviteStatus": utils.ACCEPTED,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.userRepo.UpdateUserById(ctx, userId, bson.M{
+		"$addToSet": bson.M{"roles": utils.DOCTOR},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+func (d *doctorInviteUsecase) RejectInvite(ctx context.Context, token string, userId string) (*models.DoctorInvite, error) {
+	invite, _, err := d.respond(ctx, token, userId, utils.REJECTED)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.doctorRepo.UpdateDoctorById(ctx, invite.DoctorID.Hex(), bson.M{"$set": bson.M{"inviteStatus": utils.REJECTED}}); err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// respond checks that the token belongs to the responding user's verified
+// email and records the answer
+func (d *doctorInviteUsecase) respond(ctx context.Context, token string, userId string, status utils.InviteStatus) (*models.DoctorInvite, *models.User, error) {
+	invite, nonce, err := d.resolve(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := d.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.EqualFold(user.Email, invite.Email) {
+		return nil, nil, ErrInviteMismatch
+	}
+	// see ErrEmailNotVerified: only a verified address proves the invite
+	// reached this user
+	if !user.EmailVerified {
+		return nil, nil, fmt.Errorf("%w: before answering an invite", ErrEmailNotVerified)
+	}
+
+	updated, err := d.inviteRepo.RespondToInvite(ctx, invite.ID, nonce, status, user.ID)
+	if errors.Is(err, repositories.ErrInviteNotUsable) {
+		return nil, nil, ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return updated, user, nil
+}
+
+// resolve verifies the token signature and that it is the invite's latest token
+func (d *doctorInviteUsecase) resolve(ctx context.Context, token string) (*models.DoctorInvite, string, error) {
+	claims, err := d.tokens.ValidateInviteToken(token)
+	if err != nil {
+		return nil, "", ErrInviteInvalid
+	}
+
+	invite, err := d.inviteRepo.GetInviteById(ctx, claims.InviteID)
+	if err != nil {
+		return nil, "", ErrInviteInvalid
+	}
+	if invite.Nonce != claims.Nonce || invite.Status != utils.PENDING || time.Now().After(invite.ExpiresAt) {
+		return nil, "", ErrInviteInvalid
+	}
+
+	return invite, claims.Nonce, nil
+}
+
+// issue signs a token for the invite's current nonce and emails it to the
+// invitee; the token only ever travels by email, never back to the inviter
+func (d *doctorInviteUsecase) issue(ctx context.Context, invite *models.DoctorInvite) (*models.DoctorInvite, error) {
+	token, err := d.tokens.GenerateInviteToken(invite.ID, invite.Nonce, invite.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign invite token: %w", err)
+	}
+
+	err = d.mailer.Send(ctx, services.Message{
+		To:      invite.Email,
+		Subject: "You have been invited to join a hospital on Medic",
+		Body: fmt.Sprintf("Hello,\n\nYou have been invited to join a hospital as a doctor. Sign in with this email address and open the link below to accept or decline. It expires on %s.\n\n%s/doctor-invites?token=%s",
+			invite.ExpiresAt.Format(time.RFC1123), d.appURL, url.QueryEscape(token)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not send invite email: %w", err)
+	}
+
+	return invite, nil
+}
+
+// checkCanManage allows the owner of the hospital or an admin
+func (d *doctorInviteUsecase) checkCanManage(ctx context.Context, actorId string, hospitalId primitive.ObjectID) error {
+	hospital, err := d.hospitalRepo.GetHospitalById(ctx, hospitalId.Hex())
+	if err != nil {
+		return err
+	}
+	if hospital.UserID.Hex() == actorId {
+		return nil
+	}
+
+	actor, err := d.userRepo.GetUserById(ctx, actorId)
+	if err != nil {
+		return err
+	}
+	if utils.IsRoleValid([]utils.Roles{utils.ADMIN}, actor.Roles) {
+		return nil
+	}
+	return ErrInviteForbidden
+}
+
+func generateNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate nonce: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,48 @@
+package usecases
+
+import (
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"strings"
+	"time"
+)
+
+// ErrTooManyLoginAttempts is returned while an account or client IP is locked
+// out. It is the same for unknown emails, so it reveals nothing either.
+var ErrTooManyLoginAttempts = utils.TooManyRequests("too_many_login_attempts", "too many failed login attempts, try again later")
+
+const (
+	// failures allowed before each further failure locks the key
+	accountFreeAttempts = 5
+	ipFreeAttempts      = 20
+
+	baseLockout = 30 * time.Second
+	maxLockout  = 15 * time.Minute
+
+	// failures are forgotten once a key has been quiet this long
+	attemptWindow = time.Hour
+)
+
+// lockoutFor doubles the lockout with every failure past the free attempts,
+// starting at baseLockout for the first one
+func lockoutFor(failures int, free int) time.Duration {
+	over := failures - free
+	if over <= 0 {
+		return 0
+	}
+	if over > 6 {
+		return maxLockout
+	}
+	lockout := baseLockout << (over - 1)
+	if lockout > maxLockout {
+		return maxLockout
+	}
+	return lockout
+}
+
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,199 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"github/Chidi-creator/go-medic-server/internal/repositories"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"github/Chidi-creator/go-medic-server/internal/utils"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrMFAAlreadyEnabled = utils.Conflict("mfa_already_enabled", "multi-factor authentication is already enabled")
+	ErrMFANotEnrolled    = utils.Conflict("mfa_not_enrolled", "start MFA enrolment first")
+	ErrMFANotEnabled     = utils.Conflict("mfa_not_enabled", "multi-factor authentication is not enabled")
+	ErrInvalidMFACode    = utils.Unauthorized("invalid_mfa_code", "invalid or already used code")
+)
+
+const recoveryCodeCount = 10
+
+// MFAEnrollment is what an authenticator app needs; the URI is meant to be
+// shown as a QR code
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// MFARecoveryCodes are shown to the user once, when MFA is switched on
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type MFAUsecase interface {
+	Enroll(ctx context.Context, userId string) (*MFAEnrollment, error)
+	Confirm(ctx context.Context, userId string, code string) (*MFARecoveryCodes, error)
+	Disable(ctx context.Context, userId string, code string) error
+	Verify(ctx context.Context, user *models.User, code string) error
+}
+
+type mfaUsecase struct {
+	userRepo    repositories.UserRepository
+	sessionRepo repositories.SessionRepository
+	revocations *services.RevocationChecker
+}
+
+func NewMFAUsecase(userRepo repositories.UserRepository, sessionRepo repositories.SessionRepository, revocations *services.RevocationChecker) MFAUsecase {
+	return &mfaUsecase{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		revocations: revocations,
+	}
+}
+
+// Enroll starts (or restarts) enrolment with a new secret; MFA is not enforced
+// until Confirm sees a code from it
+func (m *mfaUsecase) Enroll(ctx context.Context, userId string) (*MFAEnrollment, error) {
+	user, err := m.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFA != nil && user.MFA.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := services.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.M{"$set": bson.M{"mfa": models.MFASettings{Secret: secret}}}
+	if err := m.userRepo.UpdateUserById(ctx, userId, update); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: services.TOTPProvisioningURI(user.Email, secret),
+	}, nil
+}
+
+// Confirm switches MFA on once the user proves their app produces valid codes
+func (m *mfaUsecase) Confirm(ctx context.Context, userId string, code string) (*MFARecoveryCodes, error) {
+	user, err := m.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFA == nil || user.MFA.Secret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	if user.MFA.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := services.ValidateTOTP(user.MFA.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"mfa.enabled":       true,
+		"mfa.enabledAt":     now,
+		"mfa.recoveryCodes": hashes,
+		"mfa.lastUsedStep":  step,
+	}}
+	if err := m.userRepo.UpdateUserById(ctx, userId, update); err != nil {
+		return nil, err
+	}
+
+	return &MFARecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// Disable turns MFA off; it takes a current code so a stolen session alone
+// cannot remove the second factor. Every session is ended, since their tokens
+// still claim MFA.
+func (m *mfaUsecase) Disable(ctx context.Context, userId string, code string) error {
+	user, err := m.userRepo.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if user.MFA == nil || !user.MFA.Enabled {
+		return ErrMFANotEnabled
+	}
+
+	if err := m.Verify(ctx, user, code); err != nil {
+		return err
+	}
+
+	if err := m.userRepo.UpdateUserById(ctx, userId, bson.M{"$unset": bson.M{"mfa": ""}}); err != nil {
+		return err
+	}
+
+	if err := m.revocations.RevokeUser(ctx, userId); err != nil {
+		return err
+	}
+	return m.sessionRepo.RevokeUserSessions(ctx, userId)
+}
+
+// Verify accepts either a TOTP code or an unused recovery code; each can only
+// be used once
+func (m *mfaUsecase) Verify(ctx context.Context, user *models.User, code string) error {
+	if user.MFA == nil || !user.MFA.Enabled {
+		return ErrMFANotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := services.ValidateTOTP(user.MFA.Secret, code, time.Now()); ok {
+		fresh, err := m.userRepo.UseMFAStep(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := m.userRepo.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// newRecoveryCodes returns codes formatted for the user (xxxxx-xxxxx) and the
+// hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashToken(raw)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
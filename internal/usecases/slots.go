@@ -0,0 +1,117 @@
+package usecases
+
+import (
+	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/models"
+	"sort"
+	"time"
+)
+
+// maximum window a single slot query may cover
+const maxSlotQueryRange = 31 * 24 * time.Hour
+
+// computeSlots expands a schedule into bookable slots inside [from, to),
+// leaving out breaks and anything that overlaps an existing booking
+func computeSlots(schedule models.DoctorAvailability, from, to time.Time, booked []models.Appointment) ([]models.Slot, error) {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", schedule.Timezone, err)
+	}
+	slotLength := time.Duration(schedule.SlotMinutes) * time.Minute
+	if slotLength <= 0 {
+		return nil, fmt.Errorf("slot length must be positive")
+	}
+
+	weekly := make(map[time.Weekday][]models.WeeklyHours)
+	for _, w := range schedule.Weekly {
+		weekly[w.Weekday] = append(weekly[w.Weekday], w)
+	}
+	exceptions := make(map[string]models.AvailabilityException)
+	for _, e := range schedule.Exceptions {
+		exceptions[e.Date] = e
+	}
+
+	var slots []models.Slot
+	localFrom := from.In(loc)
+	day := time.Date(localFrom.Year(), localFrom.Month(), localFrom.Day(), 0, 0, 0, 0, loc)
+
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		var hours, breaks []models.TimeRange
+
+		if exception, ok := exceptions[day.Format("2006-01-02")]; ok {
+			if exception.Unavailable {
+				continue
+			}
+			hours, breaks = exception.Hours, exception.Breaks
+		} else {
+			for _, w := range weekly[day.Weekday()] {
+				hours = append(hours, w.Hours...)
+				breaks = append(breaks, w.Breaks...)
+			}
+		}
+
+		for _, h := range hours {
+			rangeStart, err := atClock(day, h.Start)
+			if err != nil {
+				return nil, err
+			}
+			rangeEnd, err := atClock(day, h.End)
+			if err != nil {
+				return nil, err
+			}
+
+			for start := rangeStart; !start.Add(slotLength).After(rangeEnd); start = start.Add(slotLength) {
+				end := start.Add(slotLength)
+				if start.Before(from) || end.After(to) {
+					continue
+				}
+				if overlapsBreak(day, breaks, start, end) || overlapsBooking(booked, start, end) {
+					continue
+				}
+				slots = append(slots, models.Slot{
+					HospitalID: schedule.HospitalID,
+					StartTime:  start.UTC(),
+					EndTime:    end.UTC(),
+				})
+			}
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].StartTime.Before(slots[j].StartTime) })
+	return slots, nil
+}
+
+// atClock returns the instant at the given HH:MM wall clock time on day
+func atClock(day time.Time, clock string) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", clock, err)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()), nil
+}
+
+func overlapsBreak(day time.Time, breaks []models.TimeRange, start, end time.Time) bool {
+	for _, b := range breaks {
+		breakStart, err := atClock(day, b.Start)
+		if err != nil {
+			continue
+		}
+		breakEnd, err := atClock(day, b.End)
+		if err != nil {
+			continue
+		}
+		if start.Before(breakEnd) && end.After(breakStart) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlapsBooking(booked []models.Appointment, start, end time.Time) bool {
+	for _, a := range booked {
+		if start.Before(a.EndTime) && end.After(a.StartTime) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package usecases
+
+import (
+	"github/Chidi-creator/go-medic-server/internal/utils"
+)
+
+// AppointmentAction names a status transition exposed as its own endpoint
+type AppointmentAction string
+
+const (
+	CHECK_IN AppointmentAction = "check-in"
+	START    AppointmentAction = "start"
+	COMPLETE AppointmentAction = "complete"
+	CANCEL   AppointmentAction = "cancel"
+	NO_SHOW  AppointmentAction = "no-show"
+)
+
+// participant is how the acting user relates to an appointment; a user can be
+// several at once (e.g. a doctor who also owns the hospital)
+type participant uint8
+
+const (
+	patientParticipant participant = 1 << iota
+	doctorParticipant
+	hospitalParticipant
+	adminParticipant
+)
+
+type transition struct {
+	from []utils.Status
+	to   utils.Status
+	// who may perform the transition
+	allowed participant
+	// the transition only makes sense once the appointment's start time has passed
+	afterStart bool
+}
+
+var transitions = map[AppointmentAction]transition{
+	CHECK_IN: {
+		from:    []utils.Status{utils.BOOKED},
+		to:      utils.CHECKED_IN,
+		allowed: doctorParticipant | hospitalParticipant | adminParticipant,
+	},
+	START: {
+		from:    []utils.Status{utils.CHECKED_IN},
+		to:      utils.IN_PROGRESS,
+		allowed: doctorParticipant | adminParticipant,
+	},
+	COMPLETE: {
+		from:    []utils.Status{utils.IN_PROGRESS},
+		to:      utils.COMPLETED,
+		allowed: doctorParticipant | adminParticipant,
+	},
+	CANCEL: {
+		from:    []utils.Status{utils.BOOKED, utils.CHECKED_IN},
+		to:      utils.CANCELLED,
+		allowed: patientParticipant | doctorParticipant | hospitalParticipant | adminParticipant,
+	},
+	NO_SHOW: {
+		from:       []utils.Status{utils.BOOKED, utils.CHECKED_IN},
+		to:         utils.NO_SHOW,
+		allowed:    doctorParticipant | hospitalParticipant | adminParticipant,
+		afterStart: true,
+	},
+}
+
+func (t transition) allows(status utils.Status) bool {
+	for _, from := range t.from {
+		if from == status {
+			return true
+		}
+	}
+	return false
+}
@@ -3,10 +3,10 @@ package usecases
 import (
 	"context"
 	"fmt"
+	"github/Chidi-creator/go-medic-server/internal/logger"
 
 	"github/Chidi-creator/go-medic-server/internal/models"
 	"github/Chidi-creator/go-medic-server/internal/repositories"
-	"github/Chidi-creator/go-medic-server/internal/services"
 	"github/Chidi-creator/go-medic-server/internal/utils"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,73 +17,49 @@ type UserUseCase interface {
 	RegisterUser(ctx context.Context, user *models.User) (*models.User, error)
 	GetUsersByQuery(ctz context.Context, filter bson.M) ([]models.User, error)
 	GetUserById(ctx context.Context, id string) (*models.User, error)
-	UpdateUserById(ctx context.Context, id string, updateQuery bson.M) error
-	DeleteUserById(ctx context.Context, id string) (int64, error)
-	LoginUser(ctx context.Context, details *utils.LoginRequest) (map[string]interface{}, error)
+	UpdateUserById(ctx context.Context, id string, patch *utils.MergePatch) error
+	AddUserRole(ctx context.Context, id string, role utils.Roles) error
+	DeleteUserById(ctx context.Context, id string) error
 }
 
 type userUseCase struct {
 	userRepo repositories.UserRepository
+	accounts AccountUsecase
 }
 
-func NewUserUsecase(userRepo repositories.UserRepository) UserUseCase {
+func NewUserUsecase(userRepo repositories.UserRepository, accounts AccountUsecase) UserUseCase {
 	return &userUseCase{
 		userRepo: userRepo,
+		accounts: accounts,
 	}
 }
 
 func (uc *userUseCase) RegisterUser(ctx context.Context, user *models.User) (*models.User, error) {
 
-	// assign a default role of customer if no role is provided
-	if len(user.Roles) == 0 {
-		user.Roles = append(user.Roles, utils.CUSTOMER)
-	}
+	// everyone signs up as a customer; other roles are granted by the
+	// flows that own them, e.g. accepting a doctor invite
+	user.Roles = []utils.Roles{utils.CUSTOMER}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("could not hash password: %w", err)
 	}
 	user.Password = string(hashedPassword)
+	// email ownership is only established through the verification link
+	user.EmailVerified = false
+	user.EmailVerifiedAt = nil
 
 	savedUser, err := uc.userRepo.RegisterUser(ctx, user)
 
 	if err != nil {
 		return nil, err
 	}
-	return savedUser, nil
-
-}
-
-func (uc *userUseCase) LoginUser(ctx context.Context, details *utils.LoginRequest) (map[string]interface{}, error) {
-
-	filter := bson.M{"email": details.Email}
-
-	users, err := uc.userRepo.GetUsersByQuery(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("error getting user: %w", err)
-	}
-	if len(users) == 0 || users == nil {
-		return nil, fmt.Errorf("user with email doesn't exist")
-	}
-
-	user := users[0]
-
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(details.Password))
-	if err != nil {
-		return nil, fmt.Errorf("check email and password")
-	}
 
-	//generate token
-	token, err := services.GenerateToken(user.ID, "access")
-
-	if err != nil {
-		return nil, fmt.Errorf("error generating user token: %w", err)
+	// the account exists either way; the user can ask for a new link later
+	if err := uc.accounts.SendVerificationEmail(ctx, savedUser); err != nil {
+		logger.FromContext(ctx).Error("Could not send verification email", "user_id", savedUser.ID.Hex(), "error", err)
 	}
-
-	return map[string]interface{}{
-		"user":  user,
-		"token": token,
-	}, nil
+	return savedUser, nil
 
 }
 
@@ -105,8 +81,8 @@ func (uc *userUseCase) GetUserById(ctx context.Context, id string) (*models.User
 	return user, nil
 }
 
-func (uc *userUseCase) UpdateUserById(ctx context.Context, id string, updateQuery bson.M) error {
-	err := uc.userRepo.UpdateUserById(ctx, id, updateQuery)
+func (uc *userUseCase) UpdateUserById(ctx context.Context, id string, patch *utils.MergePatch) error {
+	err := uc.userRepo.UpdateUserById(ctx, id, patch.Update())
 
 	if err != nil {
 		return fmt.Errorf("could not update user by id: %w", err)
@@ -114,10 +90,23 @@ func (uc *userUseCase) UpdateUserById(ctx context.Context, id string, updateQuer
 	return nil
 }
 
-func (uc *userUseCase) DeleteUserById(ctx context.Context, id string) (int64, error) {
+func (uc *userUseCase) AddUserRole(ctx context.Context, id string, role utils.Roles) error {
+	err := uc.userRepo.UpdateUserById(ctx, id, bson.M{
+		"$addToSet": bson.M{"roles": role},
+	})
+	if err != nil {
+		return fmt.Errorf("could not add role to user: %w", err)
+	}
+	return nil
+}
+
+func (uc *userUseCase) DeleteUserById(ctx context.Context, id string) error {
 	count, err := uc.userRepo.DeleteUserById(ctx, id)
 	if err != nil {
-		return 0, fmt.Errorf("could not update user by id: %w", err)
+		return fmt.Errorf("could not delete user by id: %w", err)
+	}
+	if count == 0 {
+		return repositories.ErrUserNotFound
 	}
-	return count, nil
+	return nil
 }
@@ -24,10 +24,22 @@ const (
 
 type Status string
 
+// appointment lifecycle: booked -> checked_in -> in_progress -> completed,
+// with cancelled and no_show as the other terminal states
 const (
-	WAITING Status = "waiting"
-	ONGOING Status = "ongoing"
-	DONE    Status = "done"
+	BOOKED      Status = "booked"
+	CHECKED_IN  Status = "checked_in"
+	IN_PROGRESS Status = "in_progress"
+	COMPLETED   Status = "completed"
+	CANCELLED   Status = "cancelled"
+	NO_SHOW     Status = "no_show"
+)
+
+type TokenPurpose string
+
+const (
+	PASSWORD_RESET     TokenPurpose = "password_reset"
+	EMAIL_VERIFICATION TokenPurpose = "email_verification"
 )
 
 type Roles string
@@ -41,15 +53,19 @@ const (
 
 var ValidRoles = []Roles{CUSTOMER, DOCTOR, HOSPITAL, ADMIN}
 
+// roles with access to other people's medical data must log in with MFA
+var MFARequiredRoles = []Roles{DOCTOR, HOSPITAL, ADMIN}
+
 // structuring the response manager
 type ApiResponse struct {
-	Success bool              `json:"success"`
-	Message string            `json:"message,omitempty"`
-	Data    interface{}       `json:"data,omitempty"`
-	Error   string            `json:"error,omitempty"`
+	Success bool         `json:"success"`
+	Message string       `json:"message,omitempty"`
+	Data    interface{}  `json:"data,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"`
+	Page    *PageInfo    `json:"page,omitempty"`
 }
 
-
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=1"`
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrorKind classifies domain errors so handlers can answer with the right status
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindGone
+	KindTooManyRequests
+)
+
+var kindStatus = map[ErrorKind]int{
+	KindInternal:        http.StatusInternalServerError,
+	KindValidation:      http.StatusBadRequest,
+	KindUnauthorized:    http.StatusUnauthorized,
+	KindForbidden:       http.StatusForbidden,
+	KindNotFound:        http.StatusNotFound,
+	KindConflict:        http.StatusConflict,
+	KindGone:            http.StatusGone,
+	KindTooManyRequests: http.StatusTooManyRequests,
+}
+
+// Status is the HTTP status a kind of error is reported with
+func (k ErrorKind) Status() int {
+	return kindStatus[k]
+}
+
+// AppError is a typed domain error. Code is a stable, machine readable
+// identifier clients can switch on; Message is safe to show to users.
+type AppError struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+}
+
+func (e *AppError) Error() string {
+	return e.Message
+}
+
+func NotFound(code string, message string) *AppError {
+	return &AppError{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func Conflict(code string, message string) *AppError {
+	return &AppError{Kind: KindConflict, Code: code, Message: message}
+}
+
+func Validation(code string, message string) *AppError {
+	return &AppError{Kind: KindValidation, Code: code, Message: message}
+}
+
+func Forbidden(code string, message string) *AppError {
+	return &AppError{Kind: KindForbidden, Code: code, Message: message}
+}
+
+func Unauthorized(code string, message string) *AppError {
+	return &AppError{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+func Gone(code string, message string) *AppError {
+	return &AppError{Kind: KindGone, Code: code, Message: message}
+}
+
+func TooManyRequests(code string, message string) *AppError {
+	return &AppError{Kind: KindTooManyRequests, Code: code, Message: message}
+}
+
+// errors for requests that cannot be read at all. Handlers answer with these
+// instead of echoing decoder errors back to the client.
+var (
+	ErrInvalidBody  = Validation("invalid_body", "request body must be valid JSON")
+	ErrInvalidQuery = Validation("invalid_query", "invalid query")
+	ErrEmptyPatch   = Validation("empty_patch", "patch contains no changes")
+)
+
+// ClassifyError finds the domain error in err's chain. Field validation
+// errors count as validation errors; anything untyped is internal.
+func ClassifyError(err error) (ErrorKind, string) {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr.Kind, appErr.Code
+	}
+	var fieldErrs ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		return KindValidation, "validation_failed"
+	}
+	return KindInternal, "internal_error"
+}
@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultPageLimit int64 = 20
+	MaxPageLimit     int64 = 100
+)
+
+// PageInfo is returned next to list data so clients can fetch the next page
+type PageInfo struct {
+	Limit      int64  `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// ErrInvalidCursor is returned when a continuation token cannot be used with the request
+var ErrInvalidCursor = Validation("invalid_cursor", "invalid or mismatched cursor")
+
+// PageRequest is a validated list query ready for a repository
+type PageRequest struct {
+	Limit     int64
+	Cursor    string
+	SortField string
+	SortDesc  bool
+	Filter    bson.M
+
+	// digest of the query the cursor is bound to, set by Cursors.Open
+	binding []byte
+}
+
+type FilterKind int
+
+const (
+	FilterString FilterKind = iota
+	FilterObjectID
+	FilterBool
+	// FilterTimeFrom and FilterTimeTo bound a time field to [from, to)
+	FilterTimeFrom
+	FilterTimeTo
+)
+
+// FilterSpec maps a query parameter onto a document field
+type FilterSpec struct {
+	Field string
+	Kind  FilterKind
+}
+
+// ListSpec whitelists what a list endpoint may be sorted and filtered by.
+// Keys are the public query parameter / sort names, values the bson fields.
+type ListSpec struct {
+	SortFields  map[string]string
+	DefaultSort string
+	Filters     map[string]FilterSpec
+}
+
+// query parameters every list endpoint understands
+var pagingParams = map[string]bool{"limit": true, "cursor": true, "sort": true}
+
+// ParseListParams turns ?limit=&cursor=&sort=-field&<filters> into a
+// PageRequest, rejecting anything the spec does not allow
+func ParseListParams(values url.Values, spec ListSpec) (*PageRequest, error) {
+	req := &PageRequest{Limit: DefaultPageLimit, Filter: bson.M{}}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("%w: limit must be a positive integer", ErrInvalidQuery)
+		}
+		if limit > MaxPageLimit {
+			limit = MaxPageLimit
+		}
+		req.Limit = limit
+	}
+	req.Cursor = values.Get("cursor")
+
+	sort := values.Get("sort")
+	if sort == "" {
+		sort = spec.DefaultSort
+	}
+	if sort != "" {
+		name := strings.TrimPrefix(sort, "-")
+		field, ok := spec.SortFields[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, name)
+		}
+		req.SortField = field
+		req.SortDesc = strings.HasPrefix(sort, "-")
+	}
+
+	for param, vals := range values {
+		if pagingParams[param] {
+			continue
+		}
+		filter, ok := spec.Filters[param]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown filter %q", ErrInvalidQuery, param)
+		}
+		if err := applyFilter(req.Filter, filter, vals[0]); err != nil {
+			return nil, fmt.Errorf("%w: %s %v", ErrInvalidQuery, param, err)
+		}
+	}
+
+	return req, nil
+}
+
+func applyFilter(filter bson.M, spec FilterSpec, value string) error {
+	switch spec.Kind {
+	case FilterString:
+		filter[spec.Field] = value
+	case FilterObjectID:
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return fmt.Errorf("must be a valid id")
+		}
+		filter[spec.Field] = id
+	case FilterBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		filter[spec.Field] = b
+	case FilterTimeFrom, FilterTimeTo:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("must be an RFC3339 timestamp")
+		}
+		op := "$gte"
+		if spec.Kind == FilterTimeTo {
+			op = "$lt"
+		}
+		bounds, _ := filter[spec.Field].(bson.M)
+		if bounds == nil {
+			bounds = bson.M{}
+		}
+		bounds[op] = t
+		filter[spec.Field] = bounds
+	}
+	return nil
+}
+
+// Cursors signs the continuation tokens handed to clients. A token is only
+// accepted back on the list, sort and filters it was issued for, so clients
+// can neither forge a position nor carry one over to another query.
+type Cursors struct {
+	key []byte
+}
+
+// NewCursors derives the signing key from secret
+func NewCursors(secret []byte) *Cursors {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("medic page cursor"))
+	return &Cursors{key: mac.Sum(nil)}
+}
+
+// Open binds page to scope, usually the request path, and swaps a signed
+// cursor for the position it carries. It must run before the query reaches a
+// repository, since repositories add filters of their own.
+func (c *Cursors) Open(page *PageRequest, scope string) error {
+	binding, err := pageBinding(page, scope)
+	if err != nil {
+		return err
+	}
+	page.binding = binding
+	if page.Cursor == "" {
+		return nil
+	}
+
+	payload, sig, ok := strings.Cut(page.Cursor, ".")
+	if !ok {
+		return ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, c.sign(binding, payload)) {
+		return ErrInvalidCursor
+	}
+	page.Cursor = payload
+	return nil
+}
+
+// Seal signs the cursor for the next page in info, if there is one
+func (c *Cursors) Seal(page *PageRequest, info *PageInfo) {
+	if info == nil || info.NextCursor == "" {
+		return
+	}
+	info.NextCursor += "." + base64.RawURLEncoding.EncodeToString(c.sign(page.binding, info.NextCursor))
+}
+
+func (c *Cursors) sign(binding []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(binding)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// pageBinding digests everything a cursor is only valid for
+func pageBinding(page *PageRequest, scope string) ([]byte, error) {
+	b, err := bson.Marshal(bson.D{
+		{Key: "scope", Value: scope},
+		{Key: "sort", Value: page.SortField},
+		{Key: "desc", Value: page.SortDesc},
+		{Key: "filter", Value: canonicalFilter(page.Filter)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not encode list query: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+// canonicalFilter orders the keys of filter, so equal filters encode alike
+func canonicalFilter(filter bson.M) bson.D {
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	doc := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		value := filter[key]
+		if nested, ok := value.(bson.M); ok {
+			value = canonicalFilter(nested)
+		}
+		doc = append(doc, bson.E{Key: key, Value: value})
+	}
+	return doc
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MergePatch is a JSON Merge Patch (RFC 7396) translated into mongo update
+// operators: present values are $set, nulls are $unset
+type MergePatch struct {
+	Set   bson.M
+	Unset bson.M
+}
+
+// ImmutableFields is implemented by patch DTOs to name fields that exist on
+// the resource but may never be changed through a patch
+type ImmutableFields interface {
+	ImmutableFields() []string
+}
+
+// Update returns the mongo update document for the patch
+func (p *MergePatch) Update() bson.M {
+	update := bson.M{}
+	if len(p.Set) > 0 {
+		update["$set"] = p.Set
+	}
+	if len(p.Unset) > 0 {
+		update["$unset"] = p.Unset
+	}
+	return update
+}
+
+// DecodeMergePatch reads a merge patch into dst, a pointer to a patch DTO whose
+// fields are pointers. Unknown, immutable and non-nullable null fields are
+// rejected and the populated DTO is validated with v; field problems are
+// returned as ValidationErrors.
+//
+// DTO fields tagged `patch:"nullable"` may be removed with null, and struct
+// pointer fields tagged `patch:"merge"` are merged key by key instead of replaced.
+func (v *Validator) DecodeMergePatch(body io.Reader, dst interface{}) (*MergePatch, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, ErrInvalidBody
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil || raw == nil {
+		return nil, fmt.Errorf("%w: patch must be a JSON object", ErrInvalidBody)
+	}
+
+	var immutable []string
+	if f, ok := dst.(ImmutableFields); ok {
+		immutable = f.ImmutableFields()
+	}
+
+	patch := &MergePatch{Set: bson.M{}, Unset: bson.M{}}
+	if err := buildPatch(raw, reflect.ValueOf(dst).Elem(), "", "", immutable, patch); err != nil {
+		return nil, err
+	}
+	if len(patch.Set) == 0 && len(patch.Unset) == 0 {
+		return nil, ErrEmptyPatch
+	}
+
+	if validationErrs := v.Struct(dst); validationErrs != nil {
+		return nil, validationErrs
+	}
+
+	return patch, nil
+}
+
+// name is the JSON path used in errors, path the bson path used in the update
+func buildPatch(raw map[string]json.RawMessage, v reflect.Value, namePrefix string, pathPrefix string, immutable []string, patch *MergePatch) error {
+	fields := patchFields(v.Type())
+
+	for key, value := range raw {
+		name := namePrefix + key
+		index, ok := fields[key]
+		if !ok {
+			for _, field := range immutable {
+				if field == name {
+					return fieldError(name, "immutable", "%s cannot be changed", name)
+				}
+			}
+			return fieldError(name, "unknown_field", "unknown field %s", name)
+		}
+
+		sf := v.Type().Field(index)
+		field := v.Field(index)
+		path := pathPrefix + bsonName(sf)
+		tag := sf.Tag.Get("patch")
+
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			if tag != "nullable" {
+				return fieldError(name, "not_nullable", "%s cannot be null", name)
+			}
+			patch.Unset[path] = ""
+			continue
+		}
+
+		if tag == "merge" && field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(value, &nested); err != nil {
+				return fieldError(name, "type", "%s must be an object", name)
+			}
+			field.Set(reflect.New(field.Type().Elem()))
+			if err := buildPatch(nested, field.Elem(), name+".", path+".", immutable, patch); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := json.Unmarshal(value, field.Addr().Interface()); err != nil {
+			return fieldError(name, "type", "invalid value for %s", name)
+		}
+		if field.Kind() == reflect.Ptr {
+			patch.Set[path] = field.Elem().Interface()
+		} else {
+			patch.Set[path] = field.Interface()
+		}
+	}
+	return nil
+}
+
+// patchFields indexes a DTO's fields by their JSON name
+func patchFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = i
+	}
+	return fields
+}
+
+func bsonName(sf reflect.StructField) string {
+	if name := strings.Split(sf.Tag.Get("bson"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.Split(sf.Tag.Get("json"), ",")[0]
+}
+
+func fieldError(field string, code string, format string, args ...interface{}) ValidationErrors {
+	return ValidationErrors{{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are the networks of the load balancers and ingresses in
+// front of the server; only they are believed about X-Forwarded-For
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies reads a comma separated list of CIDRs or single IPs,
+// e.g. "10.0.0.0/8, 192.168.1.10"
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP or CIDR", entry)
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return proxies, nil
+}
+
+func (p TrustedProxies) trusts(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the address of the client that made the request. The peer is
+// the client unless it is a trusted proxy; then X-Forwarded-For is read from
+// the right, skipping trusted hops, since everything left of the first
+// untrusted hop could have been made up by the client.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	ip := peerIP(r)
+	if !p.trusts(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// a garbled entry ends the chain we can vouch for
+			return ip
+		}
+		ip = hop
+		if !p.trusts(hop) {
+			return hop
+		}
+	}
+	return ip
+}
+
+type clientIPKey struct{}
+
+// WithClientIP stores the resolved client address for ClientIP
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP is the client address resolved by the ClientIP middleware, or the
+// connection's peer when the request did not pass through it. Forwarding
+// headers are never read here since any client can set them.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,63 +1,161 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
-var validate *validator.Validate
+// Validator checks request DTOs against their validate tags. It is safe for
+// concurrent use; build one with NewValidator and share it.
+type Validator struct {
+	validate *validator.Validate
+}
+
+// NewValidator returns a validator with the custom rules registered
+func NewValidator() *Validator {
+	v := validator.New()
+	// report JSON names so error paths match what clients sent
+	v.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("roles", IsValidRole)
+	v.RegisterValidation("specialties", isValidSpecialty)
+	v.RegisterValidation("e164", isValidE164)
+	v.RegisterValidation("geopoint", isValidGeoPointType)
+	v.RegisterValidation("clock", isValidClock)
+	return &Validator{validate: v}
+}
+
+// FieldError describes one invalid field. Field is the JSON path, e.g.
+// location.point.coordinates[0], and Code the rule that failed.
+type FieldError struct {
+	Field   string            `json:"field"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Params  map[string]string `json:"params,omitempty"`
+}
 
-func init() {
-	fmt.Println("Initializing validator...")
-	validate = validator.New()
-	validate.RegisterValidation("roles", IsValidRole)
-	validate.RegisterValidation("specialties", isValidSpecialty)
-	validate.RegisterValidation("e164", isValidE164)
-	validate.RegisterValidation("geopoint", isValidGeoPointType)
+// ValidationErrors is the list of field errors for one request
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Message
+	}
+	return strings.Join(messages, ", ")
 }
 
-// ValidateStruct validates any struct using go-playground/validator.
-// It returns a map of field errors if validation fails.
+// FieldErrors pulls the field errors out of err, if it carries any
+func FieldErrors(err error) []FieldError {
+	var v ValidationErrors
+	if errors.As(err, &v) {
+		return v
+	}
+	return nil
+}
 
-func ValidateStruct(s interface{}) string {
-	err := validate.Struct(s)
+// Struct validates any struct using go-playground/validator.
+// It returns nil if the struct is valid.
+func (v *Validator) Struct(s interface{}) ValidationErrors {
+	err := v.validate.Struct(s)
 
 	if err == nil {
-		return ""
+		return nil
 	}
 
 	// Check if it's a validation error
-	if _, ok := err.(validator.ValidationErrors); !ok {
-		return err.Error()
+	fieldErrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return ValidationErrors{{Code: "invalid", Message: err.Error()}}
+	}
+
+	errs := make(ValidationErrors, 0, len(fieldErrs))
+	for _, e := range fieldErrs {
+		errs = append(errs, toFieldError(e))
+	}
+	return errs
+}
+
+func toFieldError(e validator.FieldError) FieldError {
+	field := e.Namespace()
+	// drop the struct name the namespace starts with
+	if i := strings.Index(field, "."); i >= 0 {
+		field = field[i+1:]
 	}
 
-	var messages []string
-
-	for _, e := range err.(validator.ValidationErrors) {
-		field := e.Field()
-		tag := e.Tag()
-		var message string
-
-		// Customize certain messages for readability
-		switch tag {
-		case "required":
-			message = fmt.Sprintf("%s is required", field)
-		case "email":
-			message = fmt.Sprintf("%s must be a valid email address", field)
-		case "min":
-			message = fmt.Sprintf("%s must meet the minimum length", field)
-		case "max":
-			message = fmt.Sprintf("%s exceeds the maximum length", field)
-		default:
-			message = fmt.Sprintf("%s failed on the '%s' validation", field, tag)
+	fe := FieldError{Field: field, Code: e.Tag()}
+	param := e.Param()
+
+	// Customize certain messages for readability
+	switch e.Tag() {
+	case "required", "required_without":
+		fe.Message = fmt.Sprintf("%s is required", field)
+	case "email":
+		fe.Message = fmt.Sprintf("%s must be a valid email address", field)
+	case "min", "max", "len":
+		fe.Params = map[string]string{"limit": param}
+		fe.Message = fmt.Sprintf("%s %s", field, sizeMessage(e.Tag(), e.Kind(), param))
+	case "gt", "gte", "lt", "lte":
+		fe.Params = map[string]string{"limit": param}
+		fe.Message = fmt.Sprintf("%s must be %s %s", field, comparisons[e.Tag()], param)
+	case "gtfield", "gtefield", "ltfield", "ltefield":
+		fe.Params = map[string]string{"field": param}
+		fe.Message = fmt.Sprintf("%s must be %s %s", field, comparisons[strings.TrimSuffix(e.Tag(), "field")], param)
+	case "oneof":
+		fe.Params = map[string]string{"allowed": param}
+		fe.Message = fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(param, " ", ", "))
+	case "e164":
+		fe.Message = fmt.Sprintf("%s must be a phone number in E.164 format, e.g. +2348012345678", field)
+	case "roles":
+		fe.Message = fmt.Sprintf("%s is not a valid role", field)
+	case "specialties":
+		fe.Message = fmt.Sprintf("%s is not a valid specialty", field)
+	case "geopoint":
+		fe.Message = fmt.Sprintf("%s must be \"Point\"", field)
+	case "clock":
+		fe.Message = fmt.Sprintf("%s must be a 24h time like 09:30", field)
+	case "timezone":
+		fe.Message = fmt.Sprintf("%s must be an IANA timezone like Africa/Lagos", field)
+	case "datetime":
+		fe.Params = map[string]string{"layout": param}
+		fe.Message = fmt.Sprintf("%s must be a date formatted as %s", field, param)
+	default:
+		if param != "" {
+			fe.Params = map[string]string{"param": param}
 		}
+		fe.Message = fmt.Sprintf("%s failed on the '%s' validation", field, e.Tag())
+	}
+	return fe
+}
 
-		messages = append(messages, message)
+var comparisons = map[string]string{
+	"gt":  "greater than",
+	"gte": "at least",
+	"lt":  "less than",
+	"lte": "at most",
+}
+
+// sizeMessage words min/max/len for strings, lists and numbers
+func sizeMessage(tag string, kind reflect.Kind, param string) string {
+	bound := map[string]string{"min": "at least", "max": "at most", "len": "exactly"}[tag]
+	switch kind {
+	case reflect.String:
+		return fmt.Sprintf("must be %s %s characters long", bound, param)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Sprintf("must contain %s %s items", bound, param)
+	default:
+		return fmt.Sprintf("must be %s %s", bound, param)
 	}
-	return strings.Join(messages, ", ")
 }
 
 func IsValidRole(fl validator.FieldLevel) bool {
@@ -92,3 +190,10 @@ func isValidGeoPointType(fl validator.FieldLevel) bool {
 	// For GeoJSON, type should always be "Point"
 	return geoType == "Point"
 }
+
+var clockRegex = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+
+func isValidClock(fl validator.FieldLevel) bool {
+	// 24h wall clock time, e.g. 09:30
+	return clockRegex.MatchString(fl.Field().String())
+}
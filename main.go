@@ -1,61 +1,102 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github/Chidi-creator/go-medic-server/config"
-	"github/Chidi-creator/go-medic-server/internal/handlers"
+	"github/Chidi-creator/go-medic-server/internal/app"
+	"github/Chidi-creator/go-medic-server/internal/logger"
 	"github/Chidi-creator/go-medic-server/internal/mongo"
-	"github/Chidi-creator/go-medic-server/internal/repositories"
-	"github/Chidi-creator/go-medic-server/internal/routes"
-	"github/Chidi-creator/go-medic-server/internal/usecases"
-	_ "github/Chidi-creator/go-medic-server/internal/utils"
-	"log"
-
-	"net/http"
-)
-
-var (
-	userCollection        = "users"
-	hospitalCollection    = "hospitals"
-	doctorCollection      = "doctors"
-	appointmentCollection = "appointments"
+	"github/Chidi-creator/go-medic-server/internal/services"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
-	//connect to mongoDB
+	//`migrate [up|status]` manages the schema and exits; anything else serves
+	args := os.Args[1:]
+	migrateAction := ""
+	if len(args) > 0 && args[0] == "migrate" {
+		migrateAction, args = "up", args[1:]
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			migrateAction, args = args[0], args[1:]
+		}
+	}
 
-	client, err := mongo.NewClient(config.AppConfig.Mongo_URI, config.AppConfig.DB_NAME)
+	cfg, err := config.Load(args)
 	if err != nil {
-		log.Fatal("Could not connect to Mongo DB")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	//every log line, including the standard log package, goes through slog
+	slog.SetDefault(logger.New(os.Stdout, cfg.Log.Format, cfg.Log.Level))
+	slog.Info("Configuration loaded", "env", cfg.Env)
+
+	if migrateAction != "" {
+		os.Exit(runMigrate(cfg, migrateAction))
 	}
-	
-	//create indexes after successful mongo connecttion
-	mongo.CreateIndexes(client.Client, config.AppConfig.DB_NAME)
 
-	//initialising repositories
-	userRepo := repositories.NewUserRepository(client.Client, config.AppConfig.DB_NAME, userCollection)
-	doctorRepo := repositories.NewDoctorRepository(client.Client, config.AppConfig.DB_NAME, doctorCollection)
-	hospitalRepo := repositories.NewHospitalRepository(client.Client, config.AppConfig.DB_NAME, hospitalCollection)
-	appointmentRepo := repositories.NewAppointmentRepository(client.Client, config.AppConfig.DB_NAME, appointmentCollection)
+	var client *mongo.Client
+	deps := app.Dependencies{}
 
-	//initialising usecases
-	userUsecase := usecases.NewUserUsecase(userRepo)
-	doctorUsecase := usecases.NewDoctorUseCase(doctorRepo)
-	hospitalUsecase := usecases.NewHospitalUseCase(hospitalRepo)
-	appointmentUsecase := usecases.NewAppointmentUsecase(appointmentRepo)
+	if cfg.Storage == config.StorageMemory {
+		slog.Warn("Using in-memory storage, nothing will be persisted")
+		deps.Repositories = app.NewMemoryRepositories()
+	} else {
+		//connect to mongoDB
+		client, err = mongo.NewClient(cfg.Mongo)
+		if err != nil {
+			slog.Error("Could not connect to Mongo DB", "error", err)
+			os.Exit(1)
+		}
 
-	//initializing handlers
-	userHandler := handlers.NewUserHandler(userUsecase)
-	doctorHandler := handlers.NewDoctorHandler(doctorUsecase)
-	hospitalHandler := handlers.NewHospitalHandler(hospitalUsecase, userUsecase)
-	appointmentHandler := handlers.NewAppointmentHandler(appointmentUsecase)
-	authHandler := handlers.NewAuthHandler(userUsecase)
+		if cfg.Mongo.MigrateOnStart {
+			if err := migrate(client, cfg.Mongo); err != nil {
+				slog.Error("Could not migrate the database", "error", err)
+				os.Exit(1)
+			}
+		}
 
-	r := routes.NewRouter(userHandler, doctorHandler, hospitalHandler, appointmentHandler, authHandler)
-	r.SetUpRoutes()
+		deps.Repositories = app.NewMongoRepositories(client.Client, cfg.Mongo.Database)
+		deps.HealthChecks = []services.DependencyCheck{
+			{Name: "mongo", Check: client.Ping},
+			{Name: "mongo_transactions", Check: client.CheckTransactions},
+			{Name: "mongo_indexes", Check: func(ctx context.Context) error {
+				return client.CheckIndexes(ctx, cfg.Mongo.Database)
+			}},
+			{Name: "mongo_schema", Check: func(ctx context.Context) error {
+				return client.CheckSchema(ctx, cfg.Mongo.Database)
+			}},
+		}
+	}
+
+	application, err := app.New(cfg, deps)
+	if err != nil {
+		slog.Error("Could not start application", "error", err)
+		os.Exit(1)
+	}
 
-	fmt.Printf("Server started on %v", config.AppConfig.Port)
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-	http.ListenAndServe(":"+config.AppConfig.Port, r.R)
+	runErr := application.Run(stop)
 
+	//the database goes last, after requests and workers no longer need it
+	if client != nil {
+		ctx, cancelDisconnect := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelDisconnect()
+		if err := client.Disconnect(ctx); err != nil {
+			slog.Error("Could not disconnect from MongoDB", "error", err)
+		}
+	}
+
+	slog.Info("Server stopped")
+	if runErr != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github/Chidi-creator/go-medic-server/config"
+	"github/Chidi-creator/go-medic-server/internal/mongo"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runMigrate handles `migrate up` and `migrate status` and returns the exit code
+func runMigrate(cfg *config.Config, action string) int {
+	if action != "up" && action != "status" {
+		fmt.Fprintf(os.Stderr, "unknown migrate action %q, expected up or status\n", action)
+		return 2
+	}
+	if cfg.Storage != config.StorageMongo {
+		fmt.Fprintf(os.Stderr, "migrations only apply to %s storage\n", config.StorageMongo)
+		return 2
+	}
+
+	client, err := mongo.NewClient(cfg.Mongo)
+	if err != nil {
+		slog.Error("Could not connect to Mongo DB", "error", err)
+		return 1
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.Disconnect(ctx); err != nil {
+			slog.Error("Could not disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	if action == "status" {
+		err = printMigrationStatus(client, cfg.Mongo)
+	} else {
+		err = migrate(client, cfg.Mongo)
+	}
+	if err != nil {
+		slog.Error("Migration failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// migrate applies pending migrations, waiting for any other runner first
+func migrate(client *mongo.Client, cfg config.MongoConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.MigrationTimeout)
+	defer cancel()
+
+	applied, err := client.Migrate(ctx, cfg.Database)
+	if err != nil {
+		return err
+	}
+	slog.Info("Database schema is up to date", "applied", len(applied))
+	return nil
+}
+
+func printMigrationStatus(client *mongo.Client, cfg config.MongoConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.MigrationTimeout)
+	defer cancel()
+
+	applied, pending, err := client.MigrationStatus(ctx, cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, record := range applied {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", record.Version, record.Name, record.AppliedAt.Format(time.RFC3339))
+	}
+	for _, migration := range pending {
+		fmt.Fprintf(w, "%d\t%s\tpending\n", migration.Version, migration.Name)
+	}
+	return w.Flush()
+}